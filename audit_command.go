@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/wissem/cc-filter/internal/audit"
+	"github.com/wissem/cc-filter/internal/logger"
+)
+
+const auditUsage = `Usage:
+    cc-filter audit [summary] [FILTERS] [--top N] [--format table|json]
+    cc-filter audit sessions [FILTERS] [--format table|json]
+    cc-filter audit log [FILTERS] [--format table|json]
+
+Filters:
+    --since WHEN      7d, 24h, 2025-09-01 or an RFC 3339 time
+    --session ID      one agent session
+    --rule NAME       decisions citing this rule or pattern
+    --decision LIST   allow, ask, deny, redact, block, override (comma-separated)
+
+The log read is --audit-log (default ~/.cc-filter/audit.jsonl) and its
+rotated files.`
+
+// runAudit implements the "audit" subcommands, which read the decision log
+func runAudit(opts *options, args []string) {
+	view := "summary"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		view, args = args[0], args[1:]
+	}
+	if view != "summary" && view != "sessions" && view != "log" {
+		fmt.Fprintln(os.Stderr, auditUsage)
+		os.Exit(1)
+	}
+
+	flags := flag.NewFlagSet("audit "+view, flag.ExitOnError)
+	flags.Usage = func() { fmt.Fprintln(os.Stderr, auditUsage) }
+	since := flags.String("since", "", "")
+	session := flags.String("session", "", "")
+	rule := flags.String("rule", "", "")
+	decisions := flags.String("decision", "", "")
+	top := flags.Int("top", 10, "")
+	format := flags.String("format", "table", "")
+	flags.Parse(args)
+
+	if flags.NArg() > 0 || (*format != "table" && *format != "json") {
+		fmt.Fprintln(os.Stderr, auditUsage)
+		os.Exit(1)
+	}
+
+	query := audit.Query{Session: *session, Rule: *rule}
+	if *since != "" {
+		t, err := audit.ParseSince(*since, time.Now())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "cc-filter audit: %v\n", err)
+			os.Exit(1)
+		}
+		query.Since = t
+	}
+	if *decisions != "" {
+		query.Decisions = strings.Split(*decisions, ",")
+	}
+
+	path := opts.auditLog
+	if path == "" {
+		path = logger.DefaultAuditFile()
+	}
+	if path == logger.AuditOff || path == "-" || path == "" {
+		fmt.Fprintln(os.Stderr, "cc-filter audit: no audit log file to read; set --audit-log to one")
+		os.Exit(1)
+	}
+	files := logger.Rotated(path)
+	if _, err := os.Stat(path); err == nil {
+		files = append(files, path)
+	}
+	if len(files) == 0 {
+		fmt.Fprintf(os.Stderr, "cc-filter audit: %s does not exist yet; decisions are recorded there as hooks run\n", path)
+		os.Exit(1)
+	}
+
+	entries, skipped, err := audit.ReadFiles(files)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read the audit log: %v\n", err)
+		os.Exit(1)
+	}
+	if skipped > 0 {
+		fmt.Fprintf(os.Stderr, "cc-filter audit: skipped %d lines that are not decisions\n", skipped)
+	}
+	entries = query.Filter(entries)
+
+	var result interface{}
+	var table func(io.Writer)
+	switch view {
+	case "summary":
+		summary := audit.Summarize(entries, *top)
+		result, table = summary, func(w io.Writer) { printSummary(w, summary) }
+	case "sessions":
+		sessions := audit.Sessions(entries)
+		result, table = sessions, func(w io.Writer) { printSessions(w, sessions) }
+	case "log":
+		if entries == nil {
+			entries = []audit.Entry{}
+		}
+		result, table = entries, func(w io.Writer) { printEntries(w, entries, true) }
+	}
+
+	if *format == "json" {
+		out, _ := json.MarshalIndent(result, "", "  ")
+		fmt.Println(string(out))
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	table(w)
+	w.Flush()
+}
+
+func printSummary(w io.Writer, s audit.Summary) {
+	if s.Entries == 0 {
+		fmt.Fprintln(w, "No decisions match.")
+		return
+	}
+	fmt.Fprintf(w, "%d decisions in %d sessions, %s to %s\n", s.Entries, s.Sessions, s.From.Local().Format(time.DateTime), s.To.Local().Format(time.DateTime))
+	var counts []string
+	for _, decision := range []string{"allow", "ask", "deny", "redact", "block", "override"} {
+		if n := s.Decisions[decision]; n > 0 {
+			counts = append(counts, fmt.Sprintf("%s %d", decision, n))
+		}
+	}
+	fmt.Fprintf(w, "%s\n", strings.Join(counts, ", "))
+
+	fmt.Fprintln(w, "\nTOP RULES\tDECISIONS")
+	for _, c := range s.TopRules {
+		fmt.Fprintf(w, "%s\t%d\n", c.Name, c.Count)
+	}
+	fmt.Fprintln(w, "\nMOST DENIED PATHS\tDENIALS")
+	for _, c := range s.DeniedPaths {
+		fmt.Fprintf(w, "%s\t%d\n", c.Name, c.Count)
+	}
+	fmt.Fprintln(w, "\nFALSE POSITIVE CANDIDATES\tFIRED\tOVERRIDDEN\tPATHS")
+	for _, fp := range s.FalsePositives {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\n", fp.Rule, fp.Fired, fp.Overridden, strings.Join(fp.Paths, ", "))
+	}
+	if len(s.FalsePositives) == 0 {
+		fmt.Fprintln(w, "(none: no denial was overridden)")
+	}
+}
+
+func printSessions(w io.Writer, sessions []audit.Session) {
+	if len(sessions) == 0 {
+		fmt.Fprintln(w, "No sessions match.")
+		return
+	}
+	for i, s := range sessions {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "SESSION %s  %s to %s  %d decisions\n", s.ID, s.Start.Local().Format(time.DateTime), s.End.Local().Format(time.TimeOnly), len(s.Entries))
+		printEntries(w, s.Entries, false)
+	}
+}
+
+func printEntries(w io.Writer, entries []audit.Entry, withSession bool) {
+	if len(entries) == 0 {
+		fmt.Fprintln(w, "No decisions match.")
+		return
+	}
+	header := "TIME\tEVENT\tTOOL\tDECISION\tRULES\tPATH"
+	if withSession {
+		header = "TIME\tSESSION\tEVENT\tTOOL\tDECISION\tRULES\tPATH"
+	}
+	fmt.Fprintln(w, header)
+	for _, e := range entries {
+		fields := []string{e.Time.Local().Format(time.DateTime)}
+		if withSession {
+			fields = append(fields, orDash(e.SessionID))
+		}
+		fields = append(fields, orDash(e.HookEventName), orDash(e.ToolName), e.Decision, orDash(strings.Join(e.Rules, ",")), orDash(e.Path))
+		fmt.Fprintln(w, strings.Join(fields, "\t"))
+	}
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/wissem/cc-filter/internal/rules"
+)
+
+const configUsage = `Usage:
+    cc-filter config show [--effective] [--origin] [--dir DIR]
+    cc-filter config validate [--dir DIR] [FILE...]`
+
+// runConfig implements the "config" subcommands
+func runConfig(opts *options, args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, configUsage)
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "show":
+		runConfigShow(opts, args[1:])
+	case "validate":
+		runConfigValidate(opts, args[1:])
+	default:
+		fmt.Fprintln(os.Stderr, configUsage)
+		os.Exit(1)
+	}
+}
+
+func runConfigShow(opts *options, args []string) {
+	flags := flag.NewFlagSet("config show", flag.ExitOnError)
+	effective := flags.Bool("effective", false, "print the merged configuration")
+	origin := flags.Bool("origin", false, "annotate each entry with the file it came from")
+	dir := flags.String("dir", "", "project directory to discover configs from (default: current directory)")
+	flags.Parse(args)
+
+	r, err := rules.Load(defaultRulesYAML, opts.loadOptions(*dir))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load configuration: %v\n", err)
+		os.Exit(1)
+	}
+
+	if !*effective {
+		fmt.Printf("Project root: %s\n\nConfiguration layers (later overrides earlier):\n  %s\n", r.ProjectRoot(), rules.DefaultsOrigin)
+		for _, source := range r.Sources() {
+			fmt.Printf("  %s\n", source)
+		}
+		return
+	}
+
+	out, err := r.EffectiveYAML(*origin)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to render configuration: %v\n", err)
+		os.Exit(1)
+	}
+	os.Stdout.Write(out)
+}
+
+// runConfigValidate checks the configuration layers and exits 1 if any of
+// them has errors. Warnings are reported but do not fail validation.
+func runConfigValidate(opts *options, args []string) {
+	flags := flag.NewFlagSet("config validate", flag.ExitOnError)
+	dir := flags.String("dir", "", "project directory to discover configs from (default: current directory)")
+	flags.Parse(args)
+
+	issues := rules.Validate(defaultRulesYAML, opts.loadOptions(*dir), flags.Args()...)
+	for _, issue := range issues {
+		fmt.Println(issue)
+	}
+
+	if rules.HasErrors(issues) {
+		os.Exit(1)
+	}
+	if len(issues) == 0 {
+		fmt.Println("Configuration is valid")
+	}
+}
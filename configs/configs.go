@@ -0,0 +1,9 @@
+// Package configs holds the configuration files built into cc-filter
+package configs
+
+import _ "embed"
+
+// DefaultRules is the built-in rule set every configuration is layered on
+//
+//go:embed default-rules.yaml
+var DefaultRules []byte
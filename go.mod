@@ -1,5 +1,8 @@
-module cc-filter
+module github.com/wissem/cc-filter
 
 go 1.23
 
-require gopkg.in/yaml.v3 v3.0.1
+require (
+	github.com/BurntSushi/toml v1.5.0
+	gopkg.in/yaml.v3 v3.0.1
+)
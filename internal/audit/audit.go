@@ -0,0 +1,167 @@
+// Package audit reads the decision log cc-filter writes and summarizes it
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Entry is one decision from the audit log
+type Entry struct {
+	Time          time.Time `json:"time"`
+	Agent         string    `json:"agent,omitempty"`
+	SessionID     string    `json:"session_id,omitempty"`
+	HookEventName string    `json:"hook_event_name,omitempty"`
+	ToolName      string    `json:"tool_name,omitempty"`
+	Decision      string    `json:"decision"`
+	Rules         []string  `json:"rules"`
+	Path          string    `json:"path,omitempty"`
+	RedactedBytes int64     `json:"redacted_bytes,omitempty"`
+	// Annotations are what plugins added, by plugin name
+	Annotations map[string]map[string]string `json:"annotations,omitempty"`
+	// Processors are what each processor decided, when several did
+	Processors       []Processor `json:"processors,omitempty"`
+	InputFingerprint string      `json:"input_fingerprint,omitempty"`
+	InputBytes       int64       `json:"input_bytes"`
+	LatencyMS        float64     `json:"latency_ms"`
+	Mode             string      `json:"mode,omitempty"`
+	Version          string      `json:"version,omitempty"`
+}
+
+// Processor is one processor's part in a decision
+type Processor struct {
+	Processor string   `json:"processor"`
+	Decision  string   `json:"decision"`
+	Rules     []string `json:"rules,omitempty"`
+}
+
+// Read decodes the decisions in r. Lines that are not decisions, such as a
+// line cut short by a full disk, are counted in skipped rather than failing
+// the whole read.
+func Read(r io.Reader) (entries []Entry, skipped int, err error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), 1<<20)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var entry struct {
+			Entry
+			Msg string `json:"msg"`
+		}
+		if err := json.Unmarshal(line, &entry); err != nil || entry.Msg != "decision" {
+			skipped++
+			continue
+		}
+		entries = append(entries, entry.Entry)
+	}
+	return entries, skipped, scanner.Err()
+}
+
+// ReadFiles reads the decisions in files, in order. Gzipped files, as the
+// log is rotated to, are decompressed.
+func ReadFiles(files []string) (entries []Entry, skipped int, err error) {
+	for _, name := range files {
+		fileEntries, fileSkipped, err := readFile(name)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%s: %w", name, err)
+		}
+		entries = append(entries, fileEntries...)
+		skipped += fileSkipped
+	}
+	return entries, skipped, nil
+}
+
+func readFile(name string) ([]Entry, int, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	if strings.HasSuffix(name, ".gz") {
+		zr, err := gzip.NewReader(file)
+		if err != nil {
+			return nil, 0, err
+		}
+		defer zr.Close()
+		r = zr
+	}
+	return Read(r)
+}
+
+// Query selects decisions. Zero fields select everything.
+type Query struct {
+	Since     time.Time
+	Session   string
+	Rule      string
+	Decisions []string
+}
+
+// Match reports whether e is selected by q
+func (q Query) Match(e Entry) bool {
+	if !q.Since.IsZero() && e.Time.Before(q.Since) {
+		return false
+	}
+	if q.Session != "" && e.SessionID != q.Session {
+		return false
+	}
+	if q.Rule != "" && !contains(e.Rules, q.Rule) {
+		return false
+	}
+	if len(q.Decisions) > 0 && !contains(q.Decisions, e.Decision) {
+		return false
+	}
+	return true
+}
+
+// Filter returns the entries q selects
+func (q Query) Filter(entries []Entry) []Entry {
+	var selected []Entry
+	for _, e := range entries {
+		if q.Match(e) {
+			selected = append(selected, e)
+		}
+	}
+	return selected
+}
+
+// ParseSince reads a --since value: a duration back from now such as "7d",
+// "36h" or "90m", a date such as "2025-09-01" (midnight, local time) or an
+// RFC 3339 time
+func ParseSince(value string, now time.Time) (time.Time, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	if t, err := time.ParseInLocation(time.DateOnly, value, now.Location()); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q: use a duration such as 7d or 24h, a date such as 2025-09-01, or an RFC 3339 time", value)
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
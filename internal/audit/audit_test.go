@@ -0,0 +1,97 @@
+package audit
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testLog = `{"time":"2025-09-08T09:00:00Z","level":"INFO","msg":"decision","session_id":"s1","hook_event_name":"PreToolUse","tool_name":"Read","decision":"deny","rules":[".env"],"path":"/app/.env","input_bytes":25,"latency_ms":0.2,"mode":"enforce"}
+{"time":"2025-09-08T09:01:00Z","level":"INFO","msg":"decision","session_id":"s1","hook_event_name":"PreToolUse","tool_name":"Read","decision":"override","rules":[".env"],"path":"/app/.env","input_bytes":25,"latency_ms":0.2,"mode":"enforce"}
+{"time":"2025-09-08T09:02:00Z","level":"INFO","msg":"decision","session_id":"s1","hook_event_name":"PostToolUse","tool_name":"Bash","decision":"redact","rules":["api_keys"],"input_bytes":90,"latency_ms":0.4,"mode":"enforce"}
+{"time":"2025-09-09T10:00:00Z","level":"INFO","msg":"decision","session_id":"s2","hook_event_name":"PreToolUse","tool_name":"Read","decision":"deny","rules":["*.pem"],"path":"/app/tls/server.pem","input_bytes":30,"latency_ms":0.1,"mode":"enforce"}
+{"time":"2025-09-09T10:05:00Z","level":"INFO","msg":"decision","session_id":"s2","hook_event_name":"PreToolUse","tool_name":"Read","decision":"deny","rules":[".env"],"path":"/app/.env","input_bytes":25,"latency_ms":0.2,"mode":"enforce"}
+{"time":"2025-09-09T10:06:00Z","level":"INFO","msg":"decision","decision":"allow","rules":[],"input_bytes":12,"latency_ms":0.1,"mode":"enforce"}
+{"time":"2025-09-09T10:07:00Z","level":"INFO","msg":"decision","session_id":"s2","hook_event_name":"PreToolUse","tool_name":"Read","dec
+not json
+`
+
+func readTestLog(t *testing.T) []Entry {
+	t.Helper()
+	entries, skipped, err := Read(strings.NewReader(testLog))
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if len(entries) != 6 || skipped != 2 {
+		t.Fatalf("Read() = %d entries, %d skipped; want 6 and 2", len(entries), skipped)
+	}
+	return entries
+}
+
+func TestQuery(t *testing.T) {
+	entries := readTestLog(t)
+	since, _ := ParseSince("2025-09-09T00:00:00Z", time.Now())
+
+	tests := []struct {
+		name  string
+		query Query
+		want  int
+	}{
+		{"everything", Query{}, 6},
+		{"since", Query{Since: since}, 3},
+		{"session", Query{Session: "s1"}, 3},
+		{"rule", Query{Rule: ".env"}, 3},
+		{"decisions", Query{Decisions: []string{"deny", "override"}}, 4},
+		{"combined", Query{Session: "s2", Rule: ".env", Decisions: []string{"deny"}}, 1},
+	}
+	for _, tt := range tests {
+		if got := len(tt.query.Filter(entries)); got != tt.want {
+			t.Errorf("%s: %d entries, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	s := Summarize(readTestLog(t), 10)
+
+	if s.Entries != 6 || s.Sessions != 2 {
+		t.Errorf("Entries, Sessions = %d, %d; want 6, 2", s.Entries, s.Sessions)
+	}
+	if want := []Count{{".env", 3}, {"*.pem", 1}, {"api_keys", 1}}; !reflect.DeepEqual(s.TopRules, want) {
+		t.Errorf("TopRules = %v, want %v", s.TopRules, want)
+	}
+	if want := []Count{{"/app/.env", 2}, {"/app/tls/server.pem", 1}}; !reflect.DeepEqual(s.DeniedPaths, want) {
+		t.Errorf("DeniedPaths = %v, want %v", s.DeniedPaths, want)
+	}
+	want := []FalsePositive{{Rule: ".env", Fired: 2, Overridden: 1, Paths: []string{"/app/.env"}}}
+	if !reflect.DeepEqual(s.FalsePositives, want) {
+		t.Errorf("FalsePositives = %+v, want %+v", s.FalsePositives, want)
+	}
+
+	sessions := Sessions(readTestLog(t))
+	if len(sessions) != 2 || sessions[0].ID != "s1" || len(sessions[0].Entries) != 3 || sessions[1].Decisions["deny"] != 2 {
+		t.Errorf("Sessions() = %+v", sessions)
+	}
+}
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2025, 9, 9, 12, 0, 0, 0, time.UTC)
+	tests := map[string]time.Time{
+		"7d":                   time.Date(2025, 9, 2, 12, 0, 0, 0, time.UTC),
+		"36h":                  time.Date(2025, 9, 8, 0, 0, 0, 0, time.UTC),
+		"2025-09-01":           time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC),
+		"2025-09-01T08:00:00Z": time.Date(2025, 9, 1, 8, 0, 0, 0, time.UTC),
+	}
+	for value, want := range tests {
+		got, err := ParseSince(value, now)
+		if err != nil || !got.Equal(want) {
+			t.Errorf("ParseSince(%q) = %v, %v; want %v", value, got, err, want)
+		}
+	}
+	for _, value := range []string{"last week", "-3d", "-1h"} {
+		if _, err := ParseSince(value, now); err == nil {
+			t.Errorf("ParseSince(%q) accepted", value)
+		}
+	}
+}
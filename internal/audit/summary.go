@@ -0,0 +1,183 @@
+package audit
+
+import (
+	"sort"
+	"time"
+
+	"github.com/wissem/cc-filter/internal/hooks"
+)
+
+// Count is how often something appears in the log
+type Count struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// FalsePositive is a rule that denied access the user then allowed with a
+// one-time override: a candidate for narrowing or an exception
+type FalsePositive struct {
+	Rule       string   `json:"rule"`
+	Fired      int      `json:"fired"`      // denials and other decisions citing the rule
+	Overridden int      `json:"overridden"` // of those, denials the user then lifted
+	Paths      []string `json:"paths,omitempty"`
+}
+
+// Summary is an overview of a set of decisions
+type Summary struct {
+	Entries        int             `json:"entries"`
+	From           time.Time       `json:"from"`
+	To             time.Time       `json:"to"`
+	Sessions       int             `json:"sessions"`
+	Decisions      map[string]int  `json:"decisions"`
+	TopRules       []Count         `json:"top_rules"`
+	DeniedPaths    []Count         `json:"most_denied_paths"`
+	FalsePositives []FalsePositive `json:"false_positive_candidates"`
+}
+
+// Summarize counts decisions, the rules behind them and the paths denied
+// most, keeping the top entries of each list. top <= 0 keeps everything.
+func Summarize(entries []Entry, top int) Summary {
+	s := Summary{
+		Entries:        len(entries),
+		Decisions:      map[string]int{},
+		TopRules:       []Count{},
+		DeniedPaths:    []Count{},
+		FalsePositives: []FalsePositive{},
+	}
+	rules := map[string]int{}
+	denied := map[string]int{}
+	sessions := map[string]bool{}
+	for _, e := range entries {
+		if s.From.IsZero() || e.Time.Before(s.From) {
+			s.From = e.Time
+		}
+		if e.Time.After(s.To) {
+			s.To = e.Time
+		}
+		if e.SessionID != "" {
+			sessions[e.SessionID] = true
+		}
+		s.Decisions[e.Decision]++
+		if e.Decision != hooks.DecisionAllow {
+			for _, rule := range e.Rules {
+				rules[rule]++
+			}
+		}
+		if e.Decision == hooks.DecisionDeny && e.Path != "" {
+			denied[e.Path]++
+		}
+	}
+	s.Sessions = len(sessions)
+	s.TopRules = limit(ranked(rules), top)
+	s.DeniedPaths = limit(ranked(denied), top)
+	s.FalsePositives = limit(FalsePositives(entries), top)
+	return s
+}
+
+// FalsePositives lists the rules whose denials were overridden, most
+// overridden first
+func FalsePositives(entries []Entry) []FalsePositive {
+	byRule := map[string]*FalsePositive{}
+	paths := map[string]map[string]bool{}
+	for _, e := range entries {
+		if e.Decision == hooks.DecisionAllow {
+			continue
+		}
+		for _, rule := range e.Rules {
+			fp := byRule[rule]
+			if fp == nil {
+				fp = &FalsePositive{Rule: rule}
+				byRule[rule] = fp
+				paths[rule] = map[string]bool{}
+			}
+			if e.Decision != hooks.DecisionOverride {
+				fp.Fired++
+				continue
+			}
+			fp.Overridden++
+			if e.Path != "" && !paths[rule][e.Path] {
+				paths[rule][e.Path] = true
+				fp.Paths = append(fp.Paths, e.Path)
+			}
+		}
+	}
+
+	candidates := []FalsePositive{}
+	for _, fp := range byRule {
+		if fp.Overridden > 0 {
+			candidates = append(candidates, *fp)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.Overridden != b.Overridden {
+			return a.Overridden > b.Overridden
+		}
+		// a rule overridden as often from fewer firings is more suspect
+		if a.Fired != b.Fired {
+			return a.Fired < b.Fired
+		}
+		return a.Rule < b.Rule
+	})
+	return candidates
+}
+
+// Session is the timeline of one agent session
+type Session struct {
+	ID        string         `json:"session_id"`
+	Start     time.Time      `json:"start"`
+	End       time.Time      `json:"end"`
+	Decisions map[string]int `json:"decisions"`
+	Entries   []Entry        `json:"entries"`
+}
+
+// Sessions groups entries by session, in time order; entries without a
+// session, such as plain text, are left out. Sessions are sorted by when
+// they started.
+func Sessions(entries []Entry) []Session {
+	index := map[string]int{}
+	sessions := []Session{}
+	for _, e := range entries {
+		if e.SessionID == "" {
+			continue
+		}
+		i, ok := index[e.SessionID]
+		if !ok {
+			i = len(sessions)
+			index[e.SessionID] = i
+			sessions = append(sessions, Session{ID: e.SessionID, Decisions: map[string]int{}})
+		}
+		sessions[i].Entries = append(sessions[i].Entries, e)
+		sessions[i].Decisions[e.Decision]++
+	}
+
+	for i := range sessions {
+		s := &sessions[i]
+		sort.SliceStable(s.Entries, func(a, b int) bool { return s.Entries[a].Time.Before(s.Entries[b].Time) })
+		s.Start, s.End = s.Entries[0].Time, s.Entries[len(s.Entries)-1].Time
+	}
+	sort.SliceStable(sessions, func(a, b int) bool { return sessions[a].Start.Before(sessions[b].Start) })
+	return sessions
+}
+
+// ranked turns counts into a list, most frequent first
+func ranked(counts map[string]int) []Count {
+	list := make([]Count, 0, len(counts))
+	for name, count := range counts {
+		list = append(list, Count{Name: name, Count: count})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Count != list[j].Count {
+			return list[i].Count > list[j].Count
+		}
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+func limit[T any](list []T, top int) []T {
+	if top > 0 && len(list) > top {
+		return list[:top]
+	}
+	return list
+}
@@ -0,0 +1,131 @@
+package filter
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/wissem/cc-filter/internal/hooks"
+	"github.com/wissem/cc-filter/internal/metrics"
+)
+
+// decision is what the audit log records about one input
+type decision struct {
+	hookData    map[string]interface{} // nil for plain text
+	record      hooks.Record
+	fingerprint string
+	inputBytes  int64
+	start       time.Time
+}
+
+// recordDecision writes one decision to the audit log and counts it in the
+// metrics. Inputs are only identified by a fingerprint, never written out,
+// and paths are redacted.
+func (f *Filter) recordDecision(d decision) {
+	latency := time.Since(d.start)
+	event, _ := d.hookData["hook_event_name"].(string)
+	tool, _ := d.hookData["tool_name"].(string)
+	if tool == "" {
+		tool = d.record.Tool
+	}
+	if f.opts.Metrics != nil {
+		metricsEvent := event
+		if d.hookData == nil {
+			metricsEvent = "text"
+		}
+		f.opts.Metrics.Observe(metrics.Decision{
+			Event:         metricsEvent,
+			Tool:          tool,
+			Decision:      d.record.Decision,
+			Rules:         d.record.Rules,
+			RedactedBytes: int64(d.record.RedactedBytes),
+			Latency:       latency,
+		})
+	}
+	if f.opts.Audit == nil {
+		return
+	}
+
+	session, _ := d.hookData["session_id"].(string)
+	if session == "" {
+		session = d.record.Session
+	}
+	attrs := make([]slog.Attr, 0, 14)
+	for _, attr := range []slog.Attr{
+		slog.String("agent", d.record.Agent),
+		slog.String("session_id", session),
+		slog.String("hook_event_name", event),
+		slog.String("tool_name", tool),
+	} {
+		if attr.Value.String() != "" {
+			attrs = append(attrs, attr)
+		}
+	}
+	rules := d.record.Rules
+	if rules == nil {
+		rules = []string{}
+	}
+	attrs = append(attrs, slog.String("decision", d.record.Decision), slog.Any("rules", rules))
+	if d.record.Path != "" {
+		attrs = append(attrs, slog.String("path", f.opts.Redactor.Redact(d.record.Path)))
+	}
+	if d.record.RedactedBytes > 0 {
+		attrs = append(attrs, slog.Int("redacted_bytes", d.record.RedactedBytes))
+	}
+	if len(d.record.Annotations) > 0 {
+		attrs = append(attrs, slog.Any("annotations", f.redactAnnotations(d.record.Annotations)))
+	}
+	if len(d.record.Contributions) > 0 {
+		attrs = append(attrs, slog.Any("processors", d.record.Contributions))
+	}
+	attrs = append(attrs,
+		slog.String("input_fingerprint", d.fingerprint),
+		slog.Int64("input_bytes", d.inputBytes),
+		slog.Float64("latency_ms", float64(latency.Microseconds())/1000),
+		slog.String("mode", string(f.modeOrDefault())),
+	)
+	f.opts.Audit.LogAttrs(context.Background(), slog.LevelInfo, "decision", attrs...)
+}
+
+// redactAnnotations redacts what plugins annotated a decision with, since
+// plugins see the whole payload
+func (f *Filter) redactAnnotations(annotations map[string]map[string]string) map[string]map[string]string {
+	redacted := make(map[string]map[string]string, len(annotations))
+	for plugin, values := range annotations {
+		redacted[plugin] = make(map[string]string, len(values))
+		for key, value := range values {
+			redacted[plugin][key] = f.opts.Redactor.Redact(value)
+		}
+	}
+	return redacted
+}
+
+func (f *Filter) modeOrDefault() Mode {
+	if f.opts.Mode == "" {
+		return ModeEnforce
+	}
+	return f.opts.Mode
+}
+
+// hookSubject returns what a hook asks cc-filter to judge: the prompt, the
+// tool's response or its input. Cursor sends the command or file itself.
+func hookSubject(hookData map[string]interface{}) []byte {
+	subject := hookData["tool_input"]
+	for _, key := range []string{"command", "file_path"} {
+		if value, ok := hookData[key]; ok && subject == nil {
+			subject = value
+		}
+	}
+	if prompt, ok := hookData["prompt"]; ok {
+		subject = prompt
+	}
+	if response, ok := hookData["tool_response"]; ok {
+		subject = response
+	}
+	if answer, ok := hookData["last-assistant-message"]; ok {
+		subject = answer
+	}
+	data, _ := json.Marshal(subject)
+	return data
+}
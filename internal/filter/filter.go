@@ -1,31 +1,202 @@
 package filter
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"path/filepath"
 	"strings"
+	"time"
 
-	"cc-filter/internal/hooks"
-	"cc-filter/internal/rules"
+	"github.com/wissem/cc-filter/internal/hooks"
+	"github.com/wissem/cc-filter/internal/metrics"
+	"github.com/wissem/cc-filter/internal/rules"
 )
 
+// ConfigErrorPolicy decides what happens when the configuration is invalid
+type ConfigErrorPolicy string
+
+const (
+	// FailClosed denies tool calls and blocks prompts and plain-text input
+	// until the configuration is fixed
+	FailClosed ConfigErrorPolicy = "fail_closed"
+	// FailOpen skips the invalid layers and rules, logs what was skipped and
+	// filters with everything that still loads
+	FailOpen ConfigErrorPolicy = "fail_open"
+)
+
+// ParseConfigErrorPolicy parses a policy name. It defaults to FailClosed,
+// and also returns FailClosed alongside the error for bad values.
+func ParseConfigErrorPolicy(value string) (ConfigErrorPolicy, error) {
+	switch value {
+	case "", string(FailClosed):
+		return FailClosed, nil
+	case string(FailOpen):
+		return FailOpen, nil
+	default:
+		return FailClosed, fmt.Errorf("invalid config error policy %q: must be fail_closed or fail_open", value)
+	}
+}
+
+// Mode decides whether decisions are enforced or only logged
+type Mode string
+
+const (
+	ModeEnforce Mode = "enforce"
+	// ModeAudit logs what would have been blocked or redacted and lets
+	// everything through unchanged
+	ModeAudit Mode = "audit"
+)
+
+// ParseMode parses a mode name. It defaults to ModeEnforce, and also
+// returns ModeEnforce alongside the error for bad values.
+func ParseMode(value string) (Mode, error) {
+	switch value {
+	case "", string(ModeEnforce):
+		return ModeEnforce, nil
+	case string(ModeAudit):
+		return ModeAudit, nil
+	default:
+		return ModeEnforce, fmt.Errorf("invalid mode %q: must be enforce or audit", value)
+	}
+}
+
+// Options configures a Filter
+type Options struct {
+	// OnConfigError decides what happens when the configuration is invalid.
+	// An untrusted organization policy always fails closed.
+	OnConfigError ConfigErrorPolicy
+
+	// Load holds the config layer options; Dir and Lenient are set per load
+	Load rules.LoadOptions
+
+	// CacheDir is the root for redacted copies; empty means hooks.DefaultCacheDir
+	CacheDir string
+
+	Mode Mode
+
+	// Logger receives the filter's log lines; nil means log.Default()
+	Logger *log.Logger
+
+	// Audit receives one structured record per decision; nil disables it
+	Audit *slog.Logger
+
+	// Metrics counts every decision; nil counts nothing
+	Metrics *metrics.Metrics
+
+	// Redactor fingerprints inputs for the audit log and is kept matching
+	// with the rules last loaded, so the caller can redact its own log with
+	// it; nil means one with a random key
+	Redactor *Redactor
+}
+
 type Filter struct {
-	rules        *rules.Rules
-	hookRegistry *hooks.Registry
+	defaultRulesYAML []byte
+	opts             Options
+	rules            *rules.Rules
+	loadErr          error
+	hookRegistry     *hooks.Registry
 }
 
-func New(defaultRulesYAML []byte) (*Filter, error) {
-	r, err := rules.LoadRules(defaultRulesYAML)
+func New(defaultRulesYAML []byte, opts Options) (*Filter, error) {
+	if opts.Logger == nil {
+		opts.Logger = log.Default()
+	}
+	if opts.Redactor == nil {
+		opts.Redactor = NewRedactor(defaultRulesYAML, nil)
+	}
+	f := &Filter{
+		defaultRulesYAML: defaultRulesYAML,
+		opts:             opts,
+	}
+
+	r, err := f.load(opts.Load.Dir)
+	if err != nil {
+		if !f.failsClosed(err) {
+			return nil, err
+		}
+		f.opts.Logger.Printf("Invalid configuration, failing closed: %v", err)
+		f.loadErr = err
+		f.hookRegistry = f.configErrorRegistry(err)
+		return f, nil
+	}
+
+	f.rules = r
+	f.hookRegistry = f.newRegistry(r)
+	return f, nil
+}
+
+// Rules returns the rules loaded for the filter's directory, or nil when
+// the configuration is invalid and the filter fails closed
+func (f *Filter) Rules() *rules.Rules {
+	return f.rules
+}
+
+// LoadError returns why the configuration could not be loaded when the
+// filter fails closed
+func (f *Filter) LoadError() error {
+	return f.loadErr
+}
+
+// load loads the rules for dir according to the filter's policy
+func (f *Filter) load(dir string) (*rules.Rules, error) {
+	opts := f.opts.Load
+	opts.Dir = dir
+	opts.Lenient = f.opts.OnConfigError == FailOpen
+	r, err := rules.Load(f.defaultRulesYAML, opts)
 	if err != nil {
 		return nil, err
 	}
+	f.opts.Redactor.use(r)
+	for _, warning := range r.Warnings() {
+		f.opts.Logger.Printf("Config warning: %s", warning)
+	}
+	return r, nil
+}
+
+// failsClosed reports whether a load error is answered by denying everything
+func (f *Filter) failsClosed(err error) bool {
+	var policyErr *rules.PolicyError
+	return f.opts.OnConfigError != FailOpen || errors.As(err, &policyErr)
+}
+
+// newRegistry returns processors for every agent whose hooks cc-filter
+// answers, all using r, and the plugins r declares
+func (f *Filter) newRegistry(r *rules.Rules) *hooks.Registry {
+	claude := hooks.NewClaudeHookProcessor(r)
+	cursor := hooks.NewCursorHookProcessor(r)
+	gemini := hooks.NewGeminiHookProcessor(r)
+	codex := hooks.NewCodexNotifyProcessor(r)
 
 	registry := hooks.NewRegistry()
-	registry.Register(hooks.NewClaudeHookProcessor(r))
+	registry.SetComposer(hooks.ComposerFor(r.Compose))
+	for _, processor := range []*hooks.ClaudeHookProcessor{claude, cursor.ClaudeHookProcessor, gemini.ClaudeHookProcessor, codex.ClaudeHookProcessor} {
+		processor.SetCacheDir(f.opts.CacheDir)
+		processor.SetLogger(f.opts.Logger)
+	}
+	registry.Register(claude)
+	registry.Register(cursor)
+	registry.Register(gemini)
+	registry.Register(codex)
+	for _, plugin := range r.Plugins {
+		registry.Use(hooks.NewPlugin(plugin, f.opts.Logger))
+	}
+	return registry
+}
+
+func (f *Filter) configErrorRegistry(err error) *hooks.Registry {
+	processor := hooks.NewConfigErrorProcessor(err)
+	processor.SetCacheDir(f.opts.CacheDir)
+	processor.SetLogger(f.opts.Logger)
 
-	return &Filter{
-		rules:        r,
-		hookRegistry: registry,
-	}, nil
+	registry := hooks.NewRegistry()
+	registry.Register(processor)
+	return registry
 }
 
 type ProcessResult struct {
@@ -35,20 +206,223 @@ type ProcessResult struct {
 }
 
 func (f *Filter) Process(input string) ProcessResult {
-	input = strings.TrimSpace(input)
+	result, hook := f.process(input)
+	return f.audit(result, hook, input)
+}
+
+// ProcessHook answers a decoded hook payload. handled is false when no
+// processor recognises it.
+func (f *Filter) ProcessHook(hookData map[string]interface{}) (result ProcessResult, handled bool) {
+	result, handled = f.processHook(hookData)
+	if !handled {
+		return result, false
+	}
+	return f.audit(result, true, ""), true
+}
 
-	if strings.HasPrefix(input, "{") && strings.HasSuffix(input, "}") {
+// ProcessReader filters src to dst. Input that parses as a JSON hook
+// payload is handled by the hook processors; anything else, including the
+// bytes read while trying to parse it, is streamed through the content
+// filter byte for byte, so plain text of any size is filtered in bounded
+// memory. Nothing is written when result.Error is set. The returned error
+// is an I/O failure.
+func (f *Filter) ProcessReader(dst io.Writer, src io.Reader) (ProcessResult, error) {
+	in := bufio.NewReaderSize(src, peekSize)
+	if !looksLikeJSON(in) {
+		return f.streamText(dst, in)
+	}
+
+	read, hookData, ok := readHookPayload(in)
+	if ok {
+		if result, handled := f.ProcessHook(hookData); handled {
+			var err error
+			if result.Error == nil {
+				_, err = io.WriteString(dst, result.Output)
+			}
+			return result, err
+		}
+	}
+	return f.streamText(dst, io.MultiReader(bytes.NewReader(read), in))
+}
+
+// readHookPayload decodes a single JSON object followed only by whitespace.
+// It returns every byte it consumed, so input that is not a payload can
+// still be filtered as text. Decoding stops at the first syntax error, so
+// text that merely opens with a brace is not read whole.
+func readHookPayload(in *bufio.Reader) ([]byte, map[string]interface{}, bool) {
+	var read bytes.Buffer
+	decoder := json.NewDecoder(io.TeeReader(in, &read))
+	var hookData map[string]interface{}
+	if err := decoder.Decode(&hookData); err != nil {
+		return read.Bytes(), nil, false
+	}
+	if len(bytes.TrimSpace(read.Bytes()[decoder.InputOffset():])) > 0 {
+		return read.Bytes(), nil, false
+	}
+	for {
+		b, err := in.ReadByte()
+		if err != nil {
+			break
+		}
+		read.WriteByte(b)
+		if !isSpace(b) {
+			return read.Bytes(), nil, false
+		}
+	}
+	return read.Bytes(), hookData, true
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\r' || b == '\n'
+}
+
+// streamText filters plain text from src to dst in bounded memory
+func (f *Filter) streamText(dst io.Writer, in io.Reader) (ProcessResult, error) {
+	start := time.Now()
+	if f.loadErr != nil {
+		f.recordDecision(decision{record: hooks.Record{Decision: hooks.DecisionBlock}, start: start})
+		return ProcessResult{Filtered: true, Error: fmt.Errorf("cc-filter: %v", f.loadErr)}, nil
+	}
+
+	h := f.opts.Redactor.newHash()
+	var stream rules.StreamResult
+	var err error
+	if f.opts.Mode == ModeAudit {
+		// pass the input through untouched and filter a copy only to log it
+		stream, err = f.rules.FilterReader(io.Discard, io.TeeReader(io.TeeReader(in, h), dst))
+		if err == nil && stream.Filtered {
+			f.opts.Logger.Printf("AUDIT: enforce mode would have redacted this input: patterns %s", strings.Join(stream.MatchedPatterns, ", "))
+		}
+	} else {
+		stream, err = f.rules.FilterReader(dst, io.TeeReader(in, h))
+	}
+	if err != nil {
+		return ProcessResult{}, err
+	}
+
+	f.recordDecision(decision{
+		record:      textRecord(stream.Filtered, stream.MatchedPatterns, int(stream.RedactedBytes)),
+		fingerprint: fingerprintOf(h),
+		inputBytes:  stream.InputBytes,
+		start:       start,
+	})
+	if f.opts.Mode == ModeAudit {
+		return ProcessResult{}, nil
+	}
+	return ProcessResult{Filtered: stream.Filtered}, nil
+}
+
+// peekSize bounds how much leading whitespace ProcessReader looks past to
+// tell a JSON payload from plain text
+const peekSize = 64 << 10
+
+// looksLikeJSON reports whether the first non-whitespace byte opens an object
+func looksLikeJSON(in *bufio.Reader) bool {
+	peeked, _ := in.Peek(peekSize)
+	trimmed := bytes.TrimLeft(peeked, " \t\r\n")
+	return len(trimmed) > 0 && trimmed[0] == '{'
+}
+
+// audit turns a result into a passthrough in audit mode, logging what
+// enforcement would have done
+func (f *Filter) audit(result ProcessResult, hook bool, input string) ProcessResult {
+	if f.opts.Mode != ModeAudit {
+		return result
+	}
+
+	acted := result.Error != nil || (hook && result.Output != "" && result.Output != "{}") || (!hook && result.Filtered)
+	if !acted {
+		return result
+	}
+	decision := result.Output
+	if result.Error != nil {
+		decision = result.Error.Error()
+	}
+	if line, _, cut := strings.Cut(decision, "\n"); cut {
+		decision = line + " ..."
+	}
+	f.opts.Logger.Printf("AUDIT: enforce mode would have blocked or redacted this input: %s", decision)
+
+	if hook {
+		return ProcessResult{Output: "", Filtered: false}
+	}
+	return ProcessResult{Output: input, Filtered: false}
+}
+
+// process runs input through the hook processors or the content filter and
+// reports whether it was handled as a hook
+func (f *Filter) process(input string) (ProcessResult, bool) {
+	start := time.Now()
+
+	if trimmed := strings.TrimSpace(input); strings.HasPrefix(trimmed, "{") && strings.HasSuffix(trimmed, "}") {
 		var hookData map[string]interface{}
-		if err := json.Unmarshal([]byte(input), &hookData); err == nil {
-			if result, handled, hookErr := f.hookRegistry.Process(hookData); handled {
-				if hookErr != nil {
-					return ProcessResult{Output: "", Filtered: true, Error: hookErr}
-				}
-				return ProcessResult{Output: result, Filtered: true, Error: nil}
+		if err := json.Unmarshal([]byte(trimmed), &hookData); err == nil {
+			if result, handled := f.processHook(hookData); handled {
+				return result, true
 			}
 		}
 	}
 
+	text := decision{fingerprint: f.opts.Redactor.Fingerprint([]byte(input)), inputBytes: int64(len(input)), start: start}
+	if f.loadErr != nil {
+		text.record = hooks.Record{Decision: hooks.DecisionBlock}
+		f.recordDecision(text)
+		return ProcessResult{Output: "", Filtered: true, Error: fmt.Errorf("cc-filter: %v", f.loadErr)}, false
+	}
+
 	result := f.rules.FilterContent(input)
-	return ProcessResult{Output: result.Content, Filtered: result.Filtered, Error: nil}
-}
\ No newline at end of file
+	text.record = textRecord(result.Filtered, result.MatchedPatterns, result.RedactedBytes)
+	f.recordDecision(text)
+	return ProcessResult{Output: result.Content, Filtered: result.Filtered, Error: nil}, false
+}
+
+func (f *Filter) processHook(hookData map[string]interface{}) (ProcessResult, bool) {
+	d := decision{hookData: hookData, start: time.Now()}
+	subject := hookSubject(hookData)
+	d.fingerprint, d.inputBytes = f.opts.Redactor.Fingerprint(subject), int64(len(subject))
+
+	registry, err := f.registryFor(hookData)
+	if err != nil {
+		d.record = hooks.Record{Decision: hooks.DecisionBlock}
+		f.recordDecision(d)
+		return ProcessResult{Output: "", Filtered: true, Error: err}, true
+	}
+	result, record, handled, hookErr := registry.ProcessRecorded(hookData)
+	if !handled {
+		return ProcessResult{}, false
+	}
+	d.record = record
+	f.recordDecision(d)
+	if hookErr != nil {
+		return ProcessResult{Output: "", Filtered: true, Error: hookErr}, true
+	}
+	return ProcessResult{Output: result, Filtered: true, Error: nil}, true
+}
+
+// textRecord describes the decision about plain text
+func textRecord(filtered bool, patterns []string, redacted int) hooks.Record {
+	if !filtered {
+		return hooks.Record{Decision: hooks.DecisionAllow}
+	}
+	return hooks.Record{Decision: hooks.DecisionRedact, Rules: patterns, RedactedBytes: redacted}
+}
+
+// registryFor returns processors using the rules of the hook's working
+// directory. Hooks run from the agent's project, but the payload's cwd is
+// authoritative when the two differ.
+func (f *Filter) registryFor(hookData map[string]interface{}) (*hooks.Registry, error) {
+	cwd := hooks.WorkingDir(hookData)
+	if cwd == "" || !filepath.IsAbs(cwd) {
+		return f.hookRegistry, nil
+	}
+
+	r, err := f.load(cwd)
+	if err != nil {
+		if f.failsClosed(err) {
+			f.opts.Logger.Printf("Invalid configuration for %s, failing closed: %v", cwd, err)
+			return f.configErrorRegistry(err), nil
+		}
+		return nil, err
+	}
+	return f.newRegistry(r), nil
+}
@@ -0,0 +1,48 @@
+package filter
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/wissem/cc-filter/configs"
+	"github.com/wissem/cc-filter/internal/rules"
+)
+
+func TestProcessReaderKeepsTextThatOpensWithABrace(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	inputs := map[string]string{
+		"code":       "{\n" + strings.Repeat("  call(x);\n", 20000) + "}\n",
+		"json":       `{"not": "a hook payload"}` + "\n\n",
+		"json+text":  "{}\ntrailing text\n",
+		"unfinished": `{"a": 1,` + strings.Repeat(" ", 200000) + "\n",
+	}
+	for _, mode := range []Mode{ModeEnforce, ModeAudit} {
+		f, err := New(configs.DefaultRules, Options{
+			Load:     rules.LoadOptions{NoUserConfig: true, NoProjectConfigs: true},
+			CacheDir: t.TempDir(),
+			Mode:     mode,
+			Logger:   log.New(&bytes.Buffer{}, "", 0),
+		})
+		if err != nil {
+			t.Fatalf("New: %v", err)
+		}
+		for name, input := range inputs {
+			var out bytes.Buffer
+			if _, err := f.ProcessReader(&out, strings.NewReader(input)); err != nil {
+				t.Fatalf("%s: ProcessReader: %v", name, err)
+			}
+			if out.String() != input {
+				t.Errorf("%s mode, %s: %d bytes in, %d out", mode, name, len(input), out.Len())
+			}
+		}
+
+		var out bytes.Buffer
+		result, _ := f.ProcessReader(&out, strings.NewReader(`{"hook_event_name": "UserPromptSubmit", "prompt": "hi"}`+"\n"))
+		if result.Error != nil || out.String() != "{}" {
+			t.Errorf("%s mode: a hook payload should still reach the hooks, got %q, %v", mode, out.String(), result.Error)
+		}
+	}
+}
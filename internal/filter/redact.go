@@ -0,0 +1,150 @@
+package filter
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/wissem/cc-filter/internal/rules"
+)
+
+// Redactor keeps secrets out of the logs. Log lines have whatever the
+// current rules match replaced by the rule's name and a keyed fingerprint,
+// and inputs are identified in the audit log by the same fingerprints, so
+// the logs can tell two secrets apart without revealing either.
+type Redactor struct {
+	defaultRulesYAML []byte
+	key              []byte
+
+	rules    atomic.Pointer[rules.Rules]
+	defaults sync.Once
+}
+
+// NewRedactor returns a redactor keyed with key; nil means a random key, so
+// fingerprints can only be compared within one run. Until the filter loads
+// its rules, the redactor uses the defaults.
+func NewRedactor(defaultRulesYAML []byte, key []byte) *Redactor {
+	if key == nil {
+		key = make([]byte, 32)
+		rand.Read(key)
+	}
+	return &Redactor{defaultRulesYAML: defaultRulesYAML, key: key}
+}
+
+// use makes the redactor match with r, the rules loaded last
+func (d *Redactor) use(r *rules.Rules) {
+	d.rules.Store(r)
+}
+
+// Redact replaces every span of text the rules filter with
+// [RULE hmac:FINGERPRINT]. Log lines often quote what they report, so the
+// rules also run over text with Go and JSON string escapes undone.
+func (d *Redactor) Redact(text string) string {
+	r := d.current()
+	if r == nil {
+		return text
+	}
+	text = d.replace(text, r.Findings(text), nil)
+	if strings.IndexByte(text, '\\') < 0 {
+		return text
+	}
+	unescaped, offsets := unescape(text)
+	return d.replace(text, r.Findings(unescaped), offsets)
+}
+
+// replace replaces findings in text. With offsets, the findings are in
+// unescaped text and offsets maps them back to text.
+func (d *Redactor) replace(text string, findings []rules.Finding, offsets []int) string {
+	if len(findings) == 0 {
+		return text
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, finding := range findings {
+		start, end := finding.Start, finding.End
+		if offsets != nil {
+			start, end = offsets[start], offsets[end]
+		}
+		b.WriteString(text[last:start])
+		b.WriteString("[" + finding.Pattern + " " + d.Fingerprint([]byte(text[start:end])) + "]")
+		last = end
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// unescape undoes backslash escapes the way strconv.Quote and encoding/json
+// write them, leaving anything it does not recognise as is. offsets maps
+// each byte offset of the result, and its end, to the offset in text.
+func unescape(text string) (string, []int) {
+	var b strings.Builder
+	offsets := make([]int, 0, len(text)+1)
+	for i := 0; i < len(text); {
+		c, size := text[i], 1
+		if c == '\\' && i+1 < len(text) {
+			size = 2
+			switch text[i+1] {
+			case 'n':
+				c = '\n'
+			case 't':
+				c = '\t'
+			case 'r':
+				c = '\r'
+			case '"', '\\', '/', '\'':
+				c = text[i+1]
+			case 'u':
+				// only ASCII: a \u escape then stands for a single byte
+				if i+6 <= len(text) {
+					if v, err := strconv.ParseUint(text[i+2:i+6], 16, 16); err == nil && v < 0x80 {
+						c, size = byte(v), 6
+						break
+					}
+				}
+				size = 1
+			default:
+				size = 1
+			}
+		}
+		b.WriteByte(c)
+		offsets = append(offsets, i)
+		i += size
+	}
+	offsets = append(offsets, len(text))
+	return b.String(), offsets
+}
+
+// current returns the rules to redact with, falling back to the defaults
+// before any rules are loaded
+func (d *Redactor) current() *rules.Rules {
+	d.defaults.Do(func() {
+		if d.rules.Load() != nil {
+			return
+		}
+		if r, err := rules.Load(d.defaultRulesYAML, rules.LoadOptions{NoUserConfig: true, NoProjectConfigs: true, Lenient: true}); err == nil {
+			d.rules.CompareAndSwap(nil, r)
+		}
+	})
+	return d.rules.Load()
+}
+
+// Fingerprint identifies data in the logs without revealing it
+func (d *Redactor) Fingerprint(data []byte) string {
+	h := d.newHash()
+	h.Write(data)
+	return fingerprintOf(h)
+}
+
+func (d *Redactor) newHash() hash.Hash {
+	return hmac.New(sha256.New, d.key)
+}
+
+func fingerprintOf(h hash.Hash) string {
+	return "hmac:" + hex.EncodeToString(h.Sum(nil)[:8])
+}
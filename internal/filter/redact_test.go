@@ -0,0 +1,107 @@
+package filter
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"log/slog"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/wissem/cc-filter/configs"
+	"github.com/wissem/cc-filter/internal/logger"
+	"github.com/wissem/cc-filter/internal/rules"
+)
+
+// TestLogsNeverContainMatchedSecrets feeds every example secret of the
+// default rules through each kind of input, in both modes, and checks that
+// neither the log nor the audit log contains anything a rule matched.
+func TestLogsNeverContainMatchedSecrets(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	var logs, audit bytes.Buffer
+	redactor := NewRedactor(configs.DefaultRules, []byte("test fingerprint key"))
+	newFilter := func(mode Mode) *Filter {
+		f, err := New(configs.DefaultRules, Options{
+			Load:     rules.LoadOptions{NoUserConfig: true, NoProjectConfigs: true},
+			CacheDir: t.TempDir(),
+			Mode:     mode,
+			Logger:   log.New(logger.NewRedactingWriter(&logs, redactor.Redact), "", 0),
+			Audit:    slog.New(slog.NewJSONHandler(&audit, nil)),
+			Redactor: redactor,
+		})
+		if err != nil {
+			t.Fatalf("New: %v", err)
+		}
+		return f
+	}
+	filters := []*Filter{newFilter(ModeEnforce), newFilter(ModeAudit)}
+	r := filters[0].Rules()
+
+	hook := func(fields map[string]interface{}) string {
+		fields["session_id"] = "test-session"
+		data, _ := json.Marshal(fields)
+		return string(data)
+	}
+
+	checked := 0
+	for _, pattern := range r.Patterns {
+		for _, example := range pattern.Examples.Match {
+			// each input carries the example in a value; what the rules
+			// match in that value must not reach either log
+			inputs := map[string]string{
+				example: example,
+				hook(map[string]interface{}{"hook_event_name": "UserPromptSubmit", "prompt": example}):                                                                                      example,
+				hook(map[string]interface{}{"hook_event_name": "PreToolUse", "tool_name": "Read", "tool_input": map[string]interface{}{"file_path": "/app/.env/" + example}}):               "/app/.env/" + example,
+				hook(map[string]interface{}{"hook_event_name": "PreToolUse", "tool_name": "Grep", "tool_input": map[string]interface{}{"pattern": "x", "path": "/app/secrets/" + example}}): "/app/secrets/" + example,
+				hook(map[string]interface{}{"hook_event_name": "PreToolUse", "tool_name": "Bash", "tool_input": map[string]interface{}{"command": "cat .env\n" + example}}):                 "cat .env\n" + example,
+				hook(map[string]interface{}{"hook_event_name": "PostToolUse", "tool_name": "Bash", "tool_response": map[string]interface{}{"stdout": example}}):                             example,
+			}
+			for input, value := range inputs {
+				findings := r.Findings(value)
+				if len(findings) == 0 {
+					continue
+				}
+				logs.Reset()
+				audit.Reset()
+				for _, f := range filters {
+					f.Process(input)
+					f.ProcessReader(&bytes.Buffer{}, strings.NewReader(input))
+				}
+
+				for _, finding := range findings {
+					secret := value[finding.Start:finding.End]
+					quoted := strconv.Quote(secret)
+					for name, out := range map[string]string{"log": logs.String(), "audit log": audit.String()} {
+						if strings.Contains(out, secret) || strings.Contains(out, quoted[1:len(quoted)-1]) {
+							t.Errorf("%s: the %s contains %q:\n%s", pattern.Name, name, secret, out)
+						}
+					}
+				}
+				checked++
+			}
+		}
+	}
+	if checked == 0 {
+		t.Fatal("no example secrets were checked")
+	}
+}
+
+func TestRedactorFingerprintsAreKeyed(t *testing.T) {
+	a := NewRedactor(configs.DefaultRules, []byte("key a"))
+	b := NewRedactor(configs.DefaultRules, []byte("key b"))
+	secret := []byte("API_KEY=abcdefghij1234567890XYZ")
+
+	if a.Fingerprint(secret) != a.Fingerprint(secret) {
+		t.Error("the same key gave two fingerprints for one input")
+	}
+	if a.Fingerprint(secret) == b.Fingerprint(secret) {
+		t.Error("different keys gave the same fingerprint")
+	}
+
+	line := a.Redact("deploying with API_KEY=abcdefghij1234567890XYZ now")
+	if want := "deploying with [api_keys " + a.Fingerprint(secret) + "] now"; line != want {
+		t.Errorf("Redact() = %q, want %q", line, want)
+	}
+}
@@ -0,0 +1,147 @@
+package hooks
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/wissem/cc-filter/internal/rules"
+)
+
+// agentFixture is one hook payload under testdata/agents/<agent>/ and what
+// cc-filter must answer to it
+type agentFixture struct {
+	Payload  map[string]interface{} `json:"payload"`
+	Decision string                 `json:"decision"`
+	Rules    []string               `json:"rules"`
+	// Response holds the fields the JSON response must have; none means
+	// an empty response
+	Response map[string]interface{} `json:"response"`
+	// Error is set when the hook must fail with a message, exiting 2
+	Error bool `json:"error"`
+}
+
+// testSecret appears in fixtures and must never be echoed back
+const testSecret = "sk-1234567890abcdefghijklmnopqrstuvwxyz123456789012"
+
+func agentRegistry(t *testing.T, cacheDir string) *Registry {
+	t.Helper()
+	r, err := rules.LoadRules(testDefaultRules())
+	if err != nil {
+		t.Fatalf("LoadRules: %v", err)
+	}
+	claude, cursor, gemini, codex := NewClaudeHookProcessor(r), NewCursorHookProcessor(r), NewGeminiHookProcessor(r), NewCodexNotifyProcessor(r)
+	claude.cacheDir, cursor.cacheDir, gemini.cacheDir, codex.cacheDir = cacheDir, cacheDir, cacheDir, cacheDir
+
+	registry := NewRegistry()
+	registry.Register(claude)
+	registry.Register(cursor)
+	registry.Register(gemini)
+	registry.Register(codex)
+	return registry
+}
+
+func TestAgentFixtures(t *testing.T) {
+	files, _ := filepath.Glob("testdata/agents/*/*.json")
+	if len(files) == 0 {
+		t.Fatal("no fixtures found")
+	}
+	registry := agentRegistry(t, t.TempDir())
+
+	for _, file := range files {
+		name := strings.TrimSuffix(strings.TrimPrefix(file, "testdata/agents/"), ".json")
+		t.Run(name, func(t *testing.T) {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var fixture agentFixture
+			if err := json.Unmarshal(data, &fixture); err != nil {
+				t.Fatalf("invalid fixture: %v", err)
+			}
+
+			output, record, handled, err := registry.ProcessRecorded(fixture.Payload)
+			if !handled {
+				t.Fatal("payload not handled")
+			}
+			if record.Decision != fixture.Decision {
+				t.Errorf("decision = %q, want %q", record.Decision, fixture.Decision)
+			}
+			if fixture.Rules != nil && !reflect.DeepEqual(record.Rules, fixture.Rules) {
+				t.Errorf("rules = %q, want %q", record.Rules, fixture.Rules)
+			}
+			if strings.Contains(output, testSecret) || (err != nil && strings.Contains(err.Error(), testSecret)) {
+				t.Errorf("secret echoed back: %q, %v", output, err)
+			}
+
+			if fixture.Error {
+				if err == nil {
+					t.Errorf("no error, output %s", output)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if fixture.Response == nil {
+				if output != "" {
+					t.Errorf("output = %s, want none", output)
+				}
+				return
+			}
+			var response map[string]interface{}
+			if err := json.Unmarshal([]byte(output), &response); err != nil {
+				t.Fatalf("output %q is not JSON: %v", output, err)
+			}
+			for key, want := range fixture.Response {
+				if !reflect.DeepEqual(response[key], want) {
+					t.Errorf("%s = %v, want %v", key, response[key], want)
+				}
+			}
+		})
+	}
+}
+
+func TestConfigErrorAnswersEveryAgent(t *testing.T) {
+	processor := NewConfigErrorProcessor(errors.New("broken.yaml: invalid"))
+	processor.cacheDir = t.TempDir()
+
+	tests := []struct {
+		payload  string
+		key      string
+		want     interface{}
+		agent    string
+		blocking bool
+	}{
+		{`{"hook_event_name":"beforeShellExecution","conversation_id":"c1","command":"ls"}`, "permission", "deny", AgentCursor, false},
+		{`{"hook_event_name":"beforeSubmitPrompt","conversation_id":"c1","prompt":"hi"}`, "continue", false, AgentCursor, false},
+		{`{"hook_event_name":"BeforeTool","session_id":"s1","tool_name":"read_file","tool_input":{"file_path":"README.md"}}`, "decision", "deny", AgentGemini, false},
+		{`{"hook_event_name":"BeforeAgent","session_id":"s1","prompt":"hi"}`, "", nil, AgentGemini, true},
+	}
+	for _, tt := range tests {
+		var payload map[string]interface{}
+		json.Unmarshal([]byte(tt.payload), &payload)
+		if !processor.CanHandle(payload) {
+			t.Errorf("%s: not handled", tt.payload)
+			continue
+		}
+		output, record, err := processor.ProcessRecorded(payload)
+		if record.Agent != tt.agent {
+			t.Errorf("%s: agent = %q, want %q", tt.payload, record.Agent, tt.agent)
+		}
+		if tt.blocking {
+			if err == nil || !strings.Contains(err.Error(), "broken.yaml") {
+				t.Errorf("%s: error = %v", tt.payload, err)
+			}
+			continue
+		}
+		var response map[string]interface{}
+		if err := json.Unmarshal([]byte(output), &response); err != nil || response[tt.key] != tt.want {
+			t.Errorf("%s: response %s, want %s = %v", tt.payload, output, tt.key, tt.want)
+		}
+	}
+}
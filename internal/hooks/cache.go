@@ -0,0 +1,149 @@
+package hooks
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+var safeSessionID = regexp.MustCompile(`^[A-Za-z0-9_-]{1,128}$`)
+
+// DefaultCacheDir returns the root directory for redacted copies.
+// $XDG_RUNTIME_DIR is preferred because it is per-user, private and
+// cleared on logout; otherwise the cache lives under ~/.cc-filter/cache.
+func DefaultCacheDir() string {
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		return filepath.Join(runtimeDir, "cc-filter")
+	}
+	if homeDir, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(homeDir, ".cc-filter", "cache")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("cc-filter-%d", os.Getuid()))
+}
+
+// SetCacheDir moves the root directory for redacted copies; "" keeps the default
+func (c *ClaudeHookProcessor) SetCacheDir(dir string) {
+	if dir != "" {
+		c.cacheDir = dir
+	}
+}
+
+// sessionKey turns a session_id into a single safe path component.
+// IDs that could escape the cache root are replaced by their hash.
+func sessionKey(sessionID string) string {
+	if sessionID == "" {
+		return "default"
+	}
+	if safeSessionID.MatchString(sessionID) {
+		return sessionID
+	}
+	hash := sha256.Sum256([]byte(sessionID))
+	return fmt.Sprintf("%x", hash[:16])
+}
+
+// sessionCacheDir returns the cache directory for one session without creating it
+func (c *ClaudeHookProcessor) sessionCacheDir(sessionID string) string {
+	return filepath.Join(c.cacheDir, sessionKey(sessionID))
+}
+
+// ensureSessionCacheDir creates the cache root and the session directory
+// with 0700 permissions, refusing to follow symlinks planted in their place.
+func (c *ClaudeHookProcessor) ensureSessionCacheDir(sessionID string) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(c.cacheDir), 0700); err != nil {
+		return "", err
+	}
+	if err := ensurePrivateDir(c.cacheDir); err != nil {
+		return "", err
+	}
+	dir := c.sessionCacheDir(sessionID)
+	if err := ensurePrivateDir(dir); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+func ensurePrivateDir(dir string) error {
+	err := os.Mkdir(dir, 0700)
+	if err != nil && !os.IsExist(err) {
+		return err
+	}
+
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSymlink != 0 || !info.IsDir() {
+		return fmt.Errorf("refusing to use cache directory %s: not a real directory", dir)
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		return os.Chmod(dir, 0700)
+	}
+	return nil
+}
+
+// writePrivateFile atomically writes data to dir/name with 0600 permissions.
+// The content goes to an O_EXCL temp file that is renamed into place, so
+// readers never see a partial file and a symlink planted at the final name is
+// replaced rather than followed.
+func writePrivateFile(dir, name string, data []byte) (string, error) {
+	tmp, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return "", err
+	}
+	tmpPath := tmp.Name()
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return "", err
+	}
+
+	path := filepath.Join(dir, name)
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return "", err
+	}
+	return path, nil
+}
+
+// redactedCacheName derives the cache entry name for a file from its path,
+// its content and the rules fingerprint. The leading path hash groups every
+// version of the same file so stale entries can be found and removed.
+func redactedCacheName(originalPath string, content []byte, rulesFingerprint string) (prefix, name string) {
+	pathHash := sha256.Sum256([]byte(originalPath))
+	contentHash := sha256.Sum256(content)
+	key := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%x\x00%s", originalPath, contentHash, rulesFingerprint)))
+
+	prefix = fmt.Sprintf("%x_", pathHash[:8])
+	return prefix, fmt.Sprintf("%s%x_%s", prefix, key[:8], filepath.Base(originalPath))
+}
+
+// cachedEntry returns the path of an existing cache entry if it is a regular file
+func cachedEntry(dir, name string) (string, bool) {
+	path := filepath.Join(dir, name)
+	info, err := os.Lstat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return "", false
+	}
+	return path, true
+}
+
+// removeStaleEntries deletes older versions of a file's cache entry, i.e. those
+// sharing its path prefix but produced from other content or other rules.
+func removeStaleEntries(dir, prefix, keep string) {
+	matches, err := filepath.Glob(filepath.Join(dir, prefix+"*"))
+	if err != nil {
+		return
+	}
+	for _, match := range matches {
+		if filepath.Base(match) != keep {
+			os.Remove(match)
+		}
+	}
+}
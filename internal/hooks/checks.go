@@ -0,0 +1,116 @@
+package hooks
+
+import (
+	"fmt"
+
+	"github.com/wissem/cc-filter/internal/rules"
+)
+
+// The checks below decide on a tool call independently of the agent that
+// makes it; each processor renders their outcome in its agent's schema.
+
+// checkRead decides on reading path. A non-allow verdict refuses the read;
+// otherwise a non-empty redactedPath is a redacted copy to read instead.
+func (c *ClaudeHookProcessor) checkRead(ctx hookContext, tool, path string) (verdict rules.Verdict, redactedPath string) {
+	// Allow reads from this session's redacted cache directory. The resolved
+	// path is used so a symlink planted in the cache cannot point elsewhere.
+	if isWithinDir(canonicalPath(ctx.Cwd, path), canonicalPath("", c.sessionCacheDir(ctx.SessionID))) {
+		return rules.Verdict{Action: rules.ActionAllow}, ""
+	}
+
+	// Check if file should be completely blocked (e.g., .env files)
+	if verdict, _ := c.evaluatePath(ctx, tool, path); verdict.Action != rules.ActionAllow {
+		return verdict, ""
+	}
+
+	// Check if file should be redacted (code files that might contain secrets)
+	if c.shouldRedactFile(path) {
+		if redactedPath, wasRedacted, err := c.createRedactedFile(ctx, path); err == nil && wasRedacted {
+			return rules.Verdict{Action: rules.ActionAllow}, redactedPath
+		}
+	}
+	return rules.Verdict{Action: rules.ActionAllow}, ""
+}
+
+// checkCommand decides on running a shell command
+func (c *ClaudeHookProcessor) checkCommand(command string) (verdict rules.Verdict, selfOverride bool) {
+	// turn away plain attempts at cc-filter's own state early; the terminal
+	// confirmation is what keeps the agent from approving its own overrides
+	if overrideCommandPattern.MatchString(shellQuotes.Replace(command)) {
+		return rules.Verdict{Action: rules.ActionDeny, Reason: "Overrides can only be granted by the user from their own terminal"}, true
+	}
+	return c.rules.EvaluateCommand(command), false
+}
+
+// checkWrite decides on creating or editing path. Only cc-filter's own
+// directory is off limits; file_blocks guard what the agent reads.
+func (c *ClaudeHookProcessor) checkWrite(ctx hookContext, path string) rules.Verdict {
+	return stateDirVerdict(ctx.Cwd, path)
+}
+
+// checkSearch checks the search pattern and everything that selects which
+// files are searched: path, glob and type. Content searches are also
+// checked file by file, since their results are in the agent's context
+// before any later hook sees them.
+func (c *ClaudeHookProcessor) checkSearch(ctx hookContext, tool, pattern, path, glob, fileType string, content bool) rules.Verdict {
+	verdict := c.rules.EvaluateSearch(pattern)
+	if path != "" {
+		pathVerdict, _ := c.evaluatePath(ctx, tool, path)
+		verdict = verdict.Stricter(pathVerdict)
+	}
+
+	var globs []string
+	if glob != "" {
+		globs = append(globs, glob)
+	}
+	if fileType != "" {
+		globs = append(globs, searchTypeGlob(fileType))
+	}
+	for _, g := range globs {
+		verdict = verdict.Stricter(c.evaluateGlob(g))
+	}
+
+	if verdict.Action == rules.ActionAllow && content {
+		if root := resolveSearchPath(ctx, path); root != "" {
+			verdict = c.evaluateFileSet(root, globs)
+		}
+	}
+	return verdict
+}
+
+// checkGlob decides on listing the files matching pattern under path
+func (c *ClaudeHookProcessor) checkGlob(ctx hookContext, tool, pattern, path string) rules.Verdict {
+	verdict := stateDirVerdict(ctx.Cwd, globBase(pattern)).Stricter(c.evaluateGlob(pattern))
+	if path != "" {
+		pathVerdict, _ := c.evaluatePath(ctx, tool, path)
+		verdict = verdict.Stricter(pathVerdict)
+	}
+	return verdict
+}
+
+// resolve records a non-allow verdict and returns the action to take with
+// the reason to give. A denial the user lifted with a one-time override
+// becomes an allow; otherwise, when allow_overrides is enabled, the reason
+// tells the agent how the user can lift it. Locked verdicts are final.
+func (c *ClaudeHookProcessor) resolve(ctx hookContext, tool, target string, verdict rules.Verdict) (rules.Action, string) {
+	if verdict.Action == rules.ActionAsk {
+		c.decide(DecisionAsk, verdict.Rule)
+		return rules.ActionAsk, verdict.Reason
+	}
+
+	c.decide(DecisionDeny, verdict.Rule)
+	if verdict.Locked || !c.rules.OverridesAllowed() {
+		return rules.ActionDeny, verdict.Reason
+	}
+
+	token := overrideToken(ctx.SessionID, tool, target)
+	if consumeOverride(token) {
+		c.decide(DecisionOverride)
+		c.logger.Printf("Override %s used: session=%s tool=%s rule=%q target=%q", token, ctx.SessionID, tool, verdict.Rule, target)
+		return rules.ActionAllow, ""
+	}
+
+	return rules.ActionDeny, fmt.Sprintf(
+		"%s\n\nIf this access is intended, ask the user to allow it once by running:\n\n    cc-filter override %s",
+		verdict.Reason, token)
+}
@@ -8,23 +8,60 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"strings"
 
-	"cc-filter/internal/rules"
+	"github.com/wissem/cc-filter/internal/rules"
 )
 
-const redactCacheDir = "/tmp/claude/redacted"
+// overrideCommandPattern matches shell commands that plainly run cc-filter
+// override or touch cc-filter's own directory, with quotes and escapes
+// removed. It only catches the obvious spellings: a variable or a glob gets
+// past it. Overrides are protected by the code confirmOverride reads from
+// /dev/tty and by the signature on each grant, not by this check.
+var overrideCommandPattern = regexp.MustCompile(`(?i)cc-filter\S*\s+override|\.cc-filter`)
+
+// shellQuotes strips the quoting a command could hide a path behind
+var shellQuotes = strings.NewReplacer(`'`, "", `"`, "", `\`, "")
 
 type ClaudeHookProcessor struct {
-	rules *rules.Rules
+	rules    *rules.Rules
+	cacheDir string
+	logger   *log.Logger
+	record   *Record // set by forCall
+}
+
+// hookContext carries the session-level fields of a hook payload into the tool handlers
+type hookContext struct {
+	SessionID string
+	Cwd       string
 }
 
 func NewClaudeHookProcessor(rules *rules.Rules) *ClaudeHookProcessor {
 	return &ClaudeHookProcessor{
-		rules: rules,
+		rules:    rules,
+		cacheDir: DefaultCacheDir(),
+		logger:   log.Default(),
+	}
+}
+
+// SetLogger sends the processor's log lines to logger; nil keeps log.Default()
+func (c *ClaudeHookProcessor) SetLogger(logger *log.Logger) {
+	if logger != nil {
+		c.logger = logger
 	}
 }
 
+func newHookContext(input map[string]interface{}) hookContext {
+	sessionID, _ := input["session_id"].(string)
+	cwd, _ := input["cwd"].(string)
+	return hookContext{SessionID: sessionID, Cwd: cwd}
+}
+
+func (c *ClaudeHookProcessor) Name() string {
+	return AgentClaudeCode
+}
+
 func (c *ClaudeHookProcessor) CanHandle(input map[string]interface{}) bool {
 	hookEvent, exists := input["hook_event_name"]
 	if !exists {
@@ -32,7 +69,7 @@ func (c *ClaudeHookProcessor) CanHandle(input map[string]interface{}) bool {
 	}
 
 	switch hookEvent.(string) {
-	case "PreToolUse", "UserPromptSubmit", "SessionEnd":
+	case "PreToolUse", "PostToolUse", "UserPromptSubmit", "SessionEnd":
 		return true
 	default:
 		return false
@@ -40,11 +77,25 @@ func (c *ClaudeHookProcessor) CanHandle(input map[string]interface{}) bool {
 }
 
 func (c *ClaudeHookProcessor) Process(input map[string]interface{}) (string, error) {
+	output, _, err := c.ProcessRecorded(input)
+	return output, err
+}
+
+// ProcessRecorded processes a hook and describes the decision it made
+func (c *ClaudeHookProcessor) ProcessRecorded(input map[string]interface{}) (string, Record, error) {
+	call := c.forCall()
+	output, err := call.process(input)
+	return output, *call.record, err
+}
+
+func (c *ClaudeHookProcessor) process(input map[string]interface{}) (string, error) {
 	hookEvent := input["hook_event_name"].(string)
 
 	switch hookEvent {
 	case "PreToolUse":
 		return c.processPreToolUse(input)
+	case "PostToolUse":
+		return c.processPostToolUse(input)
 	case "UserPromptSubmit":
 		return c.processUserPromptSubmit(input)
 	case "SessionEnd":
@@ -61,118 +112,230 @@ func (c *ClaudeHookProcessor) processPreToolUse(input map[string]interface{}) (s
 	toolName, _ := input["tool_name"].(string)
 	toolInput, _ := input["tool_input"].(map[string]interface{})
 
+	ctx := newHookContext(input)
+
 	switch toolName {
 	case "Read":
-		return c.handleReadTool(toolInput)
+		return c.handleReadTool(ctx, toolInput)
 	case "Bash":
-		return c.handleBashTool(toolInput)
+		return c.handleBashTool(ctx, toolInput)
 	case "Grep", "Search":
-		return c.handleGrepTool(toolInput)
+		return c.handleGrepTool(ctx, toolInput)
 	case "Glob":
-		return c.handleGlobTool(toolInput)
+		return c.handleGlobTool(ctx, toolInput)
+	case "Write", "Edit", "MultiEdit", "NotebookEdit":
+		return c.handleWriteTool(ctx, toolName, toolInput)
 	default:
 		return c.allowTool()
 	}
 }
 
-func (c *ClaudeHookProcessor) handleReadTool(toolInput map[string]interface{}) (string, error) {
+func (c *ClaudeHookProcessor) handleReadTool(ctx hookContext, toolInput map[string]interface{}) (string, error) {
 	filePath, _ := toolInput["file_path"].(string)
+	c.target(filePath)
 
-	// Allow reads from redacted cache directory
-	if strings.HasPrefix(filePath, redactCacheDir) {
-		return c.allowTool()
-	}
-
-	// Check if file should be completely blocked (e.g., .env files)
-	if shouldBlock, reason := c.rules.ShouldBlockFile(filePath); shouldBlock {
-		return c.denyTool(reason)
+	verdict, redactedPath := c.checkRead(ctx, "Read", filePath)
+	if verdict.Action != rules.ActionAllow {
+		return c.respond(ctx, "Read", filePath, verdict)
 	}
-
-	// Check if file should be redacted (code files that might contain secrets)
-	if c.shouldRedactFile(filePath) {
-		redactedPath, wasRedacted, err := c.createRedactedFile(filePath)
-		if err == nil && wasRedacted {
-			// NOTE: updatedInput does NOT work for Read tool file_path (tested Jan 2026)
-			// Falling back to deny+redirect which tells Claude to read the redacted file
-			return c.denyWithRedirect(filePath, redactedPath)
-		}
+	if redactedPath != "" {
+		// NOTE: updatedInput does NOT work for Read tool file_path (tested Jan 2026)
+		// Falling back to deny+redirect which tells Claude to read the redacted file
+		return c.denyWithRedirect(filePath, redactedPath, readRangeFrom(toolInput))
 	}
 
 	return c.allowTool()
 }
 
-func (c *ClaudeHookProcessor) handleBashTool(toolInput map[string]interface{}) (string, error) {
+func (c *ClaudeHookProcessor) handleBashTool(ctx hookContext, toolInput map[string]interface{}) (string, error) {
 	command, _ := toolInput["command"].(string)
-	if shouldBlock, reason := c.rules.ShouldBlockCommand(command); shouldBlock {
-		return c.denyTool(reason)
+
+	verdict, selfOverride := c.checkCommand(command)
+	if selfOverride {
+		c.decide(DecisionDeny)
+		return c.denyTool(verdict.Reason)
+	}
+	if verdict.Action != rules.ActionAllow {
+		return c.respond(ctx, "Bash", command, verdict)
 	}
 	return c.allowTool()
 }
 
-func (c *ClaudeHookProcessor) handleGrepTool(toolInput map[string]interface{}) (string, error) {
+// handleWriteTool keeps file edits out of cc-filter's own directory
+func (c *ClaudeHookProcessor) handleWriteTool(ctx hookContext, toolName string, toolInput map[string]interface{}) (string, error) {
+	filePath := firstString(toolInput, "file_path", "notebook_path")
+	c.target(filePath)
+
+	if verdict := c.checkWrite(ctx, filePath); verdict.Action != rules.ActionAllow {
+		return c.respond(ctx, toolName, filePath, verdict)
+	}
+	return c.allowTool()
+}
+
+func (c *ClaudeHookProcessor) handleGrepTool(ctx hookContext, toolInput map[string]interface{}) (string, error) {
 	pattern, _ := toolInput["pattern"].(string)
-	if shouldBlock, reason := c.rules.ShouldBlockSearch(pattern); shouldBlock {
-		return c.denyTool(reason)
+	path, _ := toolInput["path"].(string)
+	glob, _ := toolInput["glob"].(string)
+	fileType, _ := toolInput["type"].(string)
+	outputMode, _ := toolInput["output_mode"].(string)
+	c.target(path)
+
+	if verdict := c.checkSearch(ctx, "Grep", pattern, path, glob, fileType, outputMode == "content"); verdict.Action != rules.ActionAllow {
+		return c.respond(ctx, "Grep", pattern+"\x00"+path+"\x00"+glob+"\x00"+fileType, verdict)
 	}
 	return c.allowTool()
 }
 
-func (c *ClaudeHookProcessor) handleGlobTool(toolInput map[string]interface{}) (string, error) {
+func (c *ClaudeHookProcessor) handleGlobTool(ctx hookContext, toolInput map[string]interface{}) (string, error) {
 	pattern, _ := toolInput["pattern"].(string)
-	for _, blockedPattern := range c.rules.FileBlocks {
-		if containsAnywhere(pattern, blockedPattern) {
-			return c.denyTool("Pattern may expose sensitive files: " + pattern)
-		}
+	path, _ := toolInput["path"].(string)
+	c.target(path)
+
+	if verdict := c.checkGlob(ctx, "Glob", pattern, path); verdict.Action != rules.ActionAllow {
+		return c.respond(ctx, "Glob", pattern+"\x00"+path, verdict)
 	}
 	return c.allowTool()
 }
 
-func (c *ClaudeHookProcessor) processUserPromptSubmit(input map[string]interface{}) (string, error) {
-	prompt, _ := input["prompt"].(string)
-	result := c.rules.FilterContent(prompt)
+// processPostToolUse flags secrets in search results. Claude Code cannot
+// replace a built-in tool's output, which is already in Claude's context by
+// now; a blocking decision can only tell it to disregard that output and
+// hand it a redacted copy. The checks before the search keep files out.
+func (c *ClaudeHookProcessor) processPostToolUse(input map[string]interface{}) (string, error) {
+	toolName, _ := input["tool_name"].(string)
+	if toolName != "Grep" && toolName != "Search" {
+		return c.allowTool()
+	}
 
-	// If content was filtered, block and show improved UX
-	if result.Filtered {
-		// Build detected patterns list
-		var patternsDisplay string
-		for _, name := range result.MatchedPatterns {
-			patternsDisplay += fmt.Sprintf("  • %s\n", name)
-		}
+	content := toolResponseText(input["tool_response"])
+	result := c.rules.FilterContent(content)
+	if !result.Filtered {
+		return c.allowTool()
+	}
+	c.decide(DecisionRedact, result.MatchedPatterns...)
+	c.redacted(result.RedactedBytes)
 
-		// Copy redacted content to clipboard
-		clipboardStatus := "✓ Copied to clipboard - paste to continue"
-		if err := copyToClipboard(result.Content); err != nil {
-			clipboardStatus = "⚠ Could not copy to clipboard (pbcopy not available)"
-		}
+	response := map[string]interface{}{
+		"decision": "block",
+		"reason":   redactedResultsReason(result),
+	}
+	jsonBytes, _ := json.Marshal(response)
+	return string(jsonBytes), nil
+}
+
+// redactedResultsReason hands the agent redacted search results in place of
+// the ones it was given
+func redactedResultsReason(result rules.FilterResult) string {
+	return fmt.Sprintf(
+		"SECRETS DETECTED - Search results contained sensitive data (%s). "+
+			"Disregard the previous output and use these redacted results instead:\n\n%s",
+		strings.Join(result.MatchedPatterns, ", "), result.Content)
+}
 
-		// Also save to file as backup
-		c.createRedactedUserInput(prompt, result.Content)
+// toolResponseText extracts the textual part of a tool_response, which is
+// either a plain string or an object with a "content" field, or
+// "llmContent" for Gemini CLI
+func toolResponseText(response interface{}) string {
+	switch value := response.(type) {
+	case string:
+		return value
+	case map[string]interface{}:
+		if content, ok := value["content"].(string); ok {
+			return content
+		}
+		if content, ok := value["llmContent"].(string); ok {
+			return content
+		}
+	}
+	return ""
+}
 
-		// Build formatted error message
-		separator := "────────────────────────────────────────"
-		errorMsg := fmt.Sprintf(
-			"⛔ BLOCKED: Sensitive content detected\n\n"+
-				"Detected patterns:\n%s\n"+
-				"Your message (redacted):\n%s\n%s\n%s\n\n%s",
-			patternsDisplay,
-			separator,
-			result.Content,
-			separator,
-			clipboardStatus)
+// respond turns a non-allow verdict into a hook response. Denials can be
+// lifted once by the user when allow_overrides is enabled.
+func (c *ClaudeHookProcessor) respond(ctx hookContext, tool, target string, verdict rules.Verdict) (string, error) {
+	switch action, reason := c.resolve(ctx, tool, target, verdict); action {
+	case rules.ActionAllow:
+		return c.allowTool()
+	case rules.ActionAsk:
+		return c.askTool(reason)
+	default:
+		return c.denyTool(reason)
+	}
+}
 
-		return "", fmt.Errorf(errorMsg)
+func (c *ClaudeHookProcessor) processUserPromptSubmit(input map[string]interface{}) (string, error) {
+	prompt, _ := input["prompt"].(string)
+	if message, blocked := c.checkPrompt(newHookContext(input), prompt); blocked {
+		return "", fmt.Errorf("%s", message)
 	}
 
 	// No sensitive content - pass through unchanged
 	return "{}", nil
 }
 
+// checkPrompt blocks a prompt containing secrets. The message shows the
+// user their prompt redacted, which is also copied to the clipboard and
+// saved in the session cache so they can send it instead.
+func (c *ClaudeHookProcessor) checkPrompt(ctx hookContext, prompt string) (message string, blocked bool) {
+	result := c.rules.FilterContent(prompt)
+	if !result.Filtered {
+		return "", false
+	}
+	c.decide(DecisionBlock, result.MatchedPatterns...)
+
+	// Build detected patterns list
+	var patternsDisplay string
+	for _, name := range result.MatchedPatterns {
+		patternsDisplay += fmt.Sprintf("  • %s\n", name)
+	}
+
+	// Copy redacted content to clipboard
+	clipboardStatus := "✓ Copied to clipboard - paste to continue"
+	if err := copyToClipboard(result.Content); err != nil {
+		clipboardStatus = "⚠ Could not copy to clipboard (pbcopy not available)"
+	}
+
+	// Also save to file as backup
+	c.createRedactedUserInput(ctx, prompt, result.Content)
+
+	separator := "────────────────────────────────────────"
+	return fmt.Sprintf(
+		"⛔ BLOCKED: Sensitive content detected\n\n"+
+			"Detected patterns:\n%s\n"+
+			"Your message (redacted):\n%s\n%s\n%s\n\n%s",
+		patternsDisplay,
+		separator,
+		result.Content,
+		separator,
+		clipboardStatus), true
+}
+
+// Veto answers a hook with a plugin's stricter decision
+func (c *ClaudeHookProcessor) Veto(input map[string]interface{}, action rules.Action, reason string) (string, string, error) {
+	switch input["hook_event_name"].(string) {
+	case "PreToolUse":
+		if action == rules.ActionAsk {
+			output, err := c.askTool(reason)
+			return output, DecisionAsk, err
+		}
+		output, err := c.denyTool(reason)
+		return output, DecisionDeny, err
+	case "PostToolUse":
+		jsonBytes, _ := json.Marshal(map[string]interface{}{"decision": "block", "reason": reason})
+		return string(jsonBytes), DecisionDeny, nil
+	case "UserPromptSubmit":
+		return "", DecisionBlock, fmt.Errorf("⛔ BLOCKED: %s", reason)
+	default:
+		return "", "", nil
+	}
+}
+
 // processSessionEnd handles cleanup when Claude Code session ends
 func (c *ClaudeHookProcessor) processSessionEnd(input map[string]interface{}) (string, error) {
-	// Remove the entire redacted cache directory
-	if err := os.RemoveAll(redactCacheDir); err != nil {
+	// Remove only this session's cache; other sessions may still be running
+	if err := os.RemoveAll(c.sessionCacheDir(newHookContext(input).SessionID)); err != nil {
 		// Log but don't fail - cleanup is best effort
-		log.Printf("SessionEnd cleanup warning: %v", err)
+		c.logger.Printf("SessionEnd cleanup warning: %v", err)
 	}
 
 	// SessionEnd has no hookSpecificOutput schema - return empty JSON
@@ -184,74 +347,119 @@ func (c *ClaudeHookProcessor) shouldRedactFile(path string) bool {
 	return c.rules.ShouldRedactFile(path)
 }
 
-// createRedactedFile reads a file, applies redaction, and writes to cache
-func (c *ClaudeHookProcessor) createRedactedFile(originalPath string) (string, bool, error) {
+// createRedactedFile reads a file, applies redaction, and writes to cache.
+// Entries are content-addressed: an unchanged file under unchanged rules reuses
+// the existing copy, while any edit or rule change produces a new entry.
+func (c *ClaudeHookProcessor) createRedactedFile(ctx hookContext, originalPath string) (string, bool, error) {
 	content, err := os.ReadFile(originalPath)
 	if err != nil {
 		return "", false, err
 	}
 
+	cacheDir, err := c.ensureSessionCacheDir(ctx.SessionID)
+	if err != nil {
+		return "", false, err
+	}
+
+	prefix, cacheName := redactedCacheName(originalPath, content, c.rules.Fingerprint())
+	if cachePath, ok := cachedEntry(cacheDir, cacheName); ok {
+		return cachePath, true, nil
+	}
+
 	filtered := c.rules.FilterContent(string(content))
 	if !filtered.Filtered {
+		removeStaleEntries(cacheDir, prefix, "")
 		return "", false, nil
 	}
+	c.decide(DecisionRedact, filtered.MatchedPatterns...)
+	c.redacted(filtered.RedactedBytes)
 
-	if err := os.MkdirAll(redactCacheDir, 0755); err != nil {
+	cachePath, err := writePrivateFile(cacheDir, cacheName, []byte(filtered.Content+redactedTrailer(filtered.Content, originalPath)))
+	if err != nil {
 		return "", false, err
 	}
+	removeStaleEntries(cacheDir, prefix, cacheName)
 
-	hash := sha256.Sum256([]byte(originalPath))
-	cacheName := fmt.Sprintf("%x_%s", hash[:8], filepath.Base(originalPath))
-	cachePath := filepath.Join(redactCacheDir, cacheName)
+	return cachePath, true, nil
+}
 
-	header := fmt.Sprintf("# ***FILTERED*** REDACTED VERSION - Some sensitive values have been masked\n# Original: %s\n\n", originalPath)
-	if err := os.WriteFile(cachePath, []byte(header+filtered.Content), 0644); err != nil {
-		return "", false, err
+// redactedTrailer marks a redacted copy. It goes after the content rather than
+// before it so line N of the copy is line N of the original.
+func redactedTrailer(content, originalPath string) string {
+	separator := "\n"
+	if content == "" || strings.HasSuffix(content, "\n") {
+		separator = ""
 	}
+	return fmt.Sprintf("%s\n# ***FILTERED*** REDACTED VERSION - Some sensitive values have been masked\n# Original: %s\n", separator, originalPath)
+}
 
-	return cachePath, true, nil
+// readRange is the offset/limit pair of a Read tool call; zero means unset
+type readRange struct {
+	Offset int
+	Limit  int
+}
+
+func readRangeFrom(toolInput map[string]interface{}) readRange {
+	offset, _ := toolInput["offset"].(float64)
+	limit, _ := toolInput["limit"].(float64)
+	return readRange{Offset: int(offset), Limit: int(limit)}
+}
+
+// describe renders the range as the Read arguments to repeat, or "" when unset
+func (r readRange) describe() string {
+	var parts []string
+	if r.Offset > 0 {
+		parts = append(parts, fmt.Sprintf("offset: %d", r.Offset))
+	}
+	if r.Limit > 0 {
+		parts = append(parts, fmt.Sprintf("limit: %d", r.Limit))
+	}
+	return strings.Join(parts, ", ")
 }
 
 // createRedactedUserInput creates a temp file with redacted user input content
-func (c *ClaudeHookProcessor) createRedactedUserInput(content string, filteredContent string) (string, error) {
+func (c *ClaudeHookProcessor) createRedactedUserInput(ctx hookContext, content string, filteredContent string) (string, error) {
 	// Ensure cache directory exists
-	if err := os.MkdirAll(redactCacheDir, 0755); err != nil {
+	cacheDir, err := c.ensureSessionCacheDir(ctx.SessionID)
+	if err != nil {
 		return "", err
 	}
 
 	// Generate unique filename using content hash
 	hash := sha256.Sum256([]byte(content))
 	cacheName := fmt.Sprintf("user_input_%x.txt", hash[:8])
-	cachePath := filepath.Join(redactCacheDir, cacheName)
 
 	// Write redacted content with header
 	header := "# REDACTED USER INPUT - Sensitive values have been masked\n\n"
-	if err := os.WriteFile(cachePath, []byte(header+filteredContent), 0644); err != nil {
-		return "", err
-	}
-
-	return cachePath, nil
+	return writePrivateFile(cacheDir, cacheName, []byte(header+filteredContent))
 }
 
 // denyWithRedirect blocks the original read and tells Claude to read the redacted version
 // DEPRECATED: Use allowWithRedirect for seamless filtering via updatedInput
-func (c *ClaudeHookProcessor) denyWithRedirect(originalPath, redactedPath string) (string, error) {
+func (c *ClaudeHookProcessor) denyWithRedirect(originalPath, redactedPath string, lines readRange) (string, error) {
+	c.decide(DecisionRedact)
 	response := map[string]interface{}{
 		"hookSpecificOutput": map[string]interface{}{
-			"hookEventName":      "PreToolUse",
-			"permissionDecision": "deny",
-			"permissionDecisionReason": fmt.Sprintf(
-				"SECRETS DETECTED - File contains sensitive data.\n\n"+
-					"Original: %s\n\n"+
-					"A redacted version has been created. Please read this file instead:\n\n"+
-					"    %s",
-				originalPath, redactedPath),
+			"hookEventName":            "PreToolUse",
+			"permissionDecision":       "deny",
+			"permissionDecisionReason": redirectReason(originalPath, redactedPath, lines),
 		},
 	}
 	jsonBytes, _ := json.Marshal(response)
 	return string(jsonBytes), nil
 }
 
+// redirectReason tells the agent to read the redacted copy of a file instead
+func redirectReason(originalPath, redactedPath string, lines readRange) string {
+	instruction := "A redacted version has been created. Please read this file instead:\n\n" +
+		"    " + redactedPath + "\n\n" +
+		"Line numbers in the redacted version match the original."
+	if args := lines.describe(); args != "" {
+		instruction += " Repeat the same range when reading it (" + args + ")."
+	}
+	return fmt.Sprintf("SECRETS DETECTED - File contains sensitive data.\n\nOriginal: %s\n\n%s", originalPath, instruction)
+}
+
 // allowWithRedirect silently redirects the Read tool to the redacted file
 // This uses updatedInput to seamlessly filter content without Claude knowing
 func (c *ClaudeHookProcessor) allowWithRedirect(redactedPath string) (string, error) {
@@ -272,6 +480,19 @@ func (c *ClaudeHookProcessor) allowTool() (string, error) {
 	return "", nil
 }
 
+// askTool returns a JSON response that asks the user to confirm the tool use
+func (c *ClaudeHookProcessor) askTool(reason string) (string, error) {
+	response := map[string]interface{}{
+		"hookSpecificOutput": map[string]interface{}{
+			"hookEventName":            "PreToolUse",
+			"permissionDecision":       "ask",
+			"permissionDecisionReason": reason,
+		},
+	}
+	jsonBytes, _ := json.Marshal(response)
+	return string(jsonBytes), nil
+}
+
 // denyTool returns a JSON response that blocks the tool use
 func (c *ClaudeHookProcessor) denyTool(reason string) (string, error) {
 	response := map[string]interface{}{
@@ -292,11 +513,11 @@ func copyToClipboard(text string) error {
 	return cmd.Run()
 }
 
-func containsAnywhere(s, substr string) bool {
-	for i := 0; i <= len(s)-len(substr); i++ {
-		if s[i:i+len(substr)] == substr {
-			return true
-		}
+// isWithinDir reports whether path lies strictly inside dir
+func isWithinDir(path, dir string) bool {
+	rel, err := filepath.Rel(dir, filepath.Clean(path))
+	if err != nil {
+		return false
 	}
-	return false
-}
\ No newline at end of file
+	return rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -2,12 +2,13 @@ package hooks
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
 
-	"cc-filter/internal/rules"
+	"github.com/wissem/cc-filter/internal/rules"
 )
 
 func testDefaultRules() []byte {
@@ -22,7 +23,7 @@ func TestAllowWithRedirect(t *testing.T) {
 	r, _ := rules.LoadRules(testDefaultRules())
 	processor := NewClaudeHookProcessor(r)
 
-	redactedPath := "/tmp/claude/redacted/abc123_config.swift"
+	redactedPath := filepath.Join(DefaultCacheDir(), "session-1", "abc123_config.swift")
 	result, err := processor.allowWithRedirect(redactedPath)
 
 	if err != nil {
@@ -104,9 +105,21 @@ func TestDenyTool(t *testing.T) {
 	}
 }
 
+// neutralTempDir is a temporary directory whose path, unlike t.TempDir's,
+// does not carry the test's name, which may itself match file_blocks
+func neutralTempDir(t *testing.T) string {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "ccf-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
 func TestHandleReadToolWithSecrets(t *testing.T) {
 	// Create a temp file with secrets
-	tmpDir := t.TempDir()
+	tmpDir := neutralTempDir(t)
 	testFile := filepath.Join(tmpDir, "config.swift")
 	content := `let apiKey = "sk-1234567890abcdefghijklmnopqrstuvwxyz123456789012"`
 	os.WriteFile(testFile, []byte(content), 0644)
@@ -114,12 +127,13 @@ func TestHandleReadToolWithSecrets(t *testing.T) {
 	r, _ := rules.LoadRules(testDefaultRules())
 	r.RedactFiles.Extensions = append(r.RedactFiles.Extensions, ".swift")
 	processor := NewClaudeHookProcessor(r)
+	processor.cacheDir = filepath.Join(t.TempDir(), "cache")
 
 	toolInput := map[string]interface{}{
 		"file_path": testFile,
 	}
 
-	result, err := processor.handleReadTool(toolInput)
+	result, err := processor.handleReadTool(hookContext{SessionID: "session-1"}, toolInput)
 
 	if err != nil {
 		t.Fatalf("handleReadTool returned error: %v", err)
@@ -138,26 +152,28 @@ func TestHandleReadToolWithSecrets(t *testing.T) {
 	}
 
 	reason := hookOutput["permissionDecisionReason"].(string)
-	if !strings.Contains(reason, "/tmp/claude/redacted/") {
-		t.Errorf("Deny reason should contain redirect path, got %v", reason)
+	sessionDir := filepath.Join(processor.cacheDir, "session-1")
+	if !strings.Contains(reason, sessionDir+string(filepath.Separator)) {
+		t.Errorf("Deny reason should contain redirect path under %s, got %v", sessionDir, reason)
 	}
 }
 
 func TestHandleReadToolWithoutSecrets(t *testing.T) {
 	// Create a temp file without secrets
-	tmpDir := t.TempDir()
+	tmpDir := neutralTempDir(t)
 	testFile := filepath.Join(tmpDir, "clean.swift")
 	content := `let greeting = "Hello, World!"`
 	os.WriteFile(testFile, []byte(content), 0644)
 
 	r, _ := rules.LoadRules(testDefaultRules())
 	processor := NewClaudeHookProcessor(r)
+	processor.cacheDir = filepath.Join(t.TempDir(), "cache")
 
 	toolInput := map[string]interface{}{
 		"file_path": testFile,
 	}
 
-	result, err := processor.handleReadTool(toolInput)
+	result, err := processor.handleReadTool(hookContext{SessionID: "session-1"}, toolInput)
 
 	if err != nil {
 		t.Fatalf("handleReadTool returned error: %v", err)
@@ -177,12 +193,13 @@ func TestHandleReadToolBlockedFile(t *testing.T) {
 
 	r, _ := rules.LoadRules(testDefaultRules())
 	processor := NewClaudeHookProcessor(r)
+	processor.cacheDir = filepath.Join(t.TempDir(), "cache")
 
 	toolInput := map[string]interface{}{
 		"file_path": testFile,
 	}
 
-	result, err := processor.handleReadTool(toolInput)
+	result, err := processor.handleReadTool(hookContext{SessionID: "session-1"}, toolInput)
 
 	if err != nil {
 		t.Fatalf("handleReadTool returned error: %v", err)
@@ -205,3 +222,548 @@ func TestHandleReadToolBlockedFile(t *testing.T) {
 		t.Error("Blocked .env file should not have updatedInput")
 	}
 }
+
+func TestRedactedCacheIsPrivatePerSession(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "config.swift")
+	content := `let apiKey = "sk-1234567890abcdefghijklmnopqrstuvwxyz123456789012"`
+	os.WriteFile(testFile, []byte(content), 0644)
+
+	r, _ := rules.LoadRules(testDefaultRules())
+	processor := NewClaudeHookProcessor(r)
+	processor.cacheDir = filepath.Join(tmpDir, "cache")
+
+	pathA, _, err := processor.createRedactedFile(hookContext{SessionID: "session-a"}, testFile)
+	if err != nil {
+		t.Fatalf("createRedactedFile returned error: %v", err)
+	}
+	pathB, _, err := processor.createRedactedFile(hookContext{SessionID: "session-b"}, testFile)
+	if err != nil {
+		t.Fatalf("createRedactedFile returned error: %v", err)
+	}
+
+	for _, dir := range []string{processor.cacheDir, filepath.Dir(pathA)} {
+		info, err := os.Stat(dir)
+		if err != nil {
+			t.Fatalf("stat %s: %v", dir, err)
+		}
+		if perm := info.Mode().Perm(); perm != 0700 {
+			t.Errorf("%s permissions = %o, want 700", dir, perm)
+		}
+	}
+	info, err := os.Stat(pathA)
+	if err != nil {
+		t.Fatalf("stat %s: %v", pathA, err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("redacted file permissions = %o, want 600", perm)
+	}
+
+	// Ending session A must leave session B's cache in place
+	processor.processSessionEnd(map[string]interface{}{
+		"hook_event_name": "SessionEnd",
+		"session_id":      "session-a",
+	})
+	if _, err := os.Stat(pathA); !os.IsNotExist(err) {
+		t.Errorf("session-a cache should be removed, stat err = %v", err)
+	}
+	if _, err := os.Stat(pathB); err != nil {
+		t.Errorf("session-b cache should survive, stat err = %v", err)
+	}
+}
+
+func TestRedactedCacheRefusesSymlinkedSessionDir(t *testing.T) {
+	tmpDir := t.TempDir()
+	r, _ := rules.LoadRules(testDefaultRules())
+	processor := NewClaudeHookProcessor(r)
+	processor.cacheDir = filepath.Join(tmpDir, "cache")
+	os.MkdirAll(processor.cacheDir, 0700)
+
+	target := filepath.Join(tmpDir, "elsewhere")
+	os.MkdirAll(target, 0755)
+	if err := os.Symlink(target, filepath.Join(processor.cacheDir, "session-1")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	if _, err := processor.ensureSessionCacheDir("session-1"); err == nil {
+		t.Error("ensureSessionCacheDir should refuse a symlinked session directory")
+	}
+}
+
+func TestSessionKeyStaysInsideCache(t *testing.T) {
+	for _, id := range []string{"../../etc", "a/b", ".."} {
+		if key := sessionKey(id); strings.ContainsAny(key, "./\\") {
+			t.Errorf("sessionKey(%q) = %q, should be a plain path component", id, key)
+		}
+	}
+}
+
+func TestRedactedFileCacheReuseAndInvalidation(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "config.swift")
+	os.WriteFile(testFile, []byte(`let apiKey = "sk-1234567890abcdefghijklmnopqrstuvwxyz123456789012"`), 0644)
+
+	r, _ := rules.LoadRules(testDefaultRules())
+	processor := NewClaudeHookProcessor(r)
+	processor.cacheDir = filepath.Join(tmpDir, "cache")
+	ctx := hookContext{SessionID: "session-1"}
+
+	first, _, err := processor.createRedactedFile(ctx, testFile)
+	if err != nil {
+		t.Fatalf("createRedactedFile returned error: %v", err)
+	}
+	firstInfo, _ := os.Stat(first)
+
+	second, _, _ := processor.createRedactedFile(ctx, testFile)
+	secondInfo, _ := os.Stat(second)
+	if first != second || !os.SameFile(firstInfo, secondInfo) {
+		t.Errorf("unchanged file should reuse cache entry %s, got %s", first, second)
+	}
+
+	// Editing the file yields a new entry and drops the stale one
+	os.WriteFile(testFile, []byte(`let apiKey = "sk-abcdefghijklmnopqrstuvwxyz1234567890123456789012"`), 0644)
+	edited, _, _ := processor.createRedactedFile(ctx, testFile)
+	if edited == first {
+		t.Error("edited file should produce a new cache entry")
+	}
+	if _, err := os.Stat(first); !os.IsNotExist(err) {
+		t.Errorf("stale cache entry should be removed, stat err = %v", err)
+	}
+
+	// Rotating rules invalidates previously redacted files
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	os.MkdirAll(filepath.Join(home, ".cc-filter"), 0700)
+	os.WriteFile(filepath.Join(home, ".cc-filter", "config.yaml"), []byte(`patterns:
+  - name: "extra"
+    regex: "never-matches-anything"
+    replacement: "x"
+`), 0600)
+	rotated, err := rules.LoadRules(testDefaultRules())
+	if err != nil {
+		t.Fatalf("LoadRules: %v", err)
+	}
+	if rotated.Fingerprint() == r.Fingerprint() {
+		t.Fatal("adding a pattern should change the rules fingerprint")
+	}
+	processor.rules = rotated
+	afterRotation, _, _ := processor.createRedactedFile(ctx, testFile)
+	if afterRotation == edited {
+		t.Error("rule change should invalidate the cached entry")
+	}
+}
+
+func decodeHookOutput(t *testing.T, result string) map[string]interface{} {
+	t.Helper()
+	var response map[string]interface{}
+	if err := json.Unmarshal([]byte(result), &response); err != nil {
+		t.Fatalf("Failed to parse JSON response %q: %v", result, err)
+	}
+	hookOutput, ok := response["hookSpecificOutput"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("hookSpecificOutput not found in %q", result)
+	}
+	return hookOutput
+}
+
+func TestAskActionForFuzzyFileBlock(t *testing.T) {
+	r, _ := rules.LoadRules(testDefaultRules())
+	r.Actions = map[string]rules.Action{"*secret*": rules.ActionAsk}
+	processor := NewClaudeHookProcessor(r)
+	processor.cacheDir = filepath.Join(t.TempDir(), "cache")
+
+	result, _ := processor.handleReadTool(hookContext{}, map[string]interface{}{"file_path": "secret_santa.go"})
+	hookOutput := decodeHookOutput(t, result)
+	if hookOutput["permissionDecision"] != "ask" {
+		t.Errorf("permissionDecision = %v, want ask", hookOutput["permissionDecision"])
+	}
+
+	// A hard block that also matches still wins over ask
+	result, _ = processor.handleReadTool(hookContext{}, map[string]interface{}{"file_path": "secret.pem"})
+	if decision := decodeHookOutput(t, result)["permissionDecision"]; decision != "deny" {
+		t.Errorf("permissionDecision = %v, want deny", decision)
+	}
+}
+
+func TestOverrideTokenAllowsOnce(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	enabled := true
+	r, _ := rules.LoadRules(testDefaultRules())
+	r.AllowOverrides = &enabled
+	processor := NewClaudeHookProcessor(r)
+	ctx := hookContext{SessionID: "session-1"}
+	toolInput := map[string]interface{}{"command": "printenv"}
+
+	result, _ := processor.handleBashTool(ctx, toolInput)
+	reason := decodeHookOutput(t, result)["permissionDecisionReason"].(string)
+	token := overrideToken("session-1", "Bash", "printenv")
+	if !strings.Contains(reason, "cc-filter override "+token) {
+		t.Fatalf("deny reason should offer override token %s, got %q", token, reason)
+	}
+
+	if err := GrantOverride(token); err != nil {
+		t.Fatalf("GrantOverride: %v", err)
+	}
+	if result, _ := processor.handleBashTool(ctx, toolInput); result != "" {
+		t.Errorf("granted override should allow the command, got %q", result)
+	}
+	if result, _ := processor.handleBashTool(ctx, toolInput); result == "" {
+		t.Error("override should only be usable once")
+	}
+}
+
+func TestAgentCannotGrantOverride(t *testing.T) {
+	r, _ := rules.LoadRules(testDefaultRules())
+	processor := NewClaudeHookProcessor(r)
+
+	for _, command := range []string{
+		"cc-filter override ccf-0123456789ab",
+		"/usr/local/bin/cc-filter  override ccf-0123456789ab",
+		"touch ~/.cc-filter/overrides/ccf-0123456789ab",
+		"cd ~/.cc-filter && touch overrides/ccf-0123456789ab",
+		`touch "$HOME"/'.cc-filter'/overrides/ccf-0123456789ab`,
+		`touch ~/.cc-"filter"/over\rides/ccf-0123456789ab`,
+	} {
+		result, _ := processor.handleBashTool(hookContext{}, map[string]interface{}{"command": command})
+		if result == "" || decodeHookOutput(t, result)["permissionDecision"] != "deny" {
+			t.Errorf("command %q should be denied, got %q", command, result)
+		}
+	}
+}
+
+func TestStateDirIsOffLimits(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	enabled := true
+	r, _ := rules.LoadRules(testDefaultRules())
+	r.AllowOverrides = &enabled
+	processor := NewClaudeHookProcessor(r)
+	grant := filepath.Join(home, ".cc-filter", "overrides", "ccf-0123456789ab")
+
+	for _, tc := range []struct {
+		tool  string
+		input map[string]interface{}
+	}{
+		{"Write", map[string]interface{}{"file_path": grant, "content": "x"}},
+		{"Edit", map[string]interface{}{"file_path": "~/.cc-filter/config.yaml"}},
+		{"NotebookEdit", map[string]interface{}{"notebook_path": filepath.Join(home, ".cc-filter", "n.ipynb")}},
+		{"Read", map[string]interface{}{"file_path": filepath.Join(home, ".cc-filter", "override.key")}},
+		{"Glob", map[string]interface{}{"pattern": home + "/.cc-filter/**"}},
+		{"Grep", map[string]interface{}{"pattern": "x", "path": filepath.Join(home, ".cc-filter")}},
+	} {
+		result, _, _ := processor.ProcessRecorded(map[string]interface{}{
+			"session_id": "s1", "hook_event_name": "PreToolUse", "tool_name": tc.tool, "tool_input": tc.input,
+		})
+		output := decodeHookOutput(t, result)
+		if output["permissionDecision"] != "deny" || strings.Contains(output["permissionDecisionReason"].(string), "cc-filter override") {
+			t.Errorf("%s %v: got %q, want a deny no override can lift", tc.tool, tc.input, result)
+		}
+	}
+}
+
+func TestProjectNegationCannotLiftInheritedBlocks(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	project := neutralTempDir(t)
+	os.MkdirAll(filepath.Join(project, ".git"), 0755)
+	os.WriteFile(filepath.Join(project, ".cc-filter.yaml"), []byte(`file_blocks:
+  - "!.env"
+  - "*.dump"
+  - "!keep.dump"
+`), 0644)
+	r, err := rules.Load(testDefaultRules(), rules.LoadOptions{Dir: project})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	processor := NewClaudeHookProcessor(r)
+	processor.cacheDir = t.TempDir()
+
+	for path, want := range map[string]string{".env": "deny", "db.dump": "deny", "keep.dump": ""} {
+		result, _, _ := processor.ProcessRecorded(map[string]interface{}{
+			"session_id": "s1", "hook_event_name": "PreToolUse", "cwd": project,
+			"tool_name": "Read", "tool_input": map[string]interface{}{"file_path": filepath.Join(project, path)},
+		})
+		got := ""
+		if result != "" {
+			got, _ = decodeHookOutput(t, result)["permissionDecision"].(string)
+		}
+		if got != want {
+			t.Errorf("Read %s: got %q, want %q", path, result, want)
+		}
+	}
+}
+
+func TestProjectPatternCannotClaimSecrets(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	project := neutralTempDir(t)
+	os.MkdirAll(filepath.Join(project, ".git"), 0755)
+	os.WriteFile(filepath.Join(project, ".cc-filter.yaml"), []byte(`patterns:
+  - name: everything
+    regex: '(?s).+'
+    replacement: "$0"
+    priority: 1000
+`), 0644)
+	r, err := rules.Load(testDefaultRules(), rules.LoadOptions{Dir: project})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	processor := NewClaudeHookProcessor(r)
+	processor.cacheDir = t.TempDir()
+
+	result, record, err := processor.ProcessRecorded(map[string]interface{}{
+		"session_id": "s1", "hook_event_name": "UserPromptSubmit", "cwd": project,
+		"prompt": "API_KEY=abcdefghij1234567890XYZ\nsk-" + strings.Repeat("a1B2", 12),
+	})
+	if err == nil || record.Decision != DecisionBlock {
+		t.Errorf("a project pattern that keeps its text let the prompt through: %q, %+v", result, record)
+	}
+}
+
+func TestUnsignedGrantIsIgnored(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	token := overrideToken("session-1", "Bash", "printenv")
+	if err := GrantOverride(token); err != nil {
+		t.Fatal(err)
+	}
+	// a grant written by anything but GrantOverride lacks the key's signature
+	dir, _ := overrideDir()
+	if err := os.WriteFile(filepath.Join(dir, token), []byte("2026-01-01T00:00:00Z\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if consumeOverride(token) {
+		t.Error("a grant without a valid signature was honoured")
+	}
+}
+
+func TestSearchTooLargeToExpandAsks(t *testing.T) {
+	projectDir := t.TempDir()
+	for i := 0; i <= maxExpandedEntries; i++ {
+		os.WriteFile(filepath.Join(projectDir, fmt.Sprintf("f%d.go", i)), nil, 0644)
+	}
+
+	r, _ := rules.LoadRules(testDefaultRules())
+	processor := NewClaudeHookProcessor(r)
+	result, _ := processor.handleGrepTool(hookContext{Cwd: projectDir}, map[string]interface{}{"pattern": "TODO", "output_mode": "content"})
+	if decision := decodeHookOutput(t, result)["permissionDecision"]; decision != "ask" {
+		t.Errorf("permissionDecision = %v, want ask for a tree too large to check", decision)
+	}
+}
+
+func TestRedactedFileKeepsLineNumbers(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "config.swift")
+	original := "import Foundation\n\nlet apiKey = \"sk-1234567890abcdefghijklmnopqrstuvwxyz123456789012\"\nlet endpoint = \"https://example.com\"\n"
+	os.WriteFile(testFile, []byte(original), 0644)
+
+	r, _ := rules.LoadRules(testDefaultRules())
+	r.RedactFiles.Extensions = append(r.RedactFiles.Extensions, ".swift")
+	processor := NewClaudeHookProcessor(r)
+	processor.cacheDir = filepath.Join(tmpDir, "cache")
+
+	result, _ := processor.handleReadTool(hookContext{}, map[string]interface{}{
+		"file_path": testFile,
+		"offset":    float64(3),
+		"limit":     float64(2),
+	})
+	reason := decodeHookOutput(t, result)["permissionDecisionReason"].(string)
+	if !strings.Contains(reason, "offset: 3, limit: 2") {
+		t.Errorf("redirect reason should carry the original range, got %q", reason)
+	}
+
+	redactedPath, _, _ := processor.createRedactedFile(hookContext{}, testFile)
+	redacted, _ := os.ReadFile(redactedPath)
+	originalLines := strings.Split(original, "\n")
+	redactedLines := strings.Split(string(redacted), "\n")
+	for _, i := range []int{0, 1, 3} {
+		if redactedLines[i] != originalLines[i] {
+			t.Errorf("line %d = %q, want %q", i+1, redactedLines[i], originalLines[i])
+		}
+	}
+	if strings.Contains(redactedLines[2], "sk-") {
+		t.Errorf("line 3 should be redacted, got %q", redactedLines[2])
+	}
+	if !strings.Contains(string(redacted), "# Original: "+testFile) {
+		t.Error("redacted copy should end with a trailer naming the original")
+	}
+}
+
+func TestGrepAndGlobArgumentsAreChecked(t *testing.T) {
+	projectDir := t.TempDir()
+	os.MkdirAll(filepath.Join(projectDir, "deploy"), 0755)
+	os.WriteFile(filepath.Join(projectDir, "deploy", ".env"), []byte("TOKEN=abc"), 0644)
+	os.WriteFile(filepath.Join(projectDir, "deploy", "run.sh"), []byte("echo hi"), 0644)
+	os.WriteFile(filepath.Join(projectDir, "main.go"), []byte("package main"), 0644)
+	os.MkdirAll(filepath.Join(projectDir, "vendor", "lib"), 0755)
+	os.WriteFile(filepath.Join(projectDir, "vendor", "lib", ".env"), []byte("TOKEN=abc"), 0644)
+
+	r, _ := rules.LoadRules(testDefaultRules())
+	processor := NewClaudeHookProcessor(r)
+	ctx := hookContext{Cwd: projectDir}
+
+	tests := []struct {
+		name      string
+		tool      string
+		toolInput map[string]interface{}
+		denied    bool
+	}{
+		{"grep path is blocked file", "Grep", map[string]interface{}{"pattern": "TODO", "path": ".env"}, true},
+		{"grep glob targets keys", "Grep", map[string]interface{}{"pattern": "BEGIN", "glob": "*.pem"}, true},
+		{"grep type targets keys", "Grep", map[string]interface{}{"pattern": "BEGIN", "type": "pem"}, true},
+		{"grep content over dir with env file", "Grep", map[string]interface{}{"pattern": "TOKEN", "path": "deploy", "output_mode": "content"}, true},
+		{"grep file names over dir with env file", "Grep", map[string]interface{}{"pattern": "TODO", "path": "deploy"}, false},
+		{"grep content over whole project with env file", "Grep", map[string]interface{}{"pattern": "TODO", "output_mode": "content"}, true},
+		{"grep content over vendored tree with env file", "Grep", map[string]interface{}{"pattern": "TODO", "glob": "vendor/**/*", "output_mode": "content"}, true},
+		{"grep go files", "Grep", map[string]interface{}{"pattern": "TODO", "glob": "**/*.go", "output_mode": "content"}, false},
+		{"glob is case-insensitive", "Glob", map[string]interface{}{"pattern": "**/*.PEM"}, true},
+		{"glob for env files", "Glob", map[string]interface{}{"pattern": "**/.env*"}, true},
+		{"glob path is blocked dir", "Glob", map[string]interface{}{"pattern": "*", "path": "/srv/secrets"}, true},
+		{"glob for go files", "Glob", map[string]interface{}{"pattern": "**/*.go"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var result string
+			if tt.tool == "Grep" {
+				result, _ = processor.handleGrepTool(ctx, tt.toolInput)
+			} else {
+				result, _ = processor.handleGlobTool(ctx, tt.toolInput)
+			}
+			if denied := result != ""; denied != tt.denied {
+				t.Errorf("denied = %v, want %v (response %q)", denied, tt.denied, result)
+			}
+		})
+	}
+}
+
+func TestPostToolUseRedactsGrepResults(t *testing.T) {
+	r, _ := rules.LoadRules(testDefaultRules())
+	processor := NewClaudeHookProcessor(r)
+
+	result, err := processor.Process(map[string]interface{}{
+		"hook_event_name": "PostToolUse",
+		"tool_name":       "Grep",
+		"tool_response": map[string]interface{}{
+			"mode":    "content",
+			"content": "app/settings.py:3:OPENAI = \"sk-1234567890abcdefghijklmnopqrstuvwxyz123456789012\"",
+		},
+	})
+	if err != nil {
+		t.Fatalf("Process returned error: %v", err)
+	}
+
+	var response map[string]interface{}
+	if err := json.Unmarshal([]byte(result), &response); err != nil {
+		t.Fatalf("Failed to parse JSON response %q: %v", result, err)
+	}
+	if response["decision"] != "block" {
+		t.Errorf("decision = %v, want block", response["decision"])
+	}
+	reason := response["reason"].(string)
+	if strings.Contains(reason, "sk-1234567890") || !strings.Contains(reason, "app/settings.py:3:") {
+		t.Errorf("reason should carry redacted results, got %q", reason)
+	}
+}
+
+func TestReadToolResolvesTraversalAndSymlinks(t *testing.T) {
+	projectDir := t.TempDir()
+	os.MkdirAll(filepath.Join(projectDir, "src"), 0755)
+	os.WriteFile(filepath.Join(projectDir, ".env"), []byte("API_KEY=secret123"), 0644)
+	if err := os.Symlink(filepath.Join(projectDir, ".env"), filepath.Join(projectDir, "notes.txt")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	r, _ := rules.LoadRules(testDefaultRules())
+	processor := NewClaudeHookProcessor(r)
+	processor.cacheDir = filepath.Join(t.TempDir(), "cache")
+	ctx := hookContext{Cwd: projectDir}
+
+	for _, path := range []string{"notes.txt", "src/../.env", filepath.Join(projectDir, "src", "..", "notes.txt")} {
+		result, _ := processor.handleReadTool(ctx, map[string]interface{}{"file_path": path})
+		if result == "" || decodeHookOutput(t, result)["permissionDecision"] != "deny" {
+			t.Errorf("Read %q should be denied, got %q", path, result)
+		}
+	}
+
+	// A symlink planted in the session cache must not bypass the rules
+	sessionDir, _ := processor.ensureSessionCacheDir("")
+	planted := filepath.Join(sessionDir, "planted.txt")
+	os.Symlink(filepath.Join(projectDir, ".env"), planted)
+	result, _ := processor.handleReadTool(ctx, map[string]interface{}{"file_path": planted})
+	if result == "" {
+		t.Error("symlink in the cache pointing at .env should be denied")
+	}
+}
+
+func TestConfigErrorProcessorFailsClosed(t *testing.T) {
+	processor := NewConfigErrorProcessor(&rules.ConfigError{Issues: []rules.Issue{
+		{Source: "config.yaml", Line: 3, Severity: rules.SeverityError, Message: `invalid regex "(unclosed"`},
+	}})
+	processor.cacheDir = filepath.Join(t.TempDir(), "cache")
+
+	result, err := processor.Process(map[string]interface{}{
+		"hook_event_name": "PreToolUse",
+		"tool_name":       "Read",
+		"tool_input":      map[string]interface{}{"file_path": "README.md"},
+	})
+	if err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	hookOutput := decodeHookOutput(t, result)
+	if hookOutput["permissionDecision"] != "deny" {
+		t.Errorf("expected deny, got %v", hookOutput["permissionDecision"])
+	}
+	if reason, _ := hookOutput["permissionDecisionReason"].(string); !strings.Contains(reason, "config.yaml:3") {
+		t.Errorf("reason should point at the broken config, got %q", reason)
+	}
+
+	if _, err := processor.Process(map[string]interface{}{
+		"hook_event_name": "UserPromptSubmit",
+		"prompt":          "hello",
+	}); err == nil {
+		t.Error("prompts should be blocked while the config is invalid")
+	}
+
+	if result, err := processor.Process(map[string]interface{}{"hook_event_name": "SessionEnd"}); err != nil || result != "{}" {
+		t.Errorf("SessionEnd should still succeed, got %q, %v", result, err)
+	}
+}
+
+func TestProcessRecordedDescribesDecisions(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	r, _ := rules.LoadRules(testDefaultRules())
+	processor := NewClaudeHookProcessor(r)
+	processor.cacheDir = filepath.Join(t.TempDir(), "cache")
+
+	tests := []struct {
+		name  string
+		input map[string]interface{}
+		want  Record
+	}{
+		{
+			"denied read",
+			map[string]interface{}{"hook_event_name": "PreToolUse", "tool_name": "Read", "tool_input": map[string]interface{}{"file_path": "/app/.env"}},
+			Record{Decision: DecisionDeny, Rules: []string{".env"}, Path: "/app/.env"},
+		},
+		{
+			"allowed search",
+			map[string]interface{}{"hook_event_name": "PreToolUse", "tool_name": "Glob", "tool_input": map[string]interface{}{"pattern": "*.go", "path": "/app/src"}},
+			Record{Decision: DecisionAllow, Path: "/app/src"},
+		},
+		{
+			"blocked prompt",
+			map[string]interface{}{"hook_event_name": "UserPromptSubmit", "session_id": "s1", "prompt": "API_KEY=abcdefghij1234567890XYZ"},
+			Record{Decision: DecisionBlock, Rules: []string{"api_keys"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, record, _ := processor.ProcessRecorded(tt.input)
+			if record.Decision != tt.want.Decision || strings.Join(record.Rules, ",") != strings.Join(tt.want.Rules, ",") || record.Path != tt.want.Path {
+				t.Errorf("record = %+v, want %+v", record, tt.want)
+			}
+		})
+	}
+
+	if processor.record != nil {
+		t.Error("the shared processor must not keep a call's record")
+	}
+}
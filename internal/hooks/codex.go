@@ -0,0 +1,68 @@
+package hooks
+
+import (
+	"strings"
+
+	"github.com/wissem/cc-filter/internal/rules"
+)
+
+// CodexNotifyProcessor handles Codex CLI's notify program, the only hook
+// Codex CLI offers. Codex runs it with a JSON payload once a turn has
+// finished and ignores its output, so nothing can be allowed, denied or
+// redacted: the processor records which rules the turn's prompts and final
+// answer matched, so the audit log and metrics show what reached the model.
+type CodexNotifyProcessor struct {
+	*ClaudeHookProcessor
+}
+
+func NewCodexNotifyProcessor(rules *rules.Rules) *CodexNotifyProcessor {
+	return &CodexNotifyProcessor{ClaudeHookProcessor: NewClaudeHookProcessor(rules)}
+}
+
+func isCodexNotification(input map[string]interface{}) bool {
+	return input["type"] == "agent-turn-complete"
+}
+
+func (p *CodexNotifyProcessor) Name() string {
+	return AgentCodex
+}
+
+func (p *CodexNotifyProcessor) CanHandle(input map[string]interface{}) bool {
+	return isCodexNotification(input)
+}
+
+func (p *CodexNotifyProcessor) Process(input map[string]interface{}) (string, error) {
+	output, _, err := p.ProcessRecorded(input)
+	return output, err
+}
+
+// ProcessRecorded processes a notification and describes what it found
+func (p *CodexNotifyProcessor) ProcessRecorded(input map[string]interface{}) (string, Record, error) {
+	call := &CodexNotifyProcessor{ClaudeHookProcessor: p.forCall()}
+	call.record.Agent = AgentCodex
+	call.record.Session, _ = input["thread-id"].(string)
+	output, err := call.process(input)
+	return output, *call.record, err
+}
+
+func (p *CodexNotifyProcessor) process(input map[string]interface{}) (string, error) {
+	messages, _ := input["input-messages"].([]interface{})
+	var turn []string
+	for _, message := range messages {
+		if text, ok := message.(string); ok {
+			turn = append(turn, text)
+		}
+	}
+	if answer, _ := input["last-assistant-message"].(string); answer != "" {
+		turn = append(turn, answer)
+	}
+
+	result := p.rules.FilterContent(strings.Join(turn, "\n"))
+	if result.Filtered {
+		// the decision stands at allow: the turn is over and cannot be undone
+		p.decide(DecisionAllow, result.MatchedPatterns...)
+		p.logger.Printf("Codex turn %v contained data matched by %s; notify runs after the turn, so it already reached the model",
+			input["turn-id"], strings.Join(result.MatchedPatterns, ", "))
+	}
+	return "", nil
+}
@@ -0,0 +1,174 @@
+package hooks
+
+import (
+	"encoding/json"
+
+	"github.com/wissem/cc-filter/internal/rules"
+)
+
+// Answer is one processor's answer to a hook
+type Answer struct {
+	Processor HookProcessor
+	Name      string // the processor's name, see NamedProcessor
+	Output    string
+	Record    Record // empty unless the processor is a RecordingProcessor
+	Err       error
+}
+
+// Decision returns the decision the processor recorded or, when it records
+// none, the one its error or output comes to
+func (a Answer) Decision() string {
+	switch {
+	case a.Record.Decision != "":
+		return a.Record.Decision
+	case a.Err != nil:
+		return DecisionBlock
+	default:
+		return parseResponse(a.Output).decision()
+	}
+}
+
+// Composer combines the answers of the processors that handled a hook,
+// given in priority order, into the one the agent gets. The Registry
+// records every answer in the result's Contributions.
+type Composer func(input map[string]interface{}, answers []Answer) Answer
+
+// ComposeStrictest is the Registry's default Composer. The strictest
+// answer wins: deny or block over ask or redact, and those over allow,
+// with the higher priority winning a tie. A redaction whose response
+// refuses the call, pointing the agent at a redacted copy instead, counts
+// as a refusal, so only another refusal can replace it. Unless the call is
+// refused, the updatedInput of every answer that lets it through is merged
+// into the winner's; where two set the same field, the winner's value
+// stands, then the higher priority's.
+func ComposeStrictest(input map[string]interface{}, answers []Answer) Answer {
+	winner := answers[0]
+	for _, answer := range answers[1:] {
+		severity, best := answerSeverity(answer), answerSeverity(winner)
+		// on a tie, prefer an answer whose updatedInput the others can join
+		if severity > best || severity == best && parseResponse(winner.Output).updatedInput() == nil && parseResponse(answer.Output).updatedInput() != nil {
+			winner = answer
+		}
+	}
+	composed := winner
+	composed.Record.Decision = winner.Decision()
+	if composed.Err != nil || parseResponse(composed.Output).refuses() {
+		return composed
+	}
+
+	merged := make(map[string]interface{})
+	for i := len(answers) - 1; i >= 0; i-- {
+		response := parseResponse(answers[i].Output)
+		if answers[i].Err != nil || response.refuses() {
+			continue
+		}
+		for key, value := range response.updatedInput() {
+			merged[key] = value
+		}
+	}
+	own := parseResponse(composed.Output).updatedInput()
+	for key, value := range own {
+		merged[key] = value
+	}
+	if len(merged) > len(own) {
+		composed.Output = withUpdatedInput(composed.Output, merged)
+	}
+	return composed
+}
+
+// ComposePriority is a Composer under which the highest-priority processor
+// with something to say decides alone: the first answer that is not a
+// silent allow wins. An error from any processor still blocks.
+func ComposePriority(input map[string]interface{}, answers []Answer) Answer {
+	for _, answer := range answers {
+		if answer.Err != nil {
+			answer.Record.Decision = DecisionBlock
+			return answer
+		}
+	}
+	winner := answers[0]
+	for _, answer := range answers {
+		if answer.Output != "" || answer.Decision() != DecisionAllow {
+			winner = answer
+			break
+		}
+	}
+	winner.Record.Decision = winner.Decision()
+	return winner
+}
+
+// ComposerFor returns the Composer a config's compose setting names
+func ComposerFor(mode rules.ComposeMode) Composer {
+	if mode == rules.ComposePriority {
+		return ComposePriority
+	}
+	return ComposeStrictest
+}
+
+// answerSeverity ranks an answer by how much it holds the call back,
+// taking the stricter of its recorded decision and its response
+func answerSeverity(a Answer) int {
+	return max(decisionSeverity(a.Decision()), decisionSeverity(parseResponse(a.Output).decision()))
+}
+
+// hookResponse is what composing answers needs to read from a response in
+// any agent's schema
+type hookResponse struct {
+	HookSpecificOutput *struct {
+		PermissionDecision string                 `json:"permissionDecision"`
+		UpdatedInput       map[string]interface{} `json:"updatedInput"`
+	} `json:"hookSpecificOutput"`
+	Decision   string `json:"decision"`   // Gemini CLI, and Claude Code's "block"
+	Permission string `json:"permission"` // Cursor
+	Continue   *bool  `json:"continue"`
+}
+
+// parseResponse reads a hook response; an empty or non-JSON one allows
+func parseResponse(output string) hookResponse {
+	var response hookResponse
+	_ = json.Unmarshal([]byte(output), &response)
+	return response
+}
+
+// decision returns the Decision a response comes to
+func (r hookResponse) decision() string {
+	switch {
+	case r.HookSpecificOutput != nil && r.HookSpecificOutput.PermissionDecision != "":
+		return r.HookSpecificOutput.PermissionDecision
+	case r.Decision == "block", r.Continue != nil && !*r.Continue:
+		return DecisionBlock
+	case r.Decision != "":
+		return r.Decision
+	case r.Permission != "":
+		return r.Permission
+	default:
+		return DecisionAllow
+	}
+}
+
+// refuses reports whether the response stops the call
+func (r hookResponse) refuses() bool {
+	return decisionSeverity(r.decision()) == 2
+}
+
+func (r hookResponse) updatedInput() map[string]interface{} {
+	if r.HookSpecificOutput == nil {
+		return nil
+	}
+	return r.HookSpecificOutput.UpdatedInput
+}
+
+// withUpdatedInput replaces the updatedInput of a Claude Code response
+func withUpdatedInput(output string, updatedInput map[string]interface{}) string {
+	var response map[string]interface{}
+	if err := json.Unmarshal([]byte(output), &response); err != nil {
+		return output
+	}
+	specific, ok := response["hookSpecificOutput"].(map[string]interface{})
+	if !ok {
+		return output
+	}
+	specific["updatedInput"] = updatedInput
+	jsonBytes, _ := json.Marshal(response)
+	return string(jsonBytes)
+}
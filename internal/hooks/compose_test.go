@@ -0,0 +1,259 @@
+package hooks
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/wissem/cc-filter/internal/rules"
+)
+
+// stubProcessor answers every PreToolUse the same way, as a third-party
+// processor that does not record its decisions would
+type stubProcessor struct {
+	name   string
+	output string
+	err    error
+}
+
+func (p *stubProcessor) Name() string { return p.name }
+
+func (p *stubProcessor) CanHandle(input map[string]interface{}) bool {
+	return input["hook_event_name"] == "PreToolUse"
+}
+
+func (p *stubProcessor) Process(input map[string]interface{}) (string, error) {
+	return p.output, p.err
+}
+
+func preToolUse(decision, reason string, updatedInput map[string]interface{}) string {
+	specific := map[string]interface{}{"hookEventName": "PreToolUse", "permissionDecision": decision}
+	if reason != "" {
+		specific["permissionDecisionReason"] = reason
+	}
+	if updatedInput != nil {
+		specific["updatedInput"] = updatedInput
+	}
+	jsonBytes, _ := json.Marshal(map[string]interface{}{"hookSpecificOutput": specific})
+	return string(jsonBytes)
+}
+
+func TestRegistryComposesAnswers(t *testing.T) {
+	input := map[string]interface{}{
+		"session_id": "s1", "hook_event_name": "PreToolUse", "tool_name": "Read",
+		"tool_input": map[string]interface{}{"file_path": "/app/main.go"},
+	}
+
+	tests := []struct {
+		name      string
+		high, low *stubProcessor // registered with priority 10 and 0
+		decision  string
+		output    string // the answer that wins, before merging
+		merged    map[string]interface{}
+	}{
+		{
+			name:     "deny wins",
+			high:     &stubProcessor{name: "high", output: ""},
+			low:      &stubProcessor{name: "low", output: preToolUse("deny", "low says no", nil)},
+			decision: DecisionDeny,
+			output:   preToolUse("deny", "low says no", nil),
+		},
+		{
+			name:     "ask beats allow",
+			high:     &stubProcessor{name: "high", output: preToolUse("allow", "", nil)},
+			low:      &stubProcessor{name: "low", output: preToolUse("ask", "low is unsure", nil)},
+			decision: DecisionAsk,
+			output:   preToolUse("ask", "low is unsure", nil),
+		},
+		{
+			name:     "higher priority wins a tie",
+			high:     &stubProcessor{name: "high", output: preToolUse("deny", "high says no", nil)},
+			low:      &stubProcessor{name: "low", output: preToolUse("deny", "low says no", nil)},
+			decision: DecisionDeny,
+			output:   preToolUse("deny", "high says no", nil),
+		},
+		{
+			name:     "an error blocks",
+			high:     &stubProcessor{name: "high", output: preToolUse("allow", "", nil)},
+			low:      &stubProcessor{name: "low", err: errors.New("compliance backend down")},
+			decision: DecisionBlock,
+		},
+		{
+			name:     "updatedInput merges",
+			high:     &stubProcessor{name: "high", output: preToolUse("allow", "", map[string]interface{}{"file_path": "/tmp/a", "limit": 10})},
+			low:      &stubProcessor{name: "low", output: preToolUse("allow", "", map[string]interface{}{"file_path": "/tmp/b", "offset": 5})},
+			decision: DecisionAllow,
+			merged:   map[string]interface{}{"file_path": "/tmp/a", "limit": float64(10), "offset": float64(5)},
+		},
+		{
+			name:     "updatedInput joins an ask",
+			high:     &stubProcessor{name: "high", output: preToolUse("ask", "confirm", nil)},
+			low:      &stubProcessor{name: "low", output: preToolUse("allow", "", map[string]interface{}{"limit": 10})},
+			decision: DecisionAsk,
+			merged:   map[string]interface{}{"limit": float64(10)},
+		},
+		{
+			name:     "the winner's updatedInput takes precedence",
+			high:     &stubProcessor{name: "high", output: preToolUse("allow", "", map[string]interface{}{"file_path": "/tmp/a", "limit": 10})},
+			low:      &stubProcessor{name: "low", output: preToolUse("ask", "confirm the copy", map[string]interface{}{"file_path": "/tmp/b"})},
+			decision: DecisionAsk,
+			merged:   map[string]interface{}{"file_path": "/tmp/b", "limit": float64(10)},
+		},
+		{
+			name:     "a refusal drops updatedInput",
+			high:     &stubProcessor{name: "high", output: preToolUse("allow", "", map[string]interface{}{"file_path": "/tmp/a"})},
+			low:      &stubProcessor{name: "low", output: preToolUse("deny", "low says no", nil)},
+			decision: DecisionDeny,
+			output:   preToolUse("deny", "low says no", nil),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := NewRegistry()
+			registry.Register(tt.low)
+			registry.RegisterPriority(tt.high, 10)
+
+			output, record, handled, err := registry.ProcessRecorded(input)
+			if !handled {
+				t.Fatal("not handled")
+			}
+			if record.Decision != tt.decision {
+				t.Errorf("decision = %q, want %q", record.Decision, tt.decision)
+			}
+			if tt.decision == DecisionBlock && err == nil {
+				t.Error("blocked without an error")
+			}
+			if tt.output != "" && output != tt.output {
+				t.Errorf("output = %s, want %s", output, tt.output)
+			}
+			if tt.merged != nil {
+				if got := parseResponse(output).updatedInput(); !reflect.DeepEqual(got, tt.merged) {
+					t.Errorf("updatedInput = %v, want %v", got, tt.merged)
+				}
+				if got := parseResponse(output).decision(); got != tt.decision {
+					t.Errorf("merged output decides %q, want %q", got, tt.decision)
+				}
+			}
+
+			var names []string
+			for _, contribution := range record.Contributions {
+				names = append(names, contribution.Processor)
+			}
+			if strings.Join(names, ",") != "high,low" {
+				t.Errorf("contributions = %+v, want high then low", record.Contributions)
+			}
+		})
+	}
+}
+
+func TestRegistryChainsBuiltInProcessors(t *testing.T) {
+	registry := agentRegistry(t, t.TempDir())
+	compliance := &stubProcessor{name: "compliance"}
+	registry.RegisterPriority(compliance, 10)
+
+	read := func(path string) map[string]interface{} {
+		return map[string]interface{}{
+			"session_id": "s1", "hook_event_name": "PreToolUse", "tool_name": "Read",
+			"tool_input": map[string]interface{}{"file_path": path},
+		}
+	}
+
+	// cc-filter's denial survives another processor's allow, and says why
+	output, record, _, _ := registry.ProcessRecorded(read("/app/.env"))
+	if record.Decision != DecisionDeny || !strings.Contains(output, "Access denied") {
+		t.Errorf("record %+v, output %s", record, output)
+	}
+	if len(record.Contributions) != 2 {
+		t.Fatalf("contributions = %+v, want compliance and claude-code", record.Contributions)
+	}
+	want := []Contribution{
+		{Processor: "compliance", Decision: DecisionAllow},
+		{Processor: AgentClaudeCode, Decision: DecisionDeny, Rules: record.Contributions[1].Rules},
+	}
+	if !reflect.DeepEqual(record.Contributions, want) || len(want[1].Rules) == 0 {
+		t.Errorf("contributions = %+v, want %+v", record.Contributions, want)
+	}
+
+	// and the other processor can refuse what cc-filter allows
+	compliance.output = preToolUse("ask", "Reading customer data needs a ticket", nil)
+	output, record, _, _ = registry.ProcessRecorded(read("/srv/customers/acme.csv"))
+	if record.Decision != DecisionAsk || output != compliance.output {
+		t.Errorf("record %+v, output %s", record, output)
+	}
+
+	// a hook only one processor handles is answered as before
+	_, record, _, _ = registry.ProcessRecorded(map[string]interface{}{
+		"conversation_id": "c1", "hook_event_name": "beforeReadFile", "file_path": "/app/main.go",
+	})
+	if record.Agent != AgentCursor || record.Contributions != nil {
+		t.Errorf("cursor record %+v", record)
+	}
+}
+
+// recordingStub answers like stubProcessor and records decision, as the
+// built-in processors do
+type recordingStub struct {
+	stubProcessor
+	decision string
+}
+
+func (p *recordingStub) ProcessRecorded(input map[string]interface{}) (string, Record, error) {
+	return p.output, Record{Agent: AgentClaudeCode, Decision: p.decision}, p.err
+}
+
+func TestRegistryKeepsRedactions(t *testing.T) {
+	// a redaction denies the read and points the agent at a redacted copy;
+	// approving an ask in its place would hand over the original
+	redirect := preToolUse("deny", "Read the redacted copy at /tmp/cache/app.py instead", nil)
+	redact := &recordingStub{stubProcessor: stubProcessor{name: "redact", output: redirect}, decision: DecisionRedact}
+
+	registry := NewRegistry()
+	registry.Register(redact)
+	registry.RegisterPriority(&stubProcessor{name: "high", output: preToolUse("ask", "confirm", nil)}, 10)
+
+	output, record, _, _ := registry.ProcessRecorded(map[string]interface{}{"hook_event_name": "PreToolUse"})
+	if record.Decision != DecisionRedact || output != redirect {
+		t.Errorf("record %+v, output %s, want the redirect", record, output)
+	}
+
+	// a stricter refusal may still replace it
+	registry.RegisterPriority(&stubProcessor{name: "higher", output: preToolUse("deny", "no", nil)}, 20)
+	if _, record, _, _ := registry.ProcessRecorded(map[string]interface{}{"hook_event_name": "PreToolUse"}); record.Decision != DecisionDeny {
+		t.Errorf("record %+v, want deny", record)
+	}
+}
+
+func TestComposePriority(t *testing.T) {
+	registry := NewRegistry()
+	registry.SetComposer(ComposerFor(rules.ComposePriority))
+	registry.RegisterPriority(&stubProcessor{name: "silent"}, 20)
+	registry.RegisterPriority(&stubProcessor{name: "high", output: preToolUse("allow", "", nil)}, 10)
+	low := &stubProcessor{name: "low", output: preToolUse("deny", "no", nil)}
+	registry.Register(low)
+
+	input := map[string]interface{}{"hook_event_name": "PreToolUse"}
+	if output, record, _, _ := registry.ProcessRecorded(input); record.Decision != DecisionAllow || parseResponse(output).decision() != DecisionAllow {
+		t.Errorf("record %+v, output %s, want the first answer that says something", record, output)
+	}
+
+	low.output, low.err = "", errors.New("backend down")
+	if _, record, _, _ := registry.ProcessRecorded(input); record.Decision != DecisionBlock {
+		t.Errorf("record %+v, want an error to block", record)
+	}
+}
+
+func TestRegistrySetComposer(t *testing.T) {
+	registry := NewRegistry()
+	registry.Register(&stubProcessor{name: "first", output: preToolUse("allow", "", nil)})
+	registry.Register(&stubProcessor{name: "second", output: preToolUse("deny", "no", nil)})
+	registry.SetComposer(func(input map[string]interface{}, answers []Answer) Answer {
+		return answers[0]
+	})
+
+	output, record, _, _ := registry.ProcessRecorded(map[string]interface{}{"hook_event_name": "PreToolUse"})
+	if parseResponse(output).decision() != DecisionAllow || len(record.Contributions) != 2 || record.Contributions[1].Decision != DecisionDeny {
+		t.Errorf("record %+v, output %s", record, output)
+	}
+}
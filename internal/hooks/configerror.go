@@ -0,0 +1,88 @@
+package hooks
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/wissem/cc-filter/internal/rules"
+)
+
+// ConfigErrorProcessor answers hooks when the configuration could not be
+// loaded and the policy is to fail closed: tool calls are denied, prompts
+// and search results are blocked, and the reason names the broken config so
+// the user can fix it with "cc-filter config validate". It answers every
+// agent's hooks, each in its own schema.
+type ConfigErrorProcessor struct {
+	*ClaudeHookProcessor
+	err error
+}
+
+func NewConfigErrorProcessor(err error) *ConfigErrorProcessor {
+	return &ConfigErrorProcessor{
+		ClaudeHookProcessor: &ClaudeHookProcessor{cacheDir: DefaultCacheDir(), logger: log.Default()},
+		err:                 err,
+	}
+}
+
+func (p *ConfigErrorProcessor) Name() string {
+	return "config-error"
+}
+
+func (p *ConfigErrorProcessor) CanHandle(input map[string]interface{}) bool {
+	return p.ClaudeHookProcessor.CanHandle(input) || isCursorEvent(input) || isGeminiEvent(input)
+}
+
+func (p *ConfigErrorProcessor) Process(input map[string]interface{}) (string, error) {
+	output, _, err := p.ProcessRecorded(input)
+	return output, err
+}
+
+// ProcessRecorded processes a hook and describes the decision it made
+func (p *ConfigErrorProcessor) ProcessRecorded(input map[string]interface{}) (string, Record, error) {
+	call := &ConfigErrorProcessor{ClaudeHookProcessor: p.forCall(), err: p.err}
+	switch {
+	case isCursorEvent(input):
+		call.record.Agent = AgentCursor
+		call.record.Session, _ = input["conversation_id"].(string)
+		call.record.Tool = cursorTools[input["hook_event_name"].(string)]
+	case isGeminiEvent(input):
+		call.record.Agent = AgentGemini
+	}
+	output, err := call.process(input)
+	return output, *call.record, err
+}
+
+func (p *ConfigErrorProcessor) process(input map[string]interface{}) (string, error) {
+	reason := fmt.Sprintf("cc-filter is failing closed because its configuration is invalid: %v\n\n"+
+		"Run \"cc-filter config validate\" to see every problem.", p.err)
+
+	switch input["hook_event_name"].(string) {
+	case "PreToolUse":
+		p.decide(DecisionDeny)
+		return p.denyTool(reason)
+	case "PostToolUse":
+		p.decide(DecisionDeny)
+		jsonBytes, _ := json.Marshal(map[string]interface{}{"decision": "block", "reason": reason})
+		return string(jsonBytes), nil
+	case "UserPromptSubmit", "BeforeAgent":
+		p.decide(DecisionBlock)
+		return "", fmt.Errorf("⛔ BLOCKED: %s", reason)
+	case "BeforeTool", "AfterTool":
+		p.decide(DecisionDeny)
+		return geminiDecision(rules.ActionDeny, reason)
+	case "beforeShellExecution", "beforeReadFile":
+		p.decide(DecisionDeny)
+		return cursorPermission(rules.ActionDeny, reason)
+	case "beforeSubmitPrompt":
+		p.decide(DecisionBlock)
+		return cursorContinue(false, "⛔ BLOCKED: "+reason)
+	case "stop":
+		return (&CursorHookProcessor{ClaudeHookProcessor: p.ClaudeHookProcessor}).process(input)
+	case "SessionEnd":
+		// cache cleanup does not depend on the configuration
+		return p.processSessionEnd(input)
+	default:
+		return "{}", nil
+	}
+}
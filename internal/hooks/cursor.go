@@ -0,0 +1,168 @@
+package hooks
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/wissem/cc-filter/internal/rules"
+)
+
+// CursorHookProcessor answers Cursor's agent hooks with the same rules as
+// Claude Code's. Cursor names its session conversation_id and sends no
+// tool_name, so the hook event decides the tool. Its responses carry a
+// "permission" of allow, deny or ask, or "continue" for prompts.
+type CursorHookProcessor struct {
+	*ClaudeHookProcessor
+}
+
+func NewCursorHookProcessor(rules *rules.Rules) *CursorHookProcessor {
+	return &CursorHookProcessor{ClaudeHookProcessor: NewClaudeHookProcessor(rules)}
+}
+
+// cursorTools maps the Cursor hook events cc-filter answers to the tool
+// they stand for; "stop" ends the conversation
+var cursorTools = map[string]string{
+	"beforeShellExecution": "Shell",
+	"beforeReadFile":       "Read",
+	"beforeSubmitPrompt":   "",
+	"stop":                 "",
+}
+
+func isCursorEvent(input map[string]interface{}) bool {
+	event, _ := input["hook_event_name"].(string)
+	_, ok := cursorTools[event]
+	return ok
+}
+
+func (p *CursorHookProcessor) Name() string {
+	return AgentCursor
+}
+
+func (p *CursorHookProcessor) CanHandle(input map[string]interface{}) bool {
+	return isCursorEvent(input)
+}
+
+func (p *CursorHookProcessor) Process(input map[string]interface{}) (string, error) {
+	output, _, err := p.ProcessRecorded(input)
+	return output, err
+}
+
+// ProcessRecorded processes a hook and describes the decision it made
+func (p *CursorHookProcessor) ProcessRecorded(input map[string]interface{}) (string, Record, error) {
+	call := &CursorHookProcessor{ClaudeHookProcessor: p.forCall()}
+	call.record.Agent = AgentCursor
+	call.record.Session, _ = input["conversation_id"].(string)
+	call.record.Tool = cursorTools[input["hook_event_name"].(string)]
+	output, err := call.process(input)
+	return output, *call.record, err
+}
+
+// newCursorContext reads the session-level fields of a Cursor payload. Only
+// shell commands come with a cwd; other hooks run in the first workspace.
+func newCursorContext(input map[string]interface{}) hookContext {
+	sessionID, _ := input["conversation_id"].(string)
+	return hookContext{SessionID: sessionID, Cwd: WorkingDir(input)}
+}
+
+// WorkingDir returns the directory a hook payload works in: its cwd, or
+// the first of Cursor's workspace_roots
+func WorkingDir(input map[string]interface{}) string {
+	if cwd, _ := input["cwd"].(string); cwd != "" {
+		return cwd
+	}
+	roots, _ := input["workspace_roots"].([]interface{})
+	if len(roots) > 0 {
+		root, _ := roots[0].(string)
+		return root
+	}
+	return ""
+}
+
+func (p *CursorHookProcessor) process(input map[string]interface{}) (string, error) {
+	ctx := newCursorContext(input)
+
+	switch input["hook_event_name"].(string) {
+	case "beforeShellExecution":
+		command, _ := input["command"].(string)
+		verdict, selfOverride := p.checkCommand(command)
+		if selfOverride {
+			p.decide(DecisionDeny)
+			return cursorPermission(rules.ActionDeny, verdict.Reason)
+		}
+		if verdict.Action != rules.ActionAllow {
+			return cursorPermission(p.resolve(ctx, "Shell", command, verdict))
+		}
+		return cursorPermission(rules.ActionAllow, "")
+	case "beforeReadFile":
+		filePath, _ := input["file_path"].(string)
+		p.target(filePath)
+		verdict, redactedPath := p.checkRead(ctx, "Read", filePath)
+		if verdict.Action != rules.ActionAllow {
+			action, reason := p.resolve(ctx, "Read", filePath, verdict)
+			if action == rules.ActionAsk {
+				// beforeReadFile cannot ask the user, only allow or deny
+				p.decide(DecisionDeny)
+				action = rules.ActionDeny
+			}
+			return cursorPermission(action, reason)
+		}
+		if redactedPath != "" {
+			p.decide(DecisionRedact)
+			return cursorPermission(rules.ActionDeny, redirectReason(filePath, redactedPath, readRange{}))
+		}
+		return cursorPermission(rules.ActionAllow, "")
+	case "beforeSubmitPrompt":
+		prompt, _ := input["prompt"].(string)
+		if message, blocked := p.checkPrompt(ctx, prompt); blocked {
+			return cursorContinue(false, message)
+		}
+		return cursorContinue(true, "")
+	case "stop":
+		// Remove only this conversation's cache; others may still be running
+		if err := os.RemoveAll(p.sessionCacheDir(ctx.SessionID)); err != nil {
+			p.logger.Printf("stop cleanup warning: %v", err)
+		}
+		return "{}", nil
+	default:
+		return "{}", nil
+	}
+}
+
+// Veto answers a hook with a plugin's stricter decision
+func (p *CursorHookProcessor) Veto(input map[string]interface{}, action rules.Action, reason string) (string, string, error) {
+	switch input["hook_event_name"].(string) {
+	case "beforeShellExecution":
+		output, err := cursorPermission(action, reason)
+		return output, string(action), err
+	case "beforeReadFile":
+		output, err := cursorPermission(rules.ActionDeny, reason)
+		return output, DecisionDeny, err
+	case "beforeSubmitPrompt":
+		output, err := cursorContinue(false, "⛔ BLOCKED: "+reason)
+		return output, DecisionBlock, err
+	default:
+		return "", "", nil
+	}
+}
+
+// cursorPermission renders the response to a before* hook. The reason is
+// shown to the user and passed on to the agent.
+func cursorPermission(action rules.Action, reason string) (string, error) {
+	response := map[string]interface{}{"permission": string(action)}
+	if reason != "" {
+		response["userMessage"] = reason
+		response["agentMessage"] = reason
+	}
+	jsonBytes, _ := json.Marshal(response)
+	return string(jsonBytes), nil
+}
+
+// cursorContinue renders the response to beforeSubmitPrompt
+func cursorContinue(proceed bool, message string) (string, error) {
+	response := map[string]interface{}{"continue": proceed}
+	if message != "" {
+		response["userMessage"] = message
+	}
+	jsonBytes, _ := json.Marshal(response)
+	return string(jsonBytes), nil
+}
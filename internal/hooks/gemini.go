@@ -0,0 +1,223 @@
+package hooks
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/wissem/cc-filter/internal/rules"
+)
+
+// GeminiHookProcessor answers Gemini CLI's hooks with the same rules as
+// Claude Code's. Gemini CLI sends session_id, cwd, tool_name and tool_input
+// like Claude Code, but names its events and tools differently and takes a
+// top-level "decision" of allow, deny or ask. Its SessionEnd is Claude
+// Code's and handled by ClaudeHookProcessor.
+type GeminiHookProcessor struct {
+	*ClaudeHookProcessor
+}
+
+func NewGeminiHookProcessor(rules *rules.Rules) *GeminiHookProcessor {
+	return &GeminiHookProcessor{ClaudeHookProcessor: NewClaudeHookProcessor(rules)}
+}
+
+func isGeminiEvent(input map[string]interface{}) bool {
+	switch event, _ := input["hook_event_name"].(string); event {
+	case "BeforeTool", "AfterTool", "BeforeAgent":
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *GeminiHookProcessor) Name() string {
+	return AgentGemini
+}
+
+func (p *GeminiHookProcessor) CanHandle(input map[string]interface{}) bool {
+	return isGeminiEvent(input)
+}
+
+func (p *GeminiHookProcessor) Process(input map[string]interface{}) (string, error) {
+	output, _, err := p.ProcessRecorded(input)
+	return output, err
+}
+
+// ProcessRecorded processes a hook and describes the decision it made
+func (p *GeminiHookProcessor) ProcessRecorded(input map[string]interface{}) (string, Record, error) {
+	call := &GeminiHookProcessor{ClaudeHookProcessor: p.forCall()}
+	call.record.Agent = AgentGemini
+	output, err := call.process(input)
+	return output, *call.record, err
+}
+
+func (p *GeminiHookProcessor) process(input map[string]interface{}) (string, error) {
+	ctx := newHookContext(input)
+	toolName, _ := input["tool_name"].(string)
+	toolInput, _ := input["tool_input"].(map[string]interface{})
+
+	switch input["hook_event_name"].(string) {
+	case "BeforeTool":
+		return p.processBeforeTool(ctx, toolName, toolInput)
+	case "AfterTool":
+		if toolName != "search_file_content" {
+			return "", nil
+		}
+		result := p.rules.FilterContent(toolResponseText(input["tool_response"]))
+		if !result.Filtered {
+			return "", nil
+		}
+		p.decide(DecisionRedact, result.MatchedPatterns...)
+		p.redacted(result.RedactedBytes)
+		return geminiDecision(rules.ActionDeny, redactedResultsReason(result))
+	case "BeforeAgent":
+		prompt, _ := input["prompt"].(string)
+		if message, blocked := p.checkPrompt(ctx, prompt); blocked {
+			return "", fmt.Errorf("%s", message)
+		}
+		return "", nil
+	default:
+		return "", nil
+	}
+}
+
+// processBeforeTool checks Gemini CLI's built-in tools. Older releases
+// name some arguments differently, so both spellings are read.
+func (p *GeminiHookProcessor) processBeforeTool(ctx hookContext, toolName string, toolInput map[string]interface{}) (string, error) {
+	switch toolName {
+	case "read_file":
+		filePath := firstString(toolInput, "file_path", "absolute_path")
+		p.target(filePath)
+		verdict, redactedPath := p.checkRead(ctx, toolName, filePath)
+		if verdict.Action != rules.ActionAllow {
+			return p.respond(ctx, toolName, filePath, verdict)
+		}
+		if redactedPath != "" {
+			p.decide(DecisionRedact)
+			return geminiDecision(rules.ActionDeny, redirectReason(filePath, redactedPath, readRangeFrom(toolInput)))
+		}
+	case "read_many_files":
+		return p.handleReadManyFiles(ctx, toolName, toolInput)
+	case "run_shell_command":
+		command, _ := toolInput["command"].(string)
+		verdict, selfOverride := p.checkCommand(command)
+		if selfOverride {
+			p.decide(DecisionDeny)
+			return geminiDecision(rules.ActionDeny, verdict.Reason)
+		}
+		if verdict.Action != rules.ActionAllow {
+			return p.respond(ctx, toolName, command, verdict)
+		}
+	case "search_file_content":
+		pattern, _ := toolInput["pattern"].(string)
+		path := firstString(toolInput, "dir_path", "path")
+		include, _ := toolInput["include"].(string)
+		p.target(path)
+		// matching lines are always returned, as with Grep's content mode
+		if verdict := p.checkSearch(ctx, toolName, pattern, path, include, "", true); verdict.Action != rules.ActionAllow {
+			return p.respond(ctx, toolName, pattern+"\x00"+path+"\x00"+include, verdict)
+		}
+	case "write_file", "replace":
+		filePath := firstString(toolInput, "file_path", "absolute_path")
+		p.target(filePath)
+		if verdict := p.checkWrite(ctx, filePath); verdict.Action != rules.ActionAllow {
+			return p.respond(ctx, toolName, filePath, verdict)
+		}
+	case "glob":
+		pattern, _ := toolInput["pattern"].(string)
+		path := firstString(toolInput, "dir_path", "path")
+		p.target(path)
+		if verdict := p.checkGlob(ctx, toolName, pattern, path); verdict.Action != rules.ActionAllow {
+			return p.respond(ctx, toolName, pattern+"\x00"+path, verdict)
+		}
+	}
+	return "", nil
+}
+
+// handleReadManyFiles checks every path and glob read_many_files is given.
+// One call cannot be redirected to several redacted copies, so when any
+// file needs redacting the agent is told to read the copies one by one.
+func (p *GeminiHookProcessor) handleReadManyFiles(ctx hookContext, toolName string, toolInput map[string]interface{}) (string, error) {
+	var copies []string
+	for _, path := range append(stringList(toolInput["paths"]), stringList(toolInput["include"])...) {
+		var verdict rules.Verdict
+		var redactedPath string
+		if strings.ContainsAny(path, "*?[{") {
+			verdict = p.checkGlob(ctx, toolName, path, "")
+		} else {
+			verdict, redactedPath = p.checkRead(ctx, toolName, path)
+		}
+		if verdict.Action != rules.ActionAllow {
+			p.target(path)
+			return p.respond(ctx, toolName, path, verdict)
+		}
+		if redactedPath != "" {
+			copies = append(copies, fmt.Sprintf("    %s (redacted copy of %s)", redactedPath, path))
+		}
+	}
+	if len(copies) == 0 {
+		return "", nil
+	}
+
+	p.decide(DecisionRedact)
+	return geminiDecision(rules.ActionDeny,
+		"SECRETS DETECTED - Some of these files contain sensitive data.\n\n"+
+			"Redacted versions have been created. Please read them with read_file instead:\n\n"+
+			strings.Join(copies, "\n"))
+}
+
+// respond turns a non-allow verdict into a Gemini CLI hook response
+func (p *GeminiHookProcessor) respond(ctx hookContext, tool, target string, verdict rules.Verdict) (string, error) {
+	action, reason := p.resolve(ctx, tool, target, verdict)
+	if action == rules.ActionAllow {
+		return "", nil
+	}
+	return geminiDecision(action, reason)
+}
+
+// Veto answers a hook with a plugin's stricter decision
+func (p *GeminiHookProcessor) Veto(input map[string]interface{}, action rules.Action, reason string) (string, string, error) {
+	switch input["hook_event_name"].(string) {
+	case "BeforeTool":
+		output, err := geminiDecision(action, reason)
+		return output, string(action), err
+	case "AfterTool":
+		// the tool has run; only its output can still be withheld
+		output, err := geminiDecision(rules.ActionDeny, reason)
+		return output, DecisionDeny, err
+	case "BeforeAgent":
+		return "", DecisionBlock, fmt.Errorf("⛔ BLOCKED: %s", reason)
+	default:
+		return "", "", nil
+	}
+}
+
+func geminiDecision(action rules.Action, reason string) (string, error) {
+	jsonBytes, _ := json.Marshal(map[string]interface{}{
+		"decision": string(action),
+		"reason":   reason,
+	})
+	return string(jsonBytes), nil
+}
+
+// firstString returns the first of keys that holds a non-empty string
+func firstString(values map[string]interface{}, keys ...string) string {
+	for _, key := range keys {
+		if value, _ := values[key].(string); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// stringList reads a JSON array of strings, skipping anything else
+func stringList(value interface{}) []string {
+	items, _ := value.([]interface{})
+	var list []string
+	for _, item := range items {
+		if s, ok := item.(string); ok && s != "" {
+			list = append(list, s)
+		}
+	}
+	return list
+}
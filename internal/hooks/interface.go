@@ -1,33 +1,140 @@
 package hooks
 
+import (
+	"fmt"
+	"strings"
+)
+
 type HookProcessor interface {
 	CanHandle(input map[string]interface{}) bool
 	Process(input map[string]interface{}) (string, error)
 }
 
+// NamedProcessor is a HookProcessor that names itself in a Record's
+// Contributions; others are named after their type
+type NamedProcessor interface {
+	HookProcessor
+	Name() string
+}
+
+// Registry runs every processor that can handle a hook, highest priority
+// first, and composes their answers into one
 type Registry struct {
-	processors []HookProcessor
+	processors []stage
+	composer   Composer
+	plugins    []*Plugin
+}
+
+// stage is a registered processor
+type stage struct {
+	processor HookProcessor
+	priority  int
 }
 
 func NewRegistry() *Registry {
 	return &Registry{
-		processors: make([]HookProcessor, 0),
+		processors: make([]stage, 0),
+		composer:   ComposeStrictest,
 	}
 }
 
+// Register adds a processor with priority 0
 func (r *Registry) Register(processor HookProcessor) {
-	r.processors = append(r.processors, processor)
+	r.RegisterPriority(processor, 0)
+}
+
+// RegisterPriority adds a processor that runs before those of a lower
+// priority and after those of the same priority registered earlier
+func (r *Registry) RegisterPriority(processor HookProcessor, priority int) {
+	i := len(r.processors)
+	for i > 0 && r.processors[i-1].priority < priority {
+		i--
+	}
+	r.processors = append(r.processors, stage{})
+	copy(r.processors[i+1:], r.processors[i:])
+	r.processors[i] = stage{processor: processor, priority: priority}
+}
+
+// SetComposer changes how the answers of several processors combine; nil
+// restores ComposeStrictest
+func (r *Registry) SetComposer(composer Composer) {
+	if composer == nil {
+		composer = ComposeStrictest
+	}
+	r.composer = composer
+}
+
+// Use adds a plugin consulted, after the others, on every answer of a
+// processor that can be vetoed
+func (r *Registry) Use(plugin *Plugin) {
+	r.plugins = append(r.plugins, plugin)
 }
 
 func (r *Registry) Process(input map[string]interface{}) (string, bool, error) {
-	for _, processor := range r.processors {
-		if processor.CanHandle(input) {
-			result, err := processor.Process(input)
-			if err != nil {
-				return "", true, err // Return the error, mark as handled
+	result, _, handled, err := r.ProcessRecorded(input)
+	return result, handled, err
+}
+
+// ProcessRecorded is Process, also describing the decision when the
+// processors that handled the input record their decisions
+func (r *Registry) ProcessRecorded(input map[string]interface{}) (string, Record, bool, error) {
+	var answers []Answer
+	for _, stage := range r.processors {
+		if !stage.processor.CanHandle(input) {
+			continue
+		}
+		answer := Answer{Processor: stage.processor, Name: processorName(stage.processor)}
+		if recording, ok := stage.processor.(RecordingProcessor); ok {
+			answer.Output, answer.Record, answer.Err = recording.ProcessRecorded(input)
+		} else {
+			answer.Output, answer.Err = stage.processor.Process(input)
+		}
+		answers = append(answers, answer)
+	}
+	if len(answers) == 0 {
+		return "", Record{}, false, nil
+	}
+
+	composed := answers[0]
+	if len(answers) > 1 {
+		composed = r.composer(input, answers)
+		composed.Record.Contributions = make([]Contribution, len(answers))
+		for i, answer := range answers {
+			composed.Record.Contributions[i] = Contribution{
+				Processor: answer.Name,
+				Decision:  answer.Decision(),
+				Rules:     answer.Record.Rules,
 			}
-			return result, true, nil
 		}
 	}
-	return "", false, nil
-}
\ No newline at end of file
+
+	result, record, err := composed.Output, composed.Record, composed.Err
+	if vetoable := vetoer(composed, answers); vetoable != nil && err == nil && len(r.plugins) > 0 {
+		result, record, err = r.consultPlugins(vetoable, input, result, record)
+	}
+	if err != nil {
+		return "", record, true, err // Return the error, mark as handled
+	}
+	return result, record, true, nil
+}
+
+// vetoer returns the processor that renders plugin vetoes: the one whose
+// answer was chosen, or else the first that can
+func vetoer(composed Answer, answers []Answer) VetoableProcessor {
+	if vetoable, ok := composed.Processor.(VetoableProcessor); ok {
+		return vetoable
+	}
+	for _, answer := range answers {
+		if vetoable, ok := answer.Processor.(VetoableProcessor); ok {
+			return vetoable
+		}
+	}
+	return nil
+}
+
+func processorName(processor HookProcessor) string {
+	if named, ok := processor.(NamedProcessor); ok {
+		return named.Name()
+	}
+	return strings.TrimPrefix(fmt.Sprintf("%T", processor), "*")
+}
@@ -0,0 +1,132 @@
+package hooks
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// overrideTTL bounds how long an unused grant stays valid
+const overrideTTL = time.Hour
+
+var overrideTokenPattern = regexp.MustCompile(`^ccf-[0-9a-f]{12}$`)
+
+// overrideToken identifies one denied access within a session. The same
+// tool touching the same target produces the same token, so a grant given
+// for it applies to the agent's retry.
+func overrideToken(sessionID, tool, target string) string {
+	hash := sha256.Sum256([]byte(sessionID + "\x00" + tool + "\x00" + target))
+	return fmt.Sprintf("ccf-%x", hash[:6])
+}
+
+func overrideDir() (string, error) {
+	dir := stateDir()
+	if dir == "" {
+		return "", errors.New("cannot locate the home directory")
+	}
+	return filepath.Join(dir, "overrides"), nil
+}
+
+// overrideKey returns the key grants are signed with, creating it when
+// create is set. It lives in cc-filter's directory, which no tool call may
+// touch, so a grant file the agent writes itself is not honoured.
+func overrideKey(create bool) ([]byte, error) {
+	dir := stateDir()
+	if dir == "" {
+		return nil, errors.New("cannot locate the home directory")
+	}
+	path := filepath.Join(dir, "override.key")
+	key, err := os.ReadFile(path)
+	if err == nil && len(key) == overrideKeySize {
+		return key, nil
+	}
+	if !create {
+		return nil, fmt.Errorf("no valid override key at %s", path)
+	}
+
+	key = make([]byte, overrideKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := ensurePrivateDir(dir); err != nil {
+		return nil, err
+	}
+	if _, err := writePrivateFile(dir, "override.key", key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+const overrideKeySize = 32
+
+// grantMAC is what a grant file for token must contain
+func grantMAC(key []byte, token string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(token))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// GrantOverride records the user's one-time approval for a denied access
+func GrantOverride(token string) error {
+	if !overrideTokenPattern.MatchString(token) {
+		return fmt.Errorf("invalid override token %q", token)
+	}
+
+	dir, err := overrideDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dir), 0700); err != nil {
+		return err
+	}
+	if err := ensurePrivateDir(dir); err != nil {
+		return err
+	}
+
+	key, err := overrideKey(true)
+	if err != nil {
+		return err
+	}
+	_, err = writePrivateFile(dir, token, []byte(grantMAC(key, token)+"\n"))
+	return err
+}
+
+// consumeOverride reports whether a grant exists for token, deleting it so
+// it can only be used once. Expired grants are removed without being honoured.
+func consumeOverride(token string) bool {
+	dir, err := overrideDir()
+	if err != nil {
+		return false
+	}
+
+	path := filepath.Join(dir, token)
+	info, err := os.Lstat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return false
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	if err := os.Remove(path); err != nil {
+		return false
+	}
+	if time.Since(info.ModTime()) > overrideTTL {
+		return false
+	}
+
+	// Only grants signed with the key, which the agent cannot read, count
+	key, err := overrideKey(false)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal([]byte(strings.TrimSpace(string(content))), []byte(grantMAC(key, token)))
+}
@@ -0,0 +1,96 @@
+package hooks
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/wissem/cc-filter/internal/rules"
+)
+
+// canonicalPath resolves path the way the filesystem will: relative paths
+// are joined to the hook's working directory, ".." and "." are cleaned away
+// and symlinks are followed. For paths that do not exist yet, the deepest
+// existing parent is resolved and the rest appended.
+func canonicalPath(cwd, path string) string {
+	if path == "" {
+		return ""
+	}
+	if !filepath.IsAbs(path) {
+		if cwd == "" {
+			if wd, err := os.Getwd(); err == nil {
+				cwd = wd
+			}
+		}
+		path = filepath.Join(cwd, path)
+	}
+	path = filepath.Clean(path)
+
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+
+	parent, rest := filepath.Dir(path), filepath.Base(path)
+	for parent != filepath.Dir(parent) {
+		if resolved, err := filepath.EvalSymlinks(parent); err == nil {
+			return filepath.Join(resolved, rest)
+		}
+		parent, rest = filepath.Dir(parent), filepath.Join(filepath.Base(parent), rest)
+	}
+	return path
+}
+
+// evaluatePath checks a path a tool is about to access against file_blocks.
+// Both the path as requested and its canonical form are evaluated, so neither
+// a symlink (notes.txt -> .env) nor a detour (src/../.env) changes the outcome.
+func (c *ClaudeHookProcessor) evaluatePath(ctx hookContext, tool, path string) (rules.Verdict, string) {
+	resolved := canonicalPath(ctx.Cwd, path)
+
+	verdict := stateDirVerdict(ctx.Cwd, path).Stricter(c.rules.EvaluateFile(path))
+	if resolved != path {
+		resolvedVerdict := c.rules.EvaluateFile(resolved)
+		resolvedVerdict.Reason = "Access denied to sensitive file: " + path + " (resolves to " + resolved + ")"
+		verdict = verdict.Stricter(resolvedVerdict)
+	}
+
+	if verdict.Action != rules.ActionAllow {
+		c.logger.Printf("%s %s: session=%s rule=%q requested=%q resolved=%q", tool, verdict.Action, ctx.SessionID, verdict.Rule, path, resolved)
+	}
+	return verdict, resolved
+}
+
+// stateDir is cc-filter's own directory, holding its configuration, logs
+// and override grants
+func stateDir() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(homeDir, ".cc-filter")
+}
+
+// stateDirVerdict denies any tool access to cc-filter's own directory, so the
+// agent can neither read the override key nor write a grant or a config.
+// No rule or override can lift it.
+func stateDirVerdict(cwd, path string) rules.Verdict {
+	dir := stateDir()
+	if dir == "" || path == "" {
+		return rules.Verdict{Action: rules.ActionAllow}
+	}
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		path = filepath.Join(filepath.Dir(dir), strings.TrimPrefix(path, "~"))
+	}
+	for _, candidate := range []string{canonicalPath(cwd, path), filepath.Clean(path)} {
+		for _, root := range []string{dir, canonicalPath("", dir)} {
+			if candidate == root || isWithinDir(candidate, root) {
+				return rules.Verdict{
+					Action: rules.ActionDeny,
+					Rule:   "~/.cc-filter",
+					Reason: "Access denied to cc-filter's own files: " + path,
+					Locked: true,
+				}
+			}
+		}
+	}
+	return rules.Verdict{Action: rules.ActionAllow}
+}
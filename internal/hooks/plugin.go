@@ -0,0 +1,221 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/wissem/cc-filter/internal/rules"
+)
+
+// Plugin runs an external program on a hook decision. The program speaks
+// JSON-RPC 2.0 over stdio: it is started for every call, reads one
+// "evaluate" request from stdin and writes one response to stdout.
+//
+//	→ {"jsonrpc":"2.0","id":1,"method":"evaluate","params":{"plugin":"ticket-gate",
+//	   "payload":{...hook payload...},"verdict":{"agent":"claude-code","decision":"allow","rules":[],"path":"/srv/customers/a.csv"}}}
+//	← {"jsonrpc":"2.0","id":1,"result":{"decision":"deny","reason":"no open ticket","annotations":{"ticket":"none"}}}
+//
+// A result's decision can only make cc-filter's stricter: "ask" or "deny"
+// overrule it, anything else leaves it. Annotations go to the audit log.
+type Plugin struct {
+	config rules.Plugin
+	logger *log.Logger
+}
+
+func NewPlugin(config rules.Plugin, logger *log.Logger) *Plugin {
+	if logger == nil {
+		logger = log.Default()
+	}
+	return &Plugin{config: config, logger: logger}
+}
+
+// PluginVerdict is a plugin's answer
+type PluginVerdict struct {
+	Decision    string            `json:"decision"`
+	Reason      string            `json:"reason"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+// VetoableProcessor is a RecordingProcessor whose answers plugins can
+// overrule
+type VetoableProcessor interface {
+	RecordingProcessor
+	// Veto answers input with a stricter action than the processor chose.
+	// decision is the Decision it comes to, "" when the hook event cannot
+	// be refused.
+	Veto(input map[string]interface{}, action rules.Action, reason string) (output, decision string, err error)
+}
+
+type pluginRequest struct {
+	JSONRPC string       `json:"jsonrpc"`
+	ID      int          `json:"id"`
+	Method  string       `json:"method"`
+	Params  pluginParams `json:"params"`
+}
+
+type pluginParams struct {
+	Plugin  string                 `json:"plugin"`
+	Payload map[string]interface{} `json:"payload"`
+	Verdict pluginRecord           `json:"verdict"`
+}
+
+// pluginRecord is the part of a Record a plugin sees
+type pluginRecord struct {
+	Agent    string   `json:"agent"`
+	Decision string   `json:"decision"`
+	Rules    []string `json:"rules"`
+	Path     string   `json:"path,omitempty"`
+}
+
+type pluginResponse struct {
+	JSONRPC string         `json:"jsonrpc"`
+	ID      *int           `json:"id"`
+	Result  *PluginVerdict `json:"result"`
+	Error   *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// Call asks the plugin about a decision. It runs in the hook's working
+// directory when that exists.
+func (p *Plugin) Call(input map[string]interface{}, record Record) (PluginVerdict, error) {
+	ruleNames := record.Rules
+	if ruleNames == nil {
+		ruleNames = []string{}
+	}
+	request, err := json.Marshal(pluginRequest{
+		JSONRPC: "2.0",
+		ID:      1,
+		Method:  "evaluate",
+		Params: pluginParams{
+			Plugin:  p.config.Name,
+			Payload: input,
+			Verdict: pluginRecord{Agent: record.Agent, Decision: record.Decision, Rules: ruleNames, Path: record.Path},
+		},
+	})
+	if err != nil {
+		return PluginVerdict{}, err
+	}
+
+	timeout := p.config.EffectiveTimeout()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, p.config.Command[0], p.config.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(append(request, '\n'))
+	// a plugin that leaves a child holding stdout open must not hang the hook
+	cmd.WaitDelay = 100 * time.Millisecond
+	if dir := WorkingDir(input); filepath.IsAbs(dir) {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			cmd.Dir = dir
+		}
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if ctx.Err() == context.DeadlineExceeded {
+		return PluginVerdict{}, fmt.Errorf("timed out after %s", timeout)
+	}
+	if err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return PluginVerdict{}, fmt.Errorf("%v: %s", err, firstLine(message))
+		}
+		return PluginVerdict{}, err
+	}
+
+	var response pluginResponse
+	if err := json.NewDecoder(bytes.NewReader(out)).Decode(&response); err != nil {
+		return PluginVerdict{}, fmt.Errorf("invalid response: %v", err)
+	}
+	switch {
+	case response.JSONRPC != "2.0" || response.ID == nil || *response.ID != 1:
+		return PluginVerdict{}, errors.New("invalid response: not a JSON-RPC 2.0 response to request 1")
+	case response.Error != nil:
+		return PluginVerdict{}, fmt.Errorf("error %d: %s", response.Error.Code, response.Error.Message)
+	case response.Result == nil:
+		return PluginVerdict{}, errors.New("invalid response: no result")
+	}
+	return *response.Result, nil
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
+
+// consultPlugins runs the registry's plugins, in order, on the answer a
+// processor gave, letting each overrule it with a stricter one
+func (r *Registry) consultPlugins(processor VetoableProcessor, input map[string]interface{}, output string, record Record) (string, Record, error) {
+	event, _ := input["hook_event_name"].(string)
+	for _, plugin := range r.plugins {
+		name := plugin.config.Name
+		if !plugin.config.Handles(event) {
+			continue
+		}
+
+		verdict, err := plugin.Call(input, record)
+		if err != nil {
+			plugin.logger.Printf("Plugin %s failed: %v", name, err)
+			if plugin.config.FailsOpen() {
+				continue
+			}
+			verdict = PluginVerdict{
+				Decision: string(rules.ActionDeny),
+				Reason:   fmt.Sprintf("cc-filter plugin %q failed (%v) and is configured to fail closed", name, err),
+			}
+		}
+		if len(verdict.Annotations) > 0 {
+			if record.Annotations == nil {
+				record.Annotations = make(map[string]map[string]string)
+			}
+			record.Annotations[name] = verdict.Annotations
+		}
+
+		action := rules.Action(verdict.Decision)
+		if action != rules.ActionAsk && action != rules.ActionDeny {
+			continue
+		}
+		if decisionSeverity(record.Decision) >= decisionSeverity(verdict.Decision) {
+			continue
+		}
+		reason := verdict.Reason
+		if reason == "" {
+			reason = fmt.Sprintf("Refused by cc-filter plugin %q", name)
+		}
+		vetoed, decision, vetoErr := processor.Veto(input, action, reason)
+		if decision == "" {
+			continue
+		}
+		record.Decision = decision
+		record.Rules = append(record.Rules, "plugin:"+name)
+		output, err = vetoed, vetoErr
+		if err != nil {
+			return "", record, err
+		}
+	}
+	return output, record, nil
+}
+
+// decisionSeverity orders decisions by how much they refuse. A redaction
+// ranks with ask: asking instead would let the user approve the original.
+func decisionSeverity(decision string) int {
+	switch decision {
+	case DecisionDeny, DecisionBlock:
+		return 2
+	case DecisionAsk, DecisionRedact:
+		return 1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,139 @@
+package hooks
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wissem/cc-filter/internal/rules"
+)
+
+// writePlugin writes a shell script plugin and returns its config
+func writePlugin(t *testing.T, name, script string) rules.Plugin {
+	t.Helper()
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("plugins are tested with sh scripts")
+	}
+	path := filepath.Join(t.TempDir(), name+".sh")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return rules.Plugin{Name: name, Command: []string{"sh", path}}
+}
+
+func pluginRegistry(t *testing.T, plugins ...rules.Plugin) *Registry {
+	t.Helper()
+	registry := agentRegistry(t, t.TempDir())
+	for _, plugin := range plugins {
+		registry.Use(NewPlugin(plugin, log.New(os.Stderr, "", 0)))
+	}
+	return registry
+}
+
+func TestPluginsVetoAndAnnotate(t *testing.T) {
+	requests := filepath.Join(t.TempDir(), "requests")
+	veto := writePlugin(t, "ticket-gate", `cat > `+requests+`
+case "$(cat `+requests+`)" in
+  *customers*) echo '{"jsonrpc":"2.0","id":1,"result":{"decision":"deny","reason":"no open ticket for customer data","annotations":{"ticket":"none"}}}' ;;
+  *) echo '{"jsonrpc":"2.0","id":1,"result":{"decision":"allow","annotations":{"ticket":"OPS-1"}}}' ;;
+esac`)
+	registry := pluginRegistry(t, veto)
+
+	read := func(path string) map[string]interface{} {
+		return map[string]interface{}{
+			"session_id": "s1", "hook_event_name": "PreToolUse", "tool_name": "Read",
+			"tool_input": map[string]interface{}{"file_path": path},
+		}
+	}
+
+	output, record, _, err := registry.ProcessRecorded(read("/srv/customers/acme.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Decision != DecisionDeny || !strings.Contains(output, "no open ticket") || record.Annotations["ticket-gate"]["ticket"] != "none" {
+		t.Errorf("veto: record %+v, output %s", record, output)
+	}
+	if want := []string{"plugin:ticket-gate"}; strings.Join(record.Rules, ",") != strings.Join(want, ",") {
+		t.Errorf("rules = %v, want %v", record.Rules, want)
+	}
+
+	data, _ := os.ReadFile(requests)
+	var request struct {
+		JSONRPC string `json:"jsonrpc"`
+		Method  string `json:"method"`
+		Params  struct {
+			Plugin  string                 `json:"plugin"`
+			Payload map[string]interface{} `json:"payload"`
+			Verdict pluginRecord           `json:"verdict"`
+		} `json:"params"`
+	}
+	if err := json.Unmarshal(data, &request); err != nil {
+		t.Fatalf("request %s: %v", data, err)
+	}
+	if request.JSONRPC != "2.0" || request.Method != "evaluate" || request.Params.Plugin != "ticket-gate" ||
+		request.Params.Payload["tool_name"] != "Read" || request.Params.Verdict.Decision != DecisionAllow || request.Params.Verdict.Agent != AgentClaudeCode {
+		t.Errorf("request = %s", data)
+	}
+
+	// allow cannot loosen cc-filter's own denial, but annotations are kept
+	output, record, _, _ = registry.ProcessRecorded(read("/app/.env"))
+	if record.Decision != DecisionDeny || !strings.Contains(output, "Access denied") || record.Annotations["ticket-gate"]["ticket"] != "OPS-1" {
+		t.Errorf("allow over deny: record %+v, output %s", record, output)
+	}
+
+	// other agents' answers are vetoed in their own schema
+	output, record, _, _ = registry.ProcessRecorded(map[string]interface{}{
+		"conversation_id": "c1", "hook_event_name": "beforeReadFile", "file_path": "/srv/customers/acme.csv",
+	})
+	if record.Decision != DecisionDeny || !strings.Contains(output, `"permission":"deny"`) {
+		t.Errorf("cursor veto: record %+v, output %s", record, output)
+	}
+}
+
+func TestPluginFailures(t *testing.T) {
+	prompt := map[string]interface{}{"session_id": "s1", "hook_event_name": "UserPromptSubmit", "prompt": "hello"}
+	tool := map[string]interface{}{
+		"session_id": "s1", "hook_event_name": "PreToolUse", "tool_name": "Glob",
+		"tool_input": map[string]interface{}{"pattern": "src/*.go"},
+	}
+
+	tests := []struct {
+		name   string
+		script string
+		setup  func(*rules.Plugin)
+		input  map[string]interface{}
+		want   string // the decision
+	}{
+		{"exit status fails closed", `echo boom >&2; exit 3`, nil, tool, DecisionDeny},
+		{"invalid response fails closed", `echo not json`, nil, tool, DecisionDeny},
+		{"rpc error fails closed", `echo '{"jsonrpc":"2.0","id":1,"error":{"code":-32000,"message":"tracker unavailable"}}'`, nil, tool, DecisionDeny},
+		{"timeout fails closed", `sleep 5`, func(p *rules.Plugin) { p.Timeout = 100 * time.Millisecond }, tool, DecisionDeny},
+		{"fail open", `exit 1`, func(p *rules.Plugin) { p.OnError = rules.PluginFailOpen }, tool, DecisionAllow},
+		{"prompts are blocked", `exit 1`, nil, prompt, DecisionBlock},
+		{"other events are skipped", `exit 1`, func(p *rules.Plugin) { p.Events = []string{"PostToolUse"} }, tool, DecisionAllow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plugin := writePlugin(t, "flaky", tt.script)
+			if tt.setup != nil {
+				tt.setup(&plugin)
+			}
+			start := time.Now()
+			_, record, _, err := pluginRegistry(t, plugin).ProcessRecorded(tt.input)
+			if record.Decision != tt.want {
+				t.Errorf("decision = %q, want %q (err %v)", record.Decision, tt.want, err)
+			}
+			if tt.want == DecisionBlock && err == nil {
+				t.Error("blocked prompt without an error")
+			}
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Errorf("took %s", elapsed)
+			}
+		})
+	}
+}
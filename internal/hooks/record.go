@@ -0,0 +1,90 @@
+package hooks
+
+// Record describes one hook decision for the audit log
+type Record struct {
+	Agent    string   // the agent whose hook was answered, see the Agent constants
+	Decision string   // one of the Decision constants
+	Rules    []string // the entries or patterns behind the decision, when known
+	Path     string   // the file or directory the tool call targets, if any
+
+	// Session and Tool are set when the payload names them other than
+	// session_id and tool_name
+	Session string
+	Tool    string
+
+	// RedactedBytes is how much of the tool's output or file was redacted
+	RedactedBytes int
+
+	// Annotations are what plugins added to the decision, by plugin name
+	Annotations map[string]map[string]string
+
+	// Contributions are the answers of every processor that handled the
+	// hook, in priority order, when there were several
+	Contributions []Contribution
+}
+
+// Contribution is one processor's part in a composed decision
+type Contribution struct {
+	Processor string   `json:"processor"`
+	Decision  string   `json:"decision"`
+	Rules     []string `json:"rules,omitempty"`
+}
+
+// Decisions a Record can carry
+const (
+	DecisionAllow    = "allow"
+	DecisionAsk      = "ask"
+	DecisionDeny     = "deny"
+	DecisionRedact   = "redact"   // the agent only sees a redacted copy
+	DecisionBlock    = "block"    // a prompt was blocked
+	DecisionOverride = "override" // a denial was lifted by a one-time override
+)
+
+// Agents a Record can name
+const (
+	AgentClaudeCode = "claude-code"
+	AgentCursor     = "cursor"
+	AgentGemini     = "gemini-cli"
+	AgentCodex      = "codex"
+)
+
+// RecordingProcessor is a HookProcessor that also describes its decisions
+type RecordingProcessor interface {
+	HookProcessor
+	ProcessRecorded(input map[string]interface{}) (string, Record, error)
+}
+
+// forCall returns a copy of the processor that records one call's decision.
+// Processors are shared between calls, so the record cannot live on them.
+func (c *ClaudeHookProcessor) forCall() *ClaudeHookProcessor {
+	call := *c
+	call.record = &Record{Agent: AgentClaudeCode, Decision: DecisionAllow}
+	return &call
+}
+
+// decide records the decision of the current call and the rules behind it
+func (c *ClaudeHookProcessor) decide(decision string, rules ...string) {
+	if c.record == nil {
+		return
+	}
+	c.record.Decision = decision
+	for _, rule := range rules {
+		if rule != "" {
+			c.record.Rules = append(c.record.Rules, rule)
+		}
+	}
+}
+
+// redacted records how many bytes the current call redacted
+func (c *ClaudeHookProcessor) redacted(n int) {
+	if c.record != nil {
+		c.record.RedactedBytes += n
+	}
+}
+
+// target records the path the current call's tool targets
+func (c *ClaudeHookProcessor) target(path string) {
+	if c.record != nil && path != "" {
+		c.record.Path = path
+	}
+}
@@ -0,0 +1,164 @@
+package hooks
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+
+	"github.com/wissem/cc-filter/internal/rules"
+)
+
+// maxExpandedEntries caps how much of the filesystem is walked when expanding
+// a search's file set. Larger trees cannot be vouched for, so searching them
+// needs the user's approval.
+const maxExpandedEntries = 2000
+
+var errExpansionTooLarge = errors.New("file set too large to expand")
+
+// skippedDirs are never descended into while expanding a file set. Only
+// version control metadata is skipped: vendored trees such as vendor and
+// node_modules can hold real .env files and keys, so they are checked too.
+var skippedDirs = map[string]bool{
+	".git": true,
+	".hg":  true,
+	".svn": true,
+}
+
+// searchTypeGlobs maps ripgrep --type names whose extensions differ from the
+// type name; any other type T is treated as *.T
+var searchTypeGlobs = map[string]string{
+	"js":       "*.{js,jsx,mjs,cjs}",
+	"ts":       "*.{ts,tsx,cts,mts}",
+	"py":       "*.{py,pyi}",
+	"yaml":     "*.{yaml,yml}",
+	"markdown": "*.{md,markdown}",
+	"md":       "*.{md,markdown}",
+	"ruby":     "*.{rb,gemspec}",
+	"rust":     "*.rs",
+	"shell":    "*.{sh,bash,zsh}",
+	"sh":       "*.{sh,bash,zsh}",
+	"config":   "*.{cfg,conf,config,ini}",
+}
+
+func searchTypeGlob(fileType string) string {
+	if glob, ok := searchTypeGlobs[strings.ToLower(fileType)]; ok {
+		return glob
+	}
+	return "*." + fileType
+}
+
+// evaluateGlob decides whether a glob pattern targets blocked files. It
+// checks the pattern itself as a path and every file_blocks entry as a
+// sample file name, so "*.pem", "**/.env*" and "certs/*.key" are all caught.
+func (c *ClaudeHookProcessor) evaluateGlob(glob string) rules.Verdict {
+	reason := "Pattern may expose sensitive files: " + glob
+
+	verdict := c.rules.EvaluateFile(strings.NewReplacer("**/", "", "*", "x", "?", "x").Replace(glob))
+	if verdict.Action != rules.ActionAllow {
+		verdict.Reason = reason
+	}
+
+	for _, blocked := range c.rules.FileBlocks {
+		if strings.HasPrefix(blocked, "!") {
+			continue
+		}
+		sample := strings.Trim(strings.ReplaceAll(blocked, "*", "x"), "/")
+		if rules.MatchGlob(glob, sample) || rules.MatchGlob(glob, "x/"+sample) {
+			verdict = verdict.Stricter(rules.Verdict{
+				Action: c.rules.ActionFor(blocked),
+				Rule:   blocked,
+				Reason: reason,
+			})
+		}
+	}
+
+	return verdict
+}
+
+// globBase returns the directory a glob pattern starts from: its segments
+// up to the first with a wildcard
+func globBase(pattern string) string {
+	segments := strings.Split(pattern, "/")
+	for i, segment := range segments {
+		if strings.ContainsAny(segment, "*?[{") {
+			return strings.Join(segments[:i], "/")
+		}
+	}
+	return pattern
+}
+
+// evaluateFileSet expands the files a search would read under root and
+// evaluates each of them. A tree too large to expand is asked about.
+func (c *ClaudeHookProcessor) evaluateFileSet(root string, globs []string) rules.Verdict {
+	verdict := rules.Verdict{Action: rules.ActionAllow}
+	visited := 0
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		visited++
+		if visited > maxExpandedEntries {
+			return errExpansionTooLarge
+		}
+		if d.IsDir() {
+			if path != root && skippedDirs[d.Name()] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return nil
+		}
+		if !matchesAnyGlob(globs, filepath.ToSlash(rel)) {
+			return nil
+		}
+
+		if fileVerdict := c.rules.EvaluateFile(path); fileVerdict.Action != rules.ActionAllow {
+			verdict = verdict.Stricter(fileVerdict)
+		}
+		return nil
+	})
+	if errors.Is(err, errExpansionTooLarge) {
+		return verdict.Stricter(rules.Verdict{
+			Action: rules.ActionAsk,
+			Reason: fmt.Sprintf("Search covers more than %d files, too many to check for sensitive ones. Narrow it with a path, glob or type, or confirm to search them all.", maxExpandedEntries),
+		})
+	}
+
+	return verdict
+}
+
+// matchesAnyGlob applies ripgrep's rule that a glob without a slash matches
+// the base name at any depth. An empty list matches everything.
+func matchesAnyGlob(globs []string, rel string) bool {
+	if len(globs) == 0 {
+		return true
+	}
+	for _, glob := range globs {
+		if !strings.Contains(glob, "/") {
+			if rules.MatchGlob(glob, filepath.Base(rel)) {
+				return true
+			}
+		} else if rules.MatchGlob(glob, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveSearchPath makes a tool's path argument absolute against the
+// session's working directory, defaulting to the working directory itself
+func resolveSearchPath(ctx hookContext, path string) string {
+	if path == "" {
+		return ctx.Cwd
+	}
+	if !filepath.IsAbs(path) && ctx.Cwd != "" {
+		return filepath.Join(ctx.Cwd, path)
+	}
+	return path
+}
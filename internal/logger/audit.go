@@ -0,0 +1,106 @@
+package logger
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// AuditOff disables the audit log when given as its path
+const AuditOff = "off"
+
+// DefaultAuditFile returns ~/.cc-filter/audit.jsonl, or "" without a home directory
+func DefaultAuditFile() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(homeDir, ".cc-filter", "audit.jsonl")
+}
+
+// OpenAudit returns a logger writing one JSON object per line to path. An
+// empty path means DefaultAuditFile, "-" means stderr and AuditOff returns
+// nil. The file is private to the user, as it lists the paths the agent
+// touched, and rotated as rotation says.
+func OpenAudit(path string, rotation Rotation) (*slog.Logger, error) {
+	if path == AuditOff {
+		return nil, nil
+	}
+	if path == "-" {
+		return slog.New(slog.NewJSONHandler(os.Stderr, nil)), nil
+	}
+	if path == "" {
+		if path = DefaultAuditFile(); path == "" {
+			return nil, nil
+		}
+	}
+
+	file, err := openRotating(path, rotation)
+	if err != nil {
+		return nil, err
+	}
+	return slog.New(slog.NewJSONHandler(file, nil)), nil
+}
+
+// DefaultKeyFile returns ~/.cc-filter/fingerprint.key, or "" without a home
+// directory
+func DefaultKeyFile() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(homeDir, ".cc-filter", "fingerprint.key")
+}
+
+// FingerprintKey returns the secret key the logs' fingerprints are keyed
+// with, creating a random one at path on first use. Without a stable key,
+// fingerprints could only be compared within one run; without a secret one,
+// a short secret could be recovered from its fingerprint by guessing.
+func FingerprintKey(path string) ([]byte, error) {
+	if key, err := readKey(path); err == nil || !errors.Is(err, fs.ErrNotExist) {
+		return key, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if errors.Is(err, fs.ErrExist) {
+		// another cc-filter created it first
+		return readKey(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	_, err = file.WriteString(hex.EncodeToString(key) + "\n")
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+	return key, nil
+}
+
+func readKey(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) < 16 {
+		return nil, fmt.Errorf("invalid fingerprint key in %s", path)
+	}
+	return key, nil
+}
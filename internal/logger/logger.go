@@ -1,28 +1,82 @@
 package logger
 
 import (
+	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"sync/atomic"
 )
 
-func Setup() {
+// DefaultLogFile returns ~/.cc-filter/filter.log, or "" without a home directory
+func DefaultLogFile() string {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
-		return
+		return ""
 	}
-	
-	logDir := filepath.Join(homeDir, ".cc-filter")
-	if err := os.MkdirAll(logDir, 0755); err != nil {
+	return filepath.Join(homeDir, ".cc-filter", "filter.log")
+}
+
+// Setup sends the standard logger to logFile, creating its directory. An
+// empty logFile means DefaultLogFile, and "-" means stderr. The file is
+// private to the user and rotated as rotation says. Every line passes
+// through the redactor set with SetRedactor.
+func Setup(logFile string, rotation Rotation) {
+	if logFile == "-" {
+		log.SetOutput(&redactingWriter{w: os.Stderr})
+		log.SetFlags(log.LstdFlags)
 		return
 	}
-	
-	logFile := filepath.Join(logDir, "filter.log")
-	file, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if logFile == "" {
+		if logFile = DefaultLogFile(); logFile == "" {
+			return
+		}
+	}
+
+	file, err := openRotating(logFile, rotation)
 	if err != nil {
 		return
 	}
-	
-	log.SetOutput(file)
+
+	log.SetOutput(&redactingWriter{w: file})
 	log.SetFlags(log.LstdFlags)
-}
\ No newline at end of file
+}
+
+// redactor scrubs log lines before they are written; see SetRedactor
+var redactor atomic.Pointer[func(string) string]
+
+// SetRedactor makes every line the standard logger writes pass through
+// redact, so log messages never carry what the rules would have filtered
+func SetRedactor(redact func(string) string) {
+	redactor.Store(&redact)
+}
+
+// NewRedactingWriter returns a writer passing each write through redact
+// before writing it to w. Loggers write one line per call, so a secret is
+// never split between two writes.
+func NewRedactingWriter(w io.Writer, redact func(string) string) io.Writer {
+	return &redactingWriter{w: w, redact: redact}
+}
+
+// redactingWriter passes writes through redact, or through the redactor set
+// with SetRedactor when redact is nil
+type redactingWriter struct {
+	w      io.Writer
+	redact func(string) string
+}
+
+func (r *redactingWriter) Write(p []byte) (int, error) {
+	redact := r.redact
+	if redact == nil {
+		if set := redactor.Load(); set != nil {
+			redact = *set
+		}
+	}
+	if redact != nil {
+		if _, err := io.WriteString(r.w, redact(string(p))); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	return r.w.Write(p)
+}
@@ -0,0 +1,261 @@
+package logger
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rotation bounds how much log history is kept. A log is rotated once it
+// reaches MaxSize, and on the first write of a new day, so each rotated file
+// covers at most one day. Rotated files are gzipped next to the log as
+// NAME-TIMESTAMP.EXT.gz once no writer can still be appending to them.
+type Rotation struct {
+	MaxSize    int64         // bytes; 0 means no size limit
+	MaxAge     time.Duration // rotated files older than this are deleted; 0 keeps them
+	MaxBackups int           // at most this many rotated files are kept; 0 keeps them all
+}
+
+// DefaultRotation is used when no rotation options are given
+var DefaultRotation = Rotation{
+	MaxSize:    10 << 20,
+	MaxAge:     30 * 24 * time.Hour,
+	MaxBackups: 50,
+}
+
+// backupTimeFormat names rotated files; it sorts in time order and avoids
+// characters Windows does not allow in file names
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// compressAfter is how long a rotated file must go unwritten before it is
+// compressed. Every writer moves to the new log on its next write, so only
+// a write already under way when the log was moved can still land in it.
+const compressAfter = time.Minute
+
+// rotatingFile is a log file that rotates itself as it is written. Many
+// cc-filter processes append to the same log at once, so before each write
+// it checks the log is still the file it opened: if another process rotated
+// it, it reopens rather than keep appending to the rotated file.
+type rotatingFile struct {
+	path     string
+	rotation Rotation
+
+	mu   sync.Mutex
+	file *os.File
+	info os.FileInfo // of file, to notice the log being moved
+	size int64
+	day  string // the day of the last write, as YYYY-MM-DD
+	now  func() time.Time
+}
+
+// openRotating opens path for appending, creating it and its directory
+// private to the user, and rotates it first if it is already due
+func openRotating(path string, rotation Rotation) (*rotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	f := &rotatingFile{path: path, rotation: rotation, now: time.Now}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	if f.due(0) {
+		f.rotate()
+	}
+	return f, nil
+}
+
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	// logs written by older versions were readable by everyone
+	file.Chmod(0600)
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.info, f.size = file, info, info.Size()
+	f.day = info.ModTime().Format(time.DateOnly)
+	if f.size == 0 {
+		f.day = f.now().Format(time.DateOnly)
+	}
+	return nil
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.moved() {
+		f.reopen()
+	}
+	if f.due(int64(len(p))) {
+		f.rotate()
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// due reports whether writing n more bytes should start a new file
+func (f *rotatingFile) due(n int64) bool {
+	if f.size == 0 {
+		return false
+	}
+	if f.rotation.MaxSize > 0 && f.size+n > f.rotation.MaxSize {
+		return true
+	}
+	return f.day != f.now().Format(time.DateOnly)
+}
+
+// moved reports whether the log is no longer the file this writer has open
+func (f *rotatingFile) moved() bool {
+	current, err := os.Stat(f.path)
+	return err != nil || !os.SameFile(f.info, current)
+}
+
+// reopen switches to the file now at the log's path, keeping the old one
+// if that fails
+func (f *rotatingFile) reopen() {
+	old, oldInfo, oldSize, oldDay := f.file, f.info, f.size, f.day
+	if err := f.open(); err != nil {
+		f.file, f.info, f.size, f.day = old, oldInfo, oldSize, oldDay
+		return
+	}
+	old.Close()
+}
+
+// rotate moves the log aside, compresses rotated files no one writes to
+// any more and prunes old ones. A rotated file written to in the last
+// compressAfter is left as it is, since a process may still be appending
+// to it. Failures leave the current file in use: losing rotation is better
+// than losing log lines.
+func (f *rotatingFile) rotate() {
+	now := f.now()
+	opened, err := f.file.Stat()
+	if err != nil {
+		return
+	}
+	backup := f.backupName(now)
+	current, err := os.Stat(f.path)
+	rotated := err == nil && os.SameFile(opened, current) && os.Rename(f.path, backup) == nil
+
+	f.file.Close()
+	if err := f.open(); err != nil {
+		// keep writing to the old file rather than dropping lines
+		if !rotated {
+			backup = f.path
+		}
+		f.file, _ = os.OpenFile(backup, os.O_WRONLY|os.O_APPEND, 0600)
+		return
+	}
+	f.compressIdle(now)
+	f.prune(now)
+}
+
+// backupName returns where the log is moved to when rotated at t
+func (f *rotatingFile) backupName(t time.Time) string {
+	ext := filepath.Ext(f.path)
+	return strings.TrimSuffix(f.path, ext) + "-" + t.Format(backupTimeFormat) + ext
+}
+
+// compressIdle compresses the rotated files that have not been written to
+// for compressAfter
+func (f *rotatingFile) compressIdle(now time.Time) {
+	for _, name := range Rotated(f.path) {
+		if strings.HasSuffix(name, ".gz") {
+			continue
+		}
+		if info, err := os.Stat(name); err == nil && now.Sub(info.ModTime()) > compressAfter {
+			f.compress(name)
+		}
+	}
+}
+
+// compress gzips a rotated file in place of the original
+func (f *rotatingFile) compress(name string) {
+	src, err := os.Open(name)
+	if err != nil {
+		return
+	}
+	defer src.Close()
+
+	tmp := name + ".gz.tmp"
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return
+	}
+	zw := gzip.NewWriter(dst)
+	_, err = io.Copy(zw, src)
+	if closeErr := zw.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, name+".gz")
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return
+	}
+	os.Remove(name)
+}
+
+// prune deletes rotated files beyond MaxBackups or older than MaxAge
+func (f *rotatingFile) prune(now time.Time) {
+	backups := Rotated(f.path)
+	// newest first
+	sort.Sort(sort.Reverse(sort.StringSlice(backups)))
+
+	for i, name := range backups {
+		expired := f.rotation.MaxBackups > 0 && i >= f.rotation.MaxBackups
+		if !expired && f.rotation.MaxAge > 0 {
+			info, err := os.Stat(name)
+			expired = err == nil && now.Sub(info.ModTime()) > f.rotation.MaxAge
+		}
+		if expired {
+			os.Remove(name)
+		}
+	}
+}
+
+// Rotated lists the rotated files of the log at path, compressed or not,
+// oldest first
+func Rotated(path string) []string {
+	ext := filepath.Ext(path)
+	prefix := filepath.Base(strings.TrimSuffix(path, ext)) + "-"
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		return nil
+	}
+
+	var names []string
+	for _, entry := range entries {
+		name := entry.Name()
+		stamp, ok := strings.CutPrefix(name, prefix)
+		if !ok {
+			continue
+		}
+		stamp, ok = strings.CutSuffix(strings.TrimSuffix(stamp, ".gz"), ext)
+		if !ok {
+			continue
+		}
+		if _, err := time.Parse(backupTimeFormat, stamp); err != nil {
+			continue
+		}
+		names = append(names, filepath.Join(filepath.Dir(path), name))
+	}
+	// the timestamps sort in time order
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,129 @@
+package logger
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotatingFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "filter.log")
+	os.WriteFile(path, []byte("written by an older version\n"), 0644)
+
+	now := time.Now()
+	f, err := openRotating(path, Rotation{MaxSize: 64, MaxBackups: 2})
+	if err != nil {
+		t.Fatalf("openRotating: %v", err)
+	}
+	f.now = func() time.Time { return now }
+
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("log mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	line := strings.Repeat("x", 39) + "\n"
+	for i := 0; i < 4; i++ {
+		now = now.Add(time.Second)
+		f.Write([]byte(line))
+	}
+	// the next day starts a new file however small the log is
+	now = now.Add(24 * time.Hour)
+	f.Write([]byte("tomorrow\n"))
+
+	backups := Rotated(path)
+	if len(backups) != 2 {
+		t.Fatalf("backups = %v, want the 2 newest kept", backups)
+	}
+	for _, name := range backups {
+		if !strings.HasSuffix(name, ".log.gz") {
+			t.Errorf("%s is not compressed", name)
+		}
+		if info, _ := os.Stat(name); info.Mode().Perm() != 0600 {
+			t.Errorf("%s mode = %v, want 0600", name, info.Mode().Perm())
+		}
+	}
+	if got := gunzip(t, backups[len(backups)-1]); got != line {
+		t.Errorf("newest backup = %q, want %q", got, line)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "tomorrow\n" {
+		t.Errorf("log = %q, want only today's line", data)
+	}
+}
+
+func TestRotatingFileKeepsOtherWritersLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "filter.log")
+	rotation := Rotation{MaxSize: 64}
+	first, err := openRotating(path, rotation)
+	if err != nil {
+		t.Fatalf("openRotating: %v", err)
+	}
+	second, err := openRotating(path, rotation)
+	if err != nil {
+		t.Fatalf("openRotating: %v", err)
+	}
+
+	first.Write([]byte(strings.Repeat("x", 59) + "\n"))
+	first.Write([]byte("rotated by first\n"))
+	second.Write([]byte("written by second\n"))
+
+	backups := Rotated(path)
+	if len(backups) != 1 || strings.HasSuffix(backups[0], ".gz") {
+		t.Fatalf("backups = %v, want one left uncompressed while it may still be written", backups)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "rotated by first\nwritten by second\n" {
+		t.Errorf("log = %q, the second writer should follow the rotation", data)
+	}
+
+	// once the backup has gone unwritten long enough the next rotation compresses it
+	first.now = func() time.Time { return time.Now().Add(2 * compressAfter) }
+	first.Write([]byte(strings.Repeat("y", 63) + "\n"))
+	if got := gunzip(t, backups[0]+".gz"); got != strings.Repeat("x", 59)+"\n" {
+		t.Errorf("compressed backup = %q", got)
+	}
+}
+
+func TestRotatingFilePrunesByAge(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audit.jsonl")
+	now := time.Now()
+
+	old := filepath.Join(dir, "audit-"+now.AddDate(0, 0, -40).Format(backupTimeFormat)+".jsonl.gz")
+	recent := filepath.Join(dir, "audit-"+now.AddDate(0, 0, -2).Format(backupTimeFormat)+".jsonl.gz")
+	unrelated := filepath.Join(dir, "audit-notes.jsonl")
+	for _, name := range []string{old, recent, unrelated} {
+		os.WriteFile(name, []byte("{}\n"), 0600)
+	}
+	os.Chtimes(old, now.AddDate(0, 0, -40), now.AddDate(0, 0, -40))
+
+	f := &rotatingFile{path: path, rotation: Rotation{MaxAge: 30 * 24 * time.Hour}}
+	f.prune(now)
+
+	for name, kept := range map[string]bool{old: false, recent: true, unrelated: true} {
+		if _, err := os.Stat(name); (err == nil) != kept {
+			t.Errorf("%s kept = %v, want %v", filepath.Base(name), err == nil, kept)
+		}
+	}
+}
+
+func gunzip(t *testing.T, name string) string {
+	t.Helper()
+	file, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	zr, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
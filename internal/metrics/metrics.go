@@ -0,0 +1,260 @@
+// Package metrics counts cc-filter's decisions for Prometheus. cc-filter
+// runs once per hook, so counts are kept in a node-exporter textfile that
+// every run adds its own to (see UpdateTextfile), and "cc-filter metrics
+// serve" exposes the same file over HTTP.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wissem/cc-filter/internal/hooks"
+)
+
+// Metric names
+const (
+	HookInvocations   = "cc_filter_hook_invocations_total"
+	RuleHits          = "cc_filter_rule_hits_total"
+	RedactedBytes     = "cc_filter_redacted_bytes_total"
+	ProcessingSeconds = "cc_filter_processing_seconds"
+)
+
+// latencyBuckets are the upper bounds of the processing time histogram, in
+// seconds. Most decisions take well under a millisecond; loading configs
+// and redacting large files take longer.
+var latencyBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5}
+
+// families describes every metric, in the order they are written
+var families = []struct {
+	name, kind, help string
+}{
+	{HookInvocations, "counter", "Inputs cc-filter decided on, by hook event, tool and decision. Plain text has event \"text\"."},
+	{RuleHits, "counter", "Decisions other than allow, by the rule or pattern behind them."},
+	{RedactedBytes, "counter", "Bytes of tool output, files and plain text replaced by redaction."},
+	{ProcessingSeconds, "histogram", "Time taken to decide on an input, by hook event."},
+}
+
+// Metrics holds counters and histograms. It is safe for concurrent use.
+type Metrics struct {
+	mu     sync.Mutex
+	series map[string]float64 // by series key, see seriesKey
+}
+
+func New() *Metrics {
+	return &Metrics{series: map[string]float64{}}
+}
+
+// Decision is one decision to count
+type Decision struct {
+	Event, Tool, Decision string
+	Rules                 []string
+	RedactedBytes         int64
+	Latency               time.Duration
+}
+
+// Observe counts one decision
+func (m *Metrics) Observe(d Decision) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.series[seriesKey(HookInvocations, "event", d.Event, "tool", d.Tool, "decision", d.Decision)]++
+	if d.Decision != hooks.DecisionAllow {
+		for _, rule := range d.Rules {
+			m.series[seriesKey(RuleHits, "rule", rule)]++
+		}
+	}
+	m.series[seriesKey(RedactedBytes)] += float64(d.RedactedBytes)
+
+	seconds := d.Latency.Seconds()
+	for _, bound := range latencyBuckets {
+		if seconds <= bound {
+			m.series[seriesKey(ProcessingSeconds+"_bucket", "event", d.Event, "le", formatValue(bound))]++
+		}
+	}
+	m.series[seriesKey(ProcessingSeconds+"_bucket", "event", d.Event, "le", "+Inf")]++
+	m.series[seriesKey(ProcessingSeconds+"_sum", "event", d.Event)] += seconds
+	m.series[seriesKey(ProcessingSeconds+"_count", "event", d.Event)]++
+}
+
+// Add adds other's counts to m
+func (m *Metrics) Add(other *Metrics) {
+	other.mu.Lock()
+	series := make(map[string]float64, len(other.series))
+	for key, value := range other.series {
+		series[key] = value
+	}
+	other.mu.Unlock()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, value := range series {
+		m.series[key] += value
+	}
+}
+
+// Value returns one series' value, for tests and tools: name is the metric
+// name as written, labels alternate names and values
+func (m *Metrics) Value(name string, labels ...string) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.series[seriesKey(name, labels...)]
+}
+
+// seriesKey renders a series as it appears in the text format, with labels
+// in the given order. Empty label values are kept so every series of a
+// metric has the same labels.
+func seriesKey(name string, labels ...string) string {
+	if len(labels) == 0 {
+		return name
+	}
+	var b strings.Builder
+	b.WriteString(name)
+	b.WriteByte('{')
+	for i := 0; i+1 < len(labels); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(labels[i])
+		b.WriteString(`="`)
+		b.WriteString(escapeLabel(labels[i+1]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Write writes the metrics in the Prometheus text format, or in the
+// OpenMetrics text format when openMetrics is set
+func (m *Metrics) Write(w io.Writer, openMetrics bool) error {
+	m.mu.Lock()
+	keys := make([]string, 0, len(m.series))
+	for key := range m.series {
+		keys = append(keys, key)
+	}
+	series := make(map[string]float64, len(m.series))
+	for key, value := range m.series {
+		series[key] = value
+	}
+	m.mu.Unlock()
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, family := range families {
+		name := family.name
+		if openMetrics && family.kind == "counter" {
+			// OpenMetrics names the family without the _total suffix
+			name = strings.TrimSuffix(name, "_total")
+		}
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", name, family.help, name, family.kind)
+		if family.kind == "histogram" {
+			writeHistogram(&b, family.name, keys, series)
+			continue
+		}
+		for _, key := range keys {
+			if seriesFamily(key) == family.name {
+				fmt.Fprintf(&b, "%s %s\n", key, formatValue(series[key]))
+			}
+		}
+	}
+	if openMetrics {
+		b.WriteString("# EOF\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeHistogram writes each event's buckets in increasing order, then its
+// sum and count, as the formats require
+func writeHistogram(b *strings.Builder, name string, keys []string, series map[string]float64) {
+	var events []string
+	prefix := name + `_count{event="`
+	for _, key := range keys {
+		if event, ok := strings.CutPrefix(key, prefix); ok {
+			events = append(events, strings.TrimSuffix(event, `"}`))
+		}
+	}
+
+	for _, event := range events {
+		// event is still escaped, as it appears in the keys
+		for _, bound := range append(bucketLabels(), "+Inf") {
+			key := name + `_bucket{event="` + event + `",le="` + bound + `"}`
+			fmt.Fprintf(b, "%s %s\n", key, formatValue(series[key]))
+		}
+		for _, suffix := range []string{"_sum", "_count"} {
+			key := name + suffix + `{event="` + event + `"}`
+			fmt.Fprintf(b, "%s %s\n", key, formatValue(series[key]))
+		}
+	}
+}
+
+func bucketLabels() []string {
+	labels := make([]string, len(latencyBuckets))
+	for i, bound := range latencyBuckets {
+		labels[i] = formatValue(bound)
+	}
+	return labels
+}
+
+// seriesFamily returns the metric family a series key belongs to
+func seriesFamily(key string) string {
+	name, _, _ := strings.Cut(key, "{")
+	for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+		if base, ok := strings.CutSuffix(name, suffix); ok && base == ProcessingSeconds {
+			return base
+		}
+	}
+	return name
+}
+
+// Parse reads metrics written by Write in the Prometheus text format.
+// Series of other metrics are ignored, so a textfile shared with another
+// tool does not fail the update.
+func Parse(r io.Reader) (*Metrics, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	m := New()
+	for i, line := range strings.Split(string(data), "\n") {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		at := strings.LastIndexByte(line, ' ')
+		if at < 0 {
+			return nil, fmt.Errorf("line %d: no value", i+1)
+		}
+		key, raw := line[:at], line[at+1:]
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid value %q", i+1, raw)
+		}
+		if !known(seriesFamily(key)) {
+			continue
+		}
+		m.series[key] += value
+	}
+	return m, nil
+}
+
+func known(family string) bool {
+	for _, f := range families {
+		if f.name == family {
+			return true
+		}
+	}
+	return false
+}
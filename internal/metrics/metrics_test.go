@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWriteAndParse(t *testing.T) {
+	m := New()
+	m.Observe(Decision{Event: "PreToolUse", Tool: "Read", Decision: "deny", Rules: []string{".env"}, Latency: 300 * time.Microsecond})
+	m.Observe(Decision{Event: "PostToolUse", Tool: "Grep", Decision: "redact", Rules: []string{"api_keys", `odd"name`}, RedactedBytes: 40, Latency: 3 * time.Millisecond})
+	m.Observe(Decision{Event: "PreToolUse", Tool: "Read", Decision: "allow", Rules: []string{"ignored"}, Latency: time.Millisecond})
+
+	var text bytes.Buffer
+	if err := m.Write(&text, false); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	for _, want := range []string{
+		`cc_filter_hook_invocations_total{event="PreToolUse",tool="Read",decision="deny"} 1`,
+		`cc_filter_rule_hits_total{rule="odd\"name"} 1`,
+		`cc_filter_redacted_bytes_total 40`,
+		`cc_filter_processing_seconds_bucket{event="PreToolUse",le="0.0005"} 1` + "\n" + `cc_filter_processing_seconds_bucket{event="PreToolUse",le="0.001"} 2`,
+		`cc_filter_processing_seconds_bucket{event="PreToolUse",le="+Inf"} 2` + "\n" + `cc_filter_processing_seconds_sum{event="PreToolUse"} 0.0013` + "\n" + `cc_filter_processing_seconds_count{event="PreToolUse"} 2`,
+	} {
+		if !strings.Contains(text.String(), want) {
+			t.Errorf("text format lacks %q:\n%s", want, text.String())
+		}
+	}
+	if strings.Contains(text.String(), `rule="ignored"`) {
+		t.Error("allow decisions counted as rule hits")
+	}
+
+	parsed, err := Parse(strings.NewReader(text.String() + "node_other_metric 5\n"))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	var again bytes.Buffer
+	parsed.Write(&again, false)
+	if again.String() != text.String() {
+		t.Errorf("Parse did not round-trip:\n%s\nwant\n%s", again.String(), text.String())
+	}
+
+	var open bytes.Buffer
+	m.Write(&open, true)
+	if !strings.Contains(open.String(), "# TYPE cc_filter_rule_hits counter\n") || !strings.HasSuffix(open.String(), "# EOF\n") {
+		t.Errorf("OpenMetrics format:\n%s", open.String())
+	}
+}
+
+func TestUpdateTextfileFromConcurrentRuns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cc-filter.prom")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			run := New()
+			run.Observe(Decision{Event: "PreToolUse", Tool: "Bash", Decision: "deny", Rules: []string{"rm -rf"}})
+			if err := UpdateTextfile(path, run); err != nil {
+				t.Errorf("UpdateTextfile: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	m, err := ReadTextfile(path)
+	if err != nil {
+		t.Fatalf("ReadTextfile: %v", err)
+	}
+	if got := m.Value(RuleHits, "rule", "rm -rf"); got != 20 {
+		t.Errorf("rule hits = %v, want 20", got)
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text; version=1.0.0")
+	Handler(path).ServeHTTP(rec, req)
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "application/openmetrics-text") || !strings.Contains(rec.Body.String(), `cc_filter_rule_hits_total{rule="rm -rf"} 20`) {
+		t.Errorf("served %s:\n%s", rec.Header().Get("Content-Type"), rec.Body.String())
+	}
+}
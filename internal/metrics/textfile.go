@@ -0,0 +1,117 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// lockTimeout bounds how long a run waits for another to finish updating
+// the textfile, and how old a lock must be to be considered abandoned
+var lockTimeout = 2 * time.Second
+
+// UpdateTextfile adds m's counts to the metrics in path, creating it if
+// needed. Hooks run concurrently, so the update holds path+".lock", and the
+// file is replaced by a rename, so node-exporter never reads it half
+// written.
+func UpdateTextfile(path string, m *Metrics) error {
+	unlock, err := lock(path + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	total, err := ReadTextfile(path)
+	if err != nil {
+		return err
+	}
+	total.Add(m)
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	err = total.Write(tmp, false)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		// node-exporter may run as another user
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// ReadTextfile reads the metrics in path; a missing file has none
+func ReadTextfile(path string) (*Metrics, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return New(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	m, err := Parse(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return m, nil
+}
+
+// lock creates the lock file name, waiting for another holder to remove
+// it. A lock older than lockTimeout was left by a run that died and is
+// taken over.
+func lock(name string) (unlock func(), err error) {
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		file, err := os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			file.Close()
+			return func() { os.Remove(name) }, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, err
+		}
+		if info, statErr := os.Stat(name); statErr == nil && time.Since(info.ModTime()) > lockTimeout {
+			os.Remove(name)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for %s", name)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Handler serves the metrics in path, read afresh for every scrape, in the
+// OpenMetrics format when the scraper asks for it and the Prometheus text
+// format otherwise
+func Handler(path string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m, err := ReadTextfile(path)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		openMetrics := strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text")
+		if openMetrics {
+			w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+		} else {
+			w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		}
+		m.Write(w, openMetrics)
+	})
+}
@@ -0,0 +1,78 @@
+package rules
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+// benchmarkInput is about 1MB of source code with a secret every few
+// hundred lines, roughly what createRedactedFile sees for a large file
+func benchmarkInput() string {
+	var b strings.Builder
+	for i := 0; b.Len() < 1<<20; i++ {
+		b.WriteString("func handler(w http.ResponseWriter, r *http.Request) {\n")
+		b.WriteString("\tctx := r.Context()\n\tlog.Printf(\"serving %s\", r.URL.Path)\n")
+		if i%50 == 0 {
+			b.WriteString("\tclient := api.New(\"api_key=abcdefghij1234567890XYZ\")\n")
+		}
+		b.WriteString("\treturn render(w, ctx, templates[\"index\"])\n}\n\n")
+	}
+	return b.String()
+}
+
+func benchmarkRules(b *testing.B, keywords bool) *Rules {
+	r, err := Load(testDefaultRules(), LoadOptions{NoUserConfig: true, NoProjectConfigs: true})
+	if err != nil {
+		b.Fatalf("Load: %v", err)
+	}
+	if !keywords {
+		for i := range r.Patterns {
+			r.Patterns[i].Keywords = nil
+		}
+		r.keywords = nil
+	}
+	return r
+}
+
+func BenchmarkFilterContent(b *testing.B) {
+	input := benchmarkInput()
+	for _, bench := range []struct {
+		name     string
+		keywords bool
+	}{
+		{"keywords", true},
+		{"no_keywords", false},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			r := benchmarkRules(b, bench.keywords)
+			b.SetBytes(int64(len(input)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				r.FilterContent(input)
+			}
+		})
+	}
+}
+
+func BenchmarkFilterReader(b *testing.B) {
+	input := benchmarkInput()
+	r := benchmarkRules(b, true)
+	b.SetBytes(int64(len(input)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := r.FilterReader(io.Discard, strings.NewReader(input)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkKeywordIndex(b *testing.B) {
+	input := benchmarkInput()
+	r := benchmarkRules(b, true)
+	b.SetBytes(int64(len(input)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.keywords.windows(input)
+	}
+}
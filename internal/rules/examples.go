@@ -0,0 +1,67 @@
+package rules
+
+// ExampleResult is the outcome of checking one pattern example
+type ExampleResult struct {
+	Pattern   string
+	Source    string
+	Input     string
+	WantMatch bool
+	Passed    bool
+}
+
+// CheckExamples runs every enabled pattern against its own examples. Each
+// pattern is checked on its own, so an example is not affected by a
+// higher-priority pattern claiming the same text.
+func (r *Rules) CheckExamples() []ExampleResult {
+	var results []ExampleResult
+	for i, pattern := range r.Patterns {
+		if r.compiledPatterns[i] == nil {
+			continue
+		}
+
+		source := r.Origin("patterns", pattern.Name)
+		check := func(input string, wantMatch bool) {
+			results = append(results, ExampleResult{
+				Pattern:   pattern.Name,
+				Source:    source,
+				Input:     input,
+				WantMatch: wantMatch,
+				Passed:    r.patternMatches(i, input) == wantMatch,
+			})
+		}
+		for _, input := range pattern.Examples.Match {
+			check(input, true)
+		}
+		for _, input := range pattern.Examples.NoMatch {
+			check(input, false)
+		}
+	}
+	return results
+}
+
+// patternMatches reports whether pattern i finds a secret in input on its own
+func (r *Rules) patternMatches(i int, input string) bool {
+	var windows [][]span
+	if r.keywords != nil {
+		windows = r.keywords.windows(input)
+	}
+	filter := r.compiledFilters[i]
+	for _, submatches := range r.candidates(i, input, windows) {
+		if submatches[1] > submatches[0] && filter.accepts(input, submatches) {
+			return true
+		}
+	}
+	return false
+}
+
+// PatternsWithoutExamples lists the enabled patterns that have no examples
+// to check
+func (r *Rules) PatternsWithoutExamples() []string {
+	var names []string
+	for i, pattern := range r.Patterns {
+		if r.compiledPatterns[i] != nil && len(pattern.Examples.Match) == 0 && len(pattern.Examples.NoMatch) == 0 {
+			names = append(names, pattern.Name)
+		}
+	}
+	return names
+}
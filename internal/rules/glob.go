@@ -0,0 +1,109 @@
+package rules
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// maxCachedGlobs bounds the compiled glob cache, which outlives any one
+// hook call when the rules are embedded in a long-running program
+const maxCachedGlobs = 1024
+
+var (
+	globCacheMu sync.Mutex
+	globCache   = make(map[string]*regexp.Regexp)
+)
+
+// MatchGlob reports whether name matches a tool-style glob pattern,
+// ignoring case. It understands *, ?, [...], {a,b} and ** spanning
+// directories. Invalid patterns never match.
+func MatchGlob(pattern, name string) bool {
+	re := compileGlob(pattern)
+	return re != nil && re.MatchString(strings.ToLower(name))
+}
+
+func compileGlob(pattern string) *regexp.Regexp {
+	globCacheMu.Lock()
+	defer globCacheMu.Unlock()
+
+	if re, ok := globCache[pattern]; ok {
+		return re
+	}
+	re, err := regexp.Compile("^" + globToRegex(strings.ToLower(pattern)) + "$")
+	if err != nil {
+		re = nil
+	}
+	if len(globCache) >= maxCachedGlobs {
+		// start over rather than track recency: recompiling a glob is cheap
+		clear(globCache)
+	}
+	globCache[pattern] = re
+	return re
+}
+
+func globToRegex(glob string) string {
+	var b strings.Builder
+	braceDepth := 0
+
+	for i := 0; i < len(glob); i++ {
+		ch := glob[i]
+		switch ch {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				// "**/" matches zero or more whole directories, a bare "**" anything
+				if i+2 < len(glob) && glob[i+2] == '/' {
+					b.WriteString("(?:.*/)?")
+					i += 2
+				} else {
+					b.WriteString(".*")
+					i++
+				}
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case '{':
+			braceDepth++
+			b.WriteString("(?:")
+		case '}':
+			if braceDepth == 0 {
+				b.WriteString(`\}`)
+				continue
+			}
+			braceDepth--
+			b.WriteString(")")
+		case ',':
+			if braceDepth > 0 {
+				b.WriteString("|")
+			} else {
+				b.WriteString(",")
+			}
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+				b.WriteString(regexp.QuoteMeta(string(glob[i])))
+			}
+		default:
+			b.WriteString(regexp.QuoteMeta(string(ch)))
+		}
+	}
+
+	for ; braceDepth > 0; braceDepth-- {
+		b.WriteString(")")
+	}
+	return b.String()
+}
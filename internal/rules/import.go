@@ -0,0 +1,125 @@
+package rules
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Import names a rule file written for another secret scanner. Its rules
+// are converted to patterns every time the config is loaded.
+type Import struct {
+	Format string `yaml:"format"`
+	Path   string `yaml:"path"`
+}
+
+// Supported import formats
+const (
+	FormatGitleaks      = "gitleaks"
+	FormatDetectSecrets = "detect-secrets"
+	FormatTrufflehog    = "trufflehog"
+)
+
+// ImportFormats lists the formats ImportPatterns understands
+var ImportFormats = []string{FormatGitleaks, FormatDetectSecrets, FormatTrufflehog}
+
+// importedReplacement is what imported patterns replace their matches with;
+// none of the source formats has a notion of replacement
+const importedReplacement = "***FILTERED***"
+
+// ImportPatterns converts a gitleaks TOML config, a detect-secrets baseline
+// or a trufflehog custom detector config into patterns. Rules that cannot be
+// converted are skipped and described in the returned warnings.
+func ImportPatterns(format string, data []byte) ([]PatternRule, []string, error) {
+	var (
+		patterns []PatternRule
+		warnings []string
+		err      error
+	)
+	switch format {
+	case FormatGitleaks:
+		patterns, warnings, err = importGitleaks(data)
+	case FormatDetectSecrets:
+		patterns, warnings, err = importDetectSecrets(data)
+	case FormatTrufflehog:
+		patterns, warnings, err = importTrufflehog(data)
+	default:
+		return nil, nil, fmt.Errorf("unknown import format %q (expected one of %s)", format, strings.Join(ImportFormats, ", "))
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Go's regexp is RE2; rules written for other engines may not compile
+	valid := patterns[:0]
+	for _, pattern := range patterns {
+		if err := checkPatternRegexes(pattern); err != nil {
+			warnings = append(warnings, fmt.Sprintf("%s: skipped: %v", pattern.Name, err))
+			continue
+		}
+		valid = append(valid, pattern)
+	}
+	return valid, warnings, nil
+}
+
+func checkPatternRegexes(pattern PatternRule) error {
+	if _, err := regexp.Compile(pattern.Regex); err != nil {
+		return err
+	}
+	_, err := compileSecretFilter(pattern)
+	return err
+}
+
+// resolveImports loads the files a layer imports, relative to the layer's
+// own directory, and puts their patterns ahead of the layer's own. A pattern
+// the layer defines under an imported name refines the imported one.
+func resolveImports(source string, layer *Rules) ([]Issue, error) {
+	var issues []Issue
+	var imported []PatternRule
+
+	for _, imp := range layer.Imports {
+		path := imp.Path
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(filepath.Dir(source), path)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return issues, fmt.Errorf("imports: %v", err)
+		}
+		patterns, warnings, err := ImportPatterns(imp.Format, data)
+		if err != nil {
+			return issues, fmt.Errorf("imports: %s: %v", imp.Path, err)
+		}
+		for _, warning := range warnings {
+			issues = append(issues, Issue{Source: source, Severity: SeverityWarning, Message: fmt.Sprintf("imports: %s: %s", imp.Path, warning)})
+		}
+		imported = append(imported, patterns...)
+	}
+
+	position := make(map[string]int, len(imported))
+	for i, pattern := range imported {
+		position[pattern.Name] = i
+	}
+	for _, pattern := range layer.Patterns {
+		if i, ok := position[pattern.Name]; ok {
+			imported[i] = pattern.inherit(imported[i])
+			continue
+		}
+		imported = append(imported, pattern)
+	}
+	layer.Patterns = imported
+	return issues, nil
+}
+
+// ruleName turns a scanner's rule or detector name into a pattern name
+func ruleName(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+}
@@ -0,0 +1,106 @@
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// detectSecretsBaseline is the part of a detect-secrets .secrets.baseline
+// that describes what is scanned for. The baseline's results are hashes of
+// findings and are not imported.
+type detectSecretsBaseline struct {
+	PluginsUsed []map[string]interface{} `json:"plugins_used"`
+	FiltersUsed []map[string]interface{} `json:"filters_used"`
+}
+
+// detectSecretsPlugins maps detect-secrets plugins, which are Python
+// classes rather than data, to equivalent patterns
+var detectSecretsPlugins = map[string]PatternRule{
+	"ArtifactoryDetector":      {Regex: `(?:\s|=|:|"|^)AKC[a-zA-Z0-9]{10,}|(?:\s|=|:|"|^)AP[0-9ABCDEF][a-zA-Z0-9]{8,}`},
+	"AWSKeyDetector":           {Regex: `(?:A3T[A-Z0-9]|ABIA|ACCA|AKIA|ASIA)[0-9A-Z]{16}`},
+	"AzureStorageKeyDetector":  {Regex: `AccountKey=[a-zA-Z0-9+/=]{88}`},
+	"BasicAuthDetector":        {Regex: `://[^:/?#\[\]@!$&'()*+,;=\s]+:([^:/?#\[\]@!$&'()*+,;=\s]+)@`},
+	"DiscordBotTokenDetector":  {Regex: `[MNO][a-zA-Z\d_-]{23,25}\.[a-zA-Z\d_-]{6}\.[a-zA-Z\d_-]{27}`},
+	"GitHubTokenDetector":      {Regex: `(?:ghp|gho|ghu|ghs|ghr)_[A-Za-z0-9_]{36}`},
+	"GitLabTokenDetector":      {Regex: `(?:glpat|gldt|glft|glsoat|glrt)-[A-Za-z0-9_\-]{20,50}`},
+	"JwtTokenDetector":         {Regex: `eyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]*\.?[A-Za-z0-9_.+/=-]*`},
+	"MailchimpDetector":        {Regex: `[0-9a-z]{32}-us[0-9]{1,2}`},
+	"NpmDetector":              {Regex: `//.+/:_authToken=\s*((npm_.+)|([A-Fa-f0-9-]{36}))`},
+	"OpenAIDetector":           {Regex: `sk-[A-Za-z0-9-_]*[A-Za-z0-9]{20}T3BlbkFJ[A-Za-z0-9]{20}`},
+	"PrivateKeyDetector":       {Regex: `BEGIN (?:DSA |EC |OPENSSH |PGP |RSA |SSH2 ENCRYPTED )?PRIVATE KEY`},
+	"PypiTokenDetector":        {Regex: `pypi-AgEIcHlwaS5vcmc[A-Za-z0-9-_]{70,}`},
+	"SendGridDetector":         {Regex: `SG\.[a-zA-Z0-9_-]{22}\.[a-zA-Z0-9_-]{43}`},
+	"SlackDetector":            {Regex: `xox(?:a|b|p|o|s|r)-(?:\d+-)+[a-z0-9]+|https://hooks\.slack\.com/services/T[a-zA-Z0-9_]+/B[a-zA-Z0-9_]+/[a-zA-Z0-9_]+`},
+	"SquareOAuthDetector":      {Regex: `sq0csp-[0-9A-Za-z\\\-_]{43}`},
+	"StripeDetector":           {Regex: `(?:r|s)k_live_[0-9a-zA-Z]{24}`},
+	"TelegramBotTokenDetector": {Regex: `\d{8,10}:[0-9A-Za-z_-]{35}`},
+	"TwilioKeyDetector":        {Regex: `AC[a-z0-9]{32}|SK[a-z0-9]{32}`},
+	"KeywordDetector": {
+		Regex: `(?i)(?:api_?key|auth_?key|service_?key|account_?key|db_?key|database_?key|priv_?key|private_?key|client_?key|db_?pass|database_?pass|key_?pass|password|passwd|pwd|secret|contraseña|contrasena)\w*["']?\s*(?::=|=>|=|:)\s*["']([^"'\s]+)["']`,
+	},
+	"Base64HighEntropyString": {Regex: `["']([A-Za-z0-9+/]{20,}={0,2})["']`, Entropy: 4.5},
+	"HexHighEntropyString":    {Regex: `["']([0-9a-fA-F]{20,})["']`, Entropy: 3.0},
+}
+
+func importDetectSecrets(data []byte) ([]PatternRule, []string, error) {
+	var baseline detectSecretsBaseline
+	if err := json.Unmarshal(data, &baseline); err != nil {
+		return nil, nil, fmt.Errorf("invalid detect-secrets baseline: %w", err)
+	}
+
+	var warnings []string
+	var allowlist Allowlist
+	for _, filter := range baseline.FiltersUsed {
+		path, _ := filter["path"].(string)
+		patterns := stringList(filter["pattern"])
+		switch path {
+		case "detect_secrets.filters.regex.should_exclude_secret":
+			allowlist.Regexes = append(allowlist.Regexes, patterns...)
+		case "detect_secrets.filters.regex.should_exclude_line":
+			// the line is not available per match; the match is the closest fit
+			allowlist.MatchRegexes = append(allowlist.MatchRegexes, patterns...)
+		case "detect_secrets.filters.regex.should_exclude_file":
+			warnings = append(warnings, "file exclusions are ignored; imported patterns apply to all content")
+		}
+	}
+
+	var patterns []PatternRule
+	for _, plugin := range baseline.PluginsUsed {
+		name, _ := plugin["name"].(string)
+		template, ok := detectSecretsPlugins[name]
+		if !ok {
+			warnings = append(warnings, fmt.Sprintf("%s: skipped: no equivalent pattern", name))
+			continue
+		}
+
+		pattern := template
+		pattern.Name = "detect_secrets_" + ruleName(name)
+		pattern.Replacement = importedReplacement
+		pattern.Allowlist = allowlist
+		if limit, ok := plugin["limit"].(float64); ok {
+			pattern.Entropy = limit
+		}
+		if exclude, ok := plugin["keyword_exclude"].(string); ok && exclude != "" {
+			pattern.Allowlist.MatchRegexes = append(append([]string(nil), allowlist.MatchRegexes...), exclude)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, warnings, nil
+}
+
+// stringList accepts a JSON string or array of strings
+func stringList(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var result []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package rules
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// gitleaksConfig is the subset of a gitleaks (v8) TOML config that maps onto
+// patterns. Both the single [allowlist] table and the newer [[allowlists]]
+// arrays are read.
+type gitleaksConfig struct {
+	Extend struct {
+		UseDefault bool   `toml:"useDefault"`
+		Path       string `toml:"path"`
+	} `toml:"extend"`
+	Allowlist  gitleaksAllowlist   `toml:"allowlist"`
+	Allowlists []gitleaksAllowlist `toml:"allowlists"`
+	Rules      []gitleaksRule      `toml:"rules"`
+}
+
+type gitleaksRule struct {
+	ID          string              `toml:"id"`
+	Description string              `toml:"description"`
+	Regex       string              `toml:"regex"`
+	Path        string              `toml:"path"`
+	SecretGroup int                 `toml:"secretGroup"`
+	Entropy     float64             `toml:"entropy"`
+	Keywords    []string            `toml:"keywords"`
+	Allowlist   gitleaksAllowlist   `toml:"allowlist"`
+	Allowlists  []gitleaksAllowlist `toml:"allowlists"`
+}
+
+type gitleaksAllowlist struct {
+	Condition   string   `toml:"condition"`
+	RegexTarget string   `toml:"regexTarget"`
+	Regexes     []string `toml:"regexes"`
+	Stopwords   []string `toml:"stopwords"`
+	Paths       []string `toml:"paths"`
+	Commits     []string `toml:"commits"`
+}
+
+func importGitleaks(data []byte) ([]PatternRule, []string, error) {
+	var config gitleaksConfig
+	if _, err := toml.Decode(string(data), &config); err != nil {
+		return nil, nil, fmt.Errorf("invalid gitleaks config: %w", err)
+	}
+
+	var warnings []string
+	if config.Extend.UseDefault || config.Extend.Path != "" {
+		warnings = append(warnings, "[extend] is not followed; only the rules in this file are imported")
+	}
+
+	global, globalWarnings := gitleaksAllowlists("global allowlist", append([]gitleaksAllowlist{config.Allowlist}, config.Allowlists...))
+	warnings = append(warnings, globalWarnings...)
+
+	var patterns []PatternRule
+	for _, rule := range config.Rules {
+		if rule.Regex == "" {
+			warnings = append(warnings, fmt.Sprintf("%s: skipped: path-only rules have no content to match", rule.ID))
+			continue
+		}
+		if rule.Path != "" {
+			warnings = append(warnings, fmt.Sprintf("%s: path %q is ignored; the regex applies to all content", rule.ID, rule.Path))
+		}
+
+		allowlist, allowWarnings := gitleaksAllowlists(rule.ID, append([]gitleaksAllowlist{rule.Allowlist}, rule.Allowlists...))
+		warnings = append(warnings, allowWarnings...)
+		allowlist.Regexes = append(allowlist.Regexes, global.Regexes...)
+		allowlist.MatchRegexes = append(allowlist.MatchRegexes, global.MatchRegexes...)
+		allowlist.Stopwords = append(allowlist.Stopwords, global.Stopwords...)
+
+		patterns = append(patterns, PatternRule{
+			Name:        ruleName(rule.ID),
+			Regex:       rule.Regex,
+			Replacement: importedReplacement,
+			Keywords:    rule.Keywords,
+			SecretGroup: rule.SecretGroup,
+			Entropy:     rule.Entropy,
+			Allowlist:   allowlist,
+		})
+	}
+	return patterns, warnings, nil
+}
+
+// gitleaksAllowlists merges allowlists into one. Path and commit conditions
+// have no equivalent when filtering content: with the default OR condition
+// they are dropped, and an AND allowlist that needs them is skipped whole,
+// since applying only its regexes would exempt too much.
+func gitleaksAllowlists(owner string, lists []gitleaksAllowlist) (Allowlist, []string) {
+	var result Allowlist
+	var warnings []string
+
+	for _, list := range lists {
+		contextual := len(list.Paths) > 0 || len(list.Commits) > 0
+		if contextual && strings.EqualFold(list.Condition, "AND") {
+			warnings = append(warnings, fmt.Sprintf("%s: AND allowlist with paths or commits skipped", owner))
+			continue
+		}
+		if contextual {
+			warnings = append(warnings, fmt.Sprintf("%s: allowlist paths and commits are ignored", owner))
+		}
+
+		switch list.RegexTarget {
+		case "", "secret":
+			result.Regexes = append(result.Regexes, list.Regexes...)
+		case "match", "line":
+			// the line is not available per match; the match is the closest fit
+			result.MatchRegexes = append(result.MatchRegexes, list.Regexes...)
+		default:
+			warnings = append(warnings, fmt.Sprintf("%s: unknown allowlist regexTarget %q; regexes skipped", owner, list.RegexTarget))
+		}
+		result.Stopwords = append(result.Stopwords, list.Stopwords...)
+	}
+	return result, warnings
+}
@@ -0,0 +1,67 @@
+package rules
+
+import (
+	"fmt"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// trufflehogConfig is a trufflehog custom detector config. Verification
+// endpoints are not used: cc-filter never sends candidate secrets anywhere.
+type trufflehogConfig struct {
+	Detectors []trufflehogDetector `yaml:"detectors"`
+}
+
+type trufflehogDetector struct {
+	Name                  string            `yaml:"name"`
+	Keywords              []string          `yaml:"keywords"`
+	Regex                 map[string]string `yaml:"regex"`
+	Entropy               float64           `yaml:"entropy"`
+	ExcludeWords          []string          `yaml:"exclude_words"`
+	ExcludeRegexesMatch   []string          `yaml:"exclude_regexes_match"`
+	ExcludeRegexesCapture []string          `yaml:"exclude_regexes_capture"`
+}
+
+func importTrufflehog(data []byte) ([]PatternRule, []string, error) {
+	var config trufflehogConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, nil, fmt.Errorf("invalid trufflehog config: %w", err)
+	}
+
+	var warnings []string
+	var patterns []PatternRule
+	for _, detector := range config.Detectors {
+		if len(detector.Regex) == 0 {
+			warnings = append(warnings, fmt.Sprintf("%s: skipped: no regex", detector.Name))
+			continue
+		}
+
+		// a detector may name several regexes; each becomes its own pattern
+		names := make([]string, 0, len(detector.Regex))
+		for name := range detector.Regex {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			patternName := ruleName(detector.Name)
+			if len(names) > 1 {
+				patternName += "_" + ruleName(name)
+			}
+			patterns = append(patterns, PatternRule{
+				Name:        patternName,
+				Regex:       detector.Regex[name],
+				Replacement: importedReplacement,
+				Keywords:    detector.Keywords,
+				Entropy:     detector.Entropy,
+				Allowlist: Allowlist{
+					Regexes:      detector.ExcludeRegexesCapture,
+					MatchRegexes: detector.ExcludeRegexesMatch,
+					Stopwords:    detector.ExcludeWords,
+				},
+			})
+		}
+	}
+	return patterns, warnings, nil
+}
@@ -0,0 +1,201 @@
+package rules
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// keywordWindow bounds where a pattern with keywords is evaluated: its regex
+// only runs over the lines within keywordWindow bytes of one of its keywords,
+// so each match has to start and end that close to a keyword. That covers
+// an 8192-bit PEM private key after its BEGIN line.
+const keywordWindow = 8 << 10
+
+// keywordIndex is an Aho-Corasick automaton over the keywords of every
+// pattern. One pass over the text finds every keyword of every pattern, so
+// the cost of the prefilter does not grow with the number of patterns.
+// Keywords match ASCII case-insensitively.
+type keywordIndex struct {
+	root  [256]int32 // transitions out of the root, the state most bytes leave from
+	nodes []keywordNode
+
+	keywordLen   []int   // by keyword id
+	keywordRules [][]int // patterns each keyword belongs to, by keyword id
+	hasKeywords  []bool  // by pattern
+}
+
+type keywordNode struct {
+	next   map[byte]int32
+	fail   int32
+	output []int32 // keywords ending here, including through fail links
+}
+
+// span is a byte range of the text
+type span struct {
+	start, end int
+}
+
+// newKeywordIndex builds the automaton for the enabled patterns. It returns
+// nil when no pattern has keywords.
+func newKeywordIndex(patterns []PatternRule, enabled func(int) bool) *keywordIndex {
+	k := &keywordIndex{nodes: []keywordNode{{}}, hasKeywords: make([]bool, len(patterns))}
+	ids := make(map[string]int)
+	for i, pattern := range patterns {
+		if !enabled(i) {
+			continue
+		}
+		for _, keyword := range pattern.Keywords {
+			keyword = foldASCII(keyword)
+			if keyword == "" {
+				continue
+			}
+			k.hasKeywords[i] = true
+			id, ok := ids[keyword]
+			if !ok {
+				id = len(k.keywordLen)
+				ids[keyword] = id
+				k.keywordLen = append(k.keywordLen, len(keyword))
+				k.keywordRules = append(k.keywordRules, nil)
+				k.insert(keyword, int32(id))
+			}
+			if rules := k.keywordRules[id]; len(rules) == 0 || rules[len(rules)-1] != i {
+				k.keywordRules[id] = append(rules, i)
+			}
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	k.link()
+	return k
+}
+
+func (k *keywordIndex) insert(keyword string, id int32) {
+	state := int32(0)
+	for i := 0; i < len(keyword); i++ {
+		next, ok := k.nodes[state].next[keyword[i]]
+		if !ok {
+			next = int32(len(k.nodes))
+			k.nodes = append(k.nodes, keywordNode{})
+			if k.nodes[state].next == nil {
+				k.nodes[state].next = make(map[byte]int32)
+			}
+			k.nodes[state].next[keyword[i]] = next
+		}
+		state = next
+	}
+	k.nodes[state].output = append(k.nodes[state].output, id)
+}
+
+// link sets the fail links breadth-first and fills in the root transitions
+func (k *keywordIndex) link() {
+	queue := make([]int32, 0, len(k.nodes))
+	for c, child := range k.nodes[0].next {
+		k.root[c] = child
+		queue = append(queue, child)
+	}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+		for c, child := range k.nodes[state].next {
+			fail := k.nodes[state].fail
+			for fail != 0 && k.step(fail, c) == 0 {
+				fail = k.nodes[fail].fail
+			}
+			if target := k.step(fail, c); target != child {
+				k.nodes[child].fail = target
+			}
+			k.nodes[child].output = append(k.nodes[child].output, k.nodes[k.nodes[child].fail].output...)
+			queue = append(queue, child)
+		}
+	}
+}
+
+// step follows the transition for c out of state, or returns 0 without one
+func (k *keywordIndex) step(state int32, c byte) int32 {
+	if state == 0 {
+		return k.root[c]
+	}
+	return k.nodes[state].next[c]
+}
+
+// windows returns, for each pattern with keywords, the parts of text its
+// regex has to run over: the lines around each keyword hit, merged where
+// they overlap. Patterns whose keywords do not appear get none.
+func (k *keywordIndex) windows(text string) [][]span {
+	windows := make([][]span, len(k.hasKeywords))
+	state := int32(0)
+	for pos := 0; pos < len(text); pos++ {
+		c := text[pos]
+		if 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		for state != 0 && k.nodes[state].next[c] == 0 {
+			state = k.nodes[state].fail
+		}
+		state = k.step(state, c)
+
+		for _, id := range k.nodes[state].output {
+			start := max(pos+1-k.keywordLen[id]-keywordWindow, 0)
+			end := min(pos+1+keywordWindow, len(text))
+			for _, rule := range k.keywordRules[id] {
+				windows[rule] = addWindow(windows[rule], span{start, end})
+			}
+		}
+	}
+
+	for _, spans := range windows {
+		for i := range spans {
+			spans[i] = snapToLines(text, spans[i])
+		}
+	}
+	return windows
+}
+
+// addWindow appends w to spans, merging it into the last one if they overlap
+func addWindow(spans []span, w span) []span {
+	if n := len(spans); n > 0 && w.start <= spans[n-1].end {
+		spans[n-1].start = min(spans[n-1].start, w.start)
+		spans[n-1].end = max(spans[n-1].end, w.end)
+		return spans
+	}
+	return append(spans, w)
+}
+
+// snapToLines shrinks a window to whole lines. Each edge moves inward by
+// less than keywordWindow, so it never passes the keyword the window was
+// opened for; where there is no line break it stays on a rune boundary.
+func snapToLines(text string, w span) span {
+	if w.start > 0 {
+		edge := min(w.start+keywordWindow, w.end)
+		if i := strings.IndexByte(text[w.start:edge], '\n'); i >= 0 {
+			w.start += i + 1
+		} else {
+			for w.start < edge && !utf8.RuneStart(text[w.start]) {
+				w.start++
+			}
+		}
+	}
+	if w.end < len(text) {
+		edge := max(w.end-keywordWindow, w.start)
+		if i := strings.LastIndexByte(text[edge:w.end], '\n'); i >= 0 {
+			w.end = edge + i + 1
+		} else {
+			for w.end > edge && !utf8.RuneStart(text[w.end]) {
+				w.end--
+			}
+		}
+	}
+	return w
+}
+
+// foldASCII lowercases ASCII letters only, the way keywords are matched
+func foldASCII(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if 'A' <= c && c <= 'Z' {
+			b[i] = c + 'a' - 'A'
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,70 @@
+package rules
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestKeywordIndexFindsOverlappingKeywords(t *testing.T) {
+	patterns := []PatternRule{
+		{Name: "he", Keywords: []string{"he"}},
+		{Name: "she", Keywords: []string{"SHE"}},
+		{Name: "his_hers", Keywords: []string{"his", "hers"}},
+		{Name: "none"},
+	}
+	k := newKeywordIndex(patterns, func(int) bool { return true })
+
+	tests := []struct {
+		text string
+		want []bool
+	}{
+		{"uShErs", []bool{true, true, true, false}},
+		{"this", []bool{false, false, true, false}},
+		{"hHe", []bool{true, false, false, false}},
+		{"nothing", []bool{false, false, false, false}},
+	}
+	for _, tt := range tests {
+		windows := k.windows(tt.text)
+		for i, want := range tt.want {
+			if got := len(windows[i]) > 0; got != want {
+				t.Errorf("%q: pattern %s found = %v, want %v", tt.text, patterns[i].Name, got, want)
+			}
+		}
+	}
+}
+
+func TestKeywordsLimitWhereRegexRuns(t *testing.T) {
+	r, err := (&Rules{Patterns: []PatternRule{
+		{Name: "token", Regex: `tok_[a-z0-9]{8}`, Replacement: "[TOKEN]", Keywords: []string{"tok_"}},
+		{Name: "near_keyword", Regex: `v[0-9]{6}`, Replacement: "[V]", Keywords: []string{"vault"}},
+	}}).compile()
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+
+	far := strings.Repeat("x", keywordWindow+10)
+	tests := []struct {
+		name, input, want string
+	}{
+		{"keyword is the match", "a tok_abcd1234 b", "a [TOKEN] b"},
+		{"keyword nearby", "vault id v123456", "vault id [V]"},
+		{"keyword lines away", "vault:\n  id: v123456\n", "vault:\n  id: [V]\n"},
+		{"keyword too far", "vault " + far + " v123456", "vault " + far + " v123456"},
+		{"no keyword", "id v123456", "id v123456"},
+	}
+	for _, tt := range tests {
+		if got := r.FilterContent(tt.input).Content; got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRedefinedRegexDoesNotInheritKeywords(t *testing.T) {
+	base := PatternRule{Name: "api_keys", Regex: `api_key=\w+`, Keywords: []string{"api"}}
+	if got := (PatternRule{Name: "api_keys", Replacement: "[X]"}).inherit(base); len(got.Keywords) != 1 {
+		t.Errorf("keywords = %v, want inherited with the regex", got.Keywords)
+	}
+	if got := (PatternRule{Name: "api_keys", Regex: `token=\w+`}).inherit(base); len(got.Keywords) != 0 {
+		t.Errorf("keywords = %v, want none for a new regex", got.Keywords)
+	}
+}
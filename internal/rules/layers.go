@@ -0,0 +1,138 @@
+package rules
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// DefaultsOrigin is the origin reported for entries from the embedded defaults
+const DefaultsOrigin = "(built-in defaults)"
+
+// projectConfigNames are the per-directory config files, in the order they
+// are merged within one directory
+var projectConfigNames = []string{
+	".cc-filter.yaml",
+	filepath.Join(".cc-filter", "config.yaml"),
+}
+
+// discoverProjectConfigs walks from dir up to the enclosing git repository
+// root and returns that root with every project config found on the way,
+// outermost first so nested directories (monorepo packages) layer on top.
+// Outside a git repository only dir itself is searched.
+func discoverProjectConfigs(dir string) (string, []string) {
+	if dir == "" {
+		return "", nil
+	}
+	dir = filepath.Clean(dir)
+
+	dirs := []string{dir}
+	root := dir
+	for current := dir; ; {
+		if isGitRoot(current) {
+			root = current
+			break
+		}
+		parent := filepath.Dir(current)
+		if parent == current {
+			// no repository: only the starting directory counts
+			root, dirs = dir, []string{dir}
+			break
+		}
+		current = parent
+		dirs = append(dirs, current)
+	}
+
+	userConfig := getUserConfigPath()
+	var configs []string
+	for i := len(dirs) - 1; i >= 0; i-- {
+		for _, name := range projectConfigNames {
+			path := filepath.Join(dirs[i], name)
+			if path == userConfig {
+				continue
+			}
+			if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+				configs = append(configs, path)
+			}
+		}
+	}
+	return root, configs
+}
+
+func isGitRoot(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, ".git"))
+	return err == nil
+}
+
+func originKey(section, entry string) string {
+	return section + "\x00" + entry
+}
+
+// recordOrigins marks every entry of a freshly parsed layer as defined by source
+func (r *Rules) recordOrigins(source string) {
+	r.origins = make(map[string]string)
+	for _, pattern := range r.Patterns {
+		r.origins[originKey("patterns", pattern.Name)] = source
+	}
+	for section, entries := range r.listSections() {
+		for _, entry := range entries {
+			r.origins[originKey(section, entry)] = source
+		}
+	}
+	for entry := range r.Actions {
+		r.origins[originKey("actions", entry)] = source
+	}
+	for _, plugin := range r.Plugins {
+		r.origins[originKey("plugins", plugin.Name)] = source
+	}
+}
+
+// listSections returns the string-list sections by their YAML names
+func (r *Rules) listSections() map[string][]string {
+	return map[string][]string{
+		"file_blocks":                    r.FileBlocks,
+		"search_blocks":                  r.SearchBlocks,
+		"command_blocks":                 r.CommandBlocks,
+		"redact_files.extensions":        r.RedactFiles.Extensions,
+		"redact_files.filename_patterns": r.RedactFiles.FilenamePatterns,
+	}
+}
+
+// mergeOrigins follows mergeRules: patterns, actions and plugins are attributed to
+// the layer that last defined them, list entries to the first
+func mergeOrigins(base, override *Rules) map[string]string {
+	result := make(map[string]string, len(base.origins)+len(override.origins))
+	for key, source := range base.origins {
+		result[key] = source
+	}
+	for key, source := range override.origins {
+		if _, exists := result[key]; !exists {
+			result[key] = source
+		}
+	}
+	for _, pattern := range override.Patterns {
+		result[originKey("patterns", pattern.Name)] = override.origins[originKey("patterns", pattern.Name)]
+	}
+	for entry := range override.Actions {
+		result[originKey("actions", entry)] = override.origins[originKey("actions", entry)]
+	}
+	for _, plugin := range override.Plugins {
+		result[originKey("plugins", plugin.Name)] = override.origins[originKey("plugins", plugin.Name)]
+	}
+	return result
+}
+
+// Origin returns the config file that defined an entry of a section
+// ("patterns" entries are named by rule name), or "" if unknown
+func (r *Rules) Origin(section, entry string) string {
+	return r.origins[originKey(section, entry)]
+}
+
+// Sources lists the config files merged on top of the defaults, in load order
+func (r *Rules) Sources() []string {
+	return r.sources
+}
+
+// ProjectRoot is the directory anchored file_blocks entries are relative to
+func (r *Rules) ProjectRoot() string {
+	return r.baseDir
+}
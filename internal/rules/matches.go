@@ -0,0 +1,171 @@
+package rules
+
+import (
+	"sort"
+	"strings"
+)
+
+// match is one accepted pattern match in the original text
+type match struct {
+	start, end int
+	rule       int // index into Patterns
+	submatches []int
+
+	// folded are the rules of overlapping matches this one absorbed. A
+	// match without submatches is the union of partially overlapping
+	// matches and is redacted whole.
+	folded []int
+}
+
+// findMatches runs every enabled pattern over text in evaluation order and
+// returns the non-overlapping matches sorted by position. An earlier
+// pattern claims its span first, but a later match that reaches past it is
+// not dropped, since that would leave the rest of its secret in clear: a
+// match covering the earlier ones redacts the whole span itself, and a
+// partial overlap redacts the union of the two. Matches that leave their
+// text as it is claim nothing. The result does not depend on
+// what other patterns rewrote. Matches starting before from are ignored:
+// text before it only gives the patterns context.
+func (r *Rules) findMatches(text string, from int) []match {
+	var accepted []match
+	var windows [][]span
+	if r.keywords != nil {
+		windows = r.keywords.windows(text)
+	}
+
+	for i := range r.compiledPatterns {
+		filter := r.compiledFilters[i]
+		for _, submatches := range r.candidates(i, text, windows) {
+			start, end := submatches[0], submatches[1]
+			if start == end || start < from || !filter.accepts(text, submatches) {
+				continue
+			}
+			candidate := match{start: start, end: end, rule: i, submatches: submatches}
+			if r.replacement(candidate, text) == text[start:end] {
+				// a match that changes nothing must not keep other
+				// patterns from redacting its span
+				continue
+			}
+
+			// accepted is sorted by start and free of overlaps, so the
+			// candidate collides with a run of neighbours around at
+			at := sort.Search(len(accepted), func(k int) bool { return accepted[k].start >= start })
+			lo, hi := at, at
+			if lo > 0 && accepted[lo-1].end > start {
+				lo--
+			}
+			for hi < len(accepted) && accepted[hi].start < end {
+				hi++
+			}
+			if lo < hi {
+				var ok bool
+				if candidate, ok = r.mergeMatches(text, candidate, accepted[lo:hi]); !ok {
+					continue
+				}
+			}
+
+			accepted = append(accepted[:lo], append([]match{candidate}, accepted[hi:]...)...)
+		}
+	}
+
+	return accepted
+}
+
+// mergeMatches combines a candidate with the accepted matches it overlaps.
+// It reports false when the accepted matches already cover the candidate.
+func (r *Rules) mergeMatches(text string, candidate match, overlapped []match) (match, bool) {
+	first, last := overlapped[0], overlapped[len(overlapped)-1]
+	if len(overlapped) == 1 && first.start <= candidate.start && first.end >= candidate.end {
+		return match{}, false
+	}
+	replacement := r.replacement(candidate, text)
+
+	var rules []int
+	for _, m := range overlapped {
+		rules = appendRule(rules, m.rule)
+		for _, rule := range m.folded {
+			rules = appendRule(rules, rule)
+		}
+	}
+
+	covers := candidate.start <= first.start && candidate.end >= last.end
+	for _, m := range overlapped {
+		// the candidate's own replacement may keep part of its text, such
+		// as env_filter's variable name, which must not hold a secret
+		covers = covers && !strings.Contains(replacement, text[m.start:m.end])
+	}
+	if covers {
+		candidate.folded = rules
+		return candidate, true
+	}
+
+	union := match{start: min(candidate.start, first.start), end: max(candidate.end, last.end), rule: first.rule}
+	union.folded = appendRule(rules[1:], candidate.rule)
+	return union, true
+}
+
+func appendRule(rules []int, rule int) []int {
+	for _, r := range rules {
+		if r == rule {
+			return rules
+		}
+	}
+	return append(rules, rule)
+}
+
+// Finding is one span of text a pattern redacts
+type Finding struct {
+	Pattern    string
+	Start, End int // byte offsets into the text
+}
+
+// Findings returns what FilterContent redacts in text, in text order
+func (r *Rules) Findings(text string) []Finding {
+	var findings []Finding
+	for _, m := range r.findMatches(text, 0) {
+		original := text[m.start:m.end]
+		if keepLineCount(original, r.replacement(m, text)) == original {
+			continue
+		}
+		findings = append(findings, Finding{Pattern: r.Patterns[m.rule].Name, Start: m.start, End: m.end})
+	}
+	return findings
+}
+
+// candidates returns the regex matches of pattern i in text, as submatch
+// indexes into text. A pattern with keywords only runs inside its windows
+// from keywordIndex.windows, and not at all when none of them appear.
+func (r *Rules) candidates(i int, text string, windows [][]span) [][]int {
+	pattern := r.compiledPatterns[i]
+	if pattern == nil {
+		return nil // disabled
+	}
+	if r.keywords == nil || !r.keywords.hasKeywords[i] {
+		return pattern.FindAllStringSubmatchIndex(text, -1)
+	}
+
+	var found [][]int
+	for _, w := range windows[i] {
+		for _, submatches := range pattern.FindAllStringSubmatchIndex(text[w.start:w.end], -1) {
+			for k := range submatches {
+				if submatches[k] >= 0 {
+					submatches[k] += w.start
+				}
+			}
+			found = append(found, submatches)
+		}
+	}
+	return found
+}
+
+// sortByPriority orders patterns by descending priority, keeping the layer
+// order (defaults, user, project) among patterns of equal priority. Locked
+// policy patterns come first, so no other pattern can claim their matches.
+func sortByPriority(patterns []PatternRule) {
+	sort.SliceStable(patterns, func(a, b int) bool {
+		if patterns[a].Locked != patterns[b].Locked {
+			return patterns[a].Locked
+		}
+		return patterns[a].Priority > patterns[b].Priority
+	})
+}
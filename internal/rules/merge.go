@@ -0,0 +1,295 @@
+package rules
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// MergeMode says how a config layer combines a section with the layers below it
+type MergeMode string
+
+const (
+	// MergeExtend adds the layer's entries to the inherited ones (the default)
+	MergeExtend MergeMode = "extend"
+	// MergeReplace discards the inherited entries and starts from the layer's own
+	MergeReplace MergeMode = "replace"
+)
+
+// mergeableSections are the section names accepted by merge and remove
+var mergeableSections = []string{"patterns", "file_blocks", "search_blocks", "command_blocks", "redact_files", "actions"}
+
+// RemoveRules lists entries a layer takes out of the inherited configuration.
+// Patterns and actions are named by rule name and entry respectively.
+type RemoveRules struct {
+	Patterns      []string    `yaml:"patterns"`
+	FileBlocks    []string    `yaml:"file_blocks"`
+	SearchBlocks  []string    `yaml:"search_blocks"`
+	CommandBlocks []string    `yaml:"command_blocks"`
+	RedactFiles   RedactFiles `yaml:"redact_files"`
+	Actions       []string    `yaml:"actions"`
+}
+
+// validateDirectives checks the merge instructions of a single config layer
+func (r *Rules) validateDirectives() error {
+	for section, mode := range r.Merge {
+		if !isMergeableSection(section) {
+			return fmt.Errorf("merge: unknown section %q (expected one of %s)", section, strings.Join(mergeableSections, ", "))
+		}
+		if mode != MergeExtend && mode != MergeReplace {
+			return fmt.Errorf("merge: invalid mode %q for %s: must be extend or replace", mode, section)
+		}
+	}
+	return nil
+}
+
+func isMergeableSection(section string) bool {
+	for _, known := range mergeableSections {
+		if section == known {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutReplacedSections returns a copy of base with every section that
+// override replaces emptied, along with the origins of its entries
+func withoutReplacedSections(base, override *Rules) *Rules {
+	if len(override.Merge) == 0 {
+		return base
+	}
+
+	result := *base
+	result.origins = make(map[string]string, len(base.origins))
+	for key, source := range base.origins {
+		result.origins[key] = source
+	}
+
+	for section, mode := range override.Merge {
+		if mode != MergeReplace {
+			continue
+		}
+		switch section {
+		case "patterns":
+			result.Patterns = nil
+		case "file_blocks":
+			result.FileBlocks = nil
+		case "search_blocks":
+			result.SearchBlocks = nil
+		case "command_blocks":
+			result.CommandBlocks = nil
+		case "redact_files":
+			result.RedactFiles = RedactFiles{}
+		case "actions":
+			result.Actions = nil
+		}
+		for key := range result.origins {
+			if strings.HasPrefix(key, section+"\x00") || strings.HasPrefix(key, section+".") {
+				delete(result.origins, key)
+			}
+		}
+	}
+	return &result
+}
+
+// applyRemovals takes out the entries a layer removes and disables the
+// patterns it lists under disable
+func (r *Rules) applyRemovals(layer *Rules) {
+	remove := layer.Remove
+
+	if len(remove.Patterns) > 0 {
+		kept := r.Patterns[:0]
+		for _, pattern := range r.Patterns {
+			if containsString(remove.Patterns, pattern.Name) {
+				delete(r.origins, originKey("patterns", pattern.Name))
+				continue
+			}
+			kept = append(kept, pattern)
+		}
+		r.Patterns = kept
+	}
+
+	r.FileBlocks = r.removeEntries("file_blocks", r.FileBlocks, remove.FileBlocks)
+	r.SearchBlocks = r.removeEntries("search_blocks", r.SearchBlocks, remove.SearchBlocks)
+	r.CommandBlocks = r.removeEntries("command_blocks", r.CommandBlocks, remove.CommandBlocks)
+	r.RedactFiles.Extensions = r.removeEntries("redact_files.extensions", r.RedactFiles.Extensions, remove.RedactFiles.Extensions)
+	r.RedactFiles.FilenamePatterns = r.removeEntries("redact_files.filename_patterns", r.RedactFiles.FilenamePatterns, remove.RedactFiles.FilenamePatterns)
+	for _, entry := range remove.Actions {
+		delete(r.Actions, entry)
+		delete(r.origins, originKey("actions", entry))
+	}
+
+	disabled := false
+	for i, pattern := range r.Patterns {
+		if containsString(layer.Disable, pattern.Name) {
+			r.Patterns[i].Enabled = &disabled
+		}
+	}
+}
+
+func (r *Rules) removeEntries(section string, entries, removed []string) []string {
+	if len(removed) == 0 {
+		return entries
+	}
+	kept := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if containsString(removed, entry) {
+			delete(r.origins, originKey(section, entry))
+			continue
+		}
+		kept = append(kept, entry)
+	}
+	return kept
+}
+
+// inherit fills the fields a layer left empty when redefining a pattern from
+// the pattern it overrides, so "- name: passwords\n  enabled: false" works
+func (p PatternRule) inherit(base PatternRule) PatternRule {
+	if p.Regex == "" {
+		p.Regex = base.Regex
+	}
+	if p.Replacement == "" {
+		p.Replacement = base.Replacement
+	}
+	if p.Enabled == nil {
+		p.Enabled = base.Enabled
+	}
+	if p.Priority == 0 {
+		p.Priority = base.Priority
+	}
+	if len(p.Examples.Match) == 0 && len(p.Examples.NoMatch) == 0 {
+		p.Examples = base.Examples
+	}
+	// keywords belong to a regex: a rewritten regex may not contain them
+	if len(p.Keywords) == 0 && p.Regex == base.Regex {
+		p.Keywords = base.Keywords
+	}
+	if p.SecretGroup == 0 {
+		p.SecretGroup = base.SecretGroup
+	}
+	if p.Entropy == 0 {
+		p.Entropy = base.Entropy
+	}
+	if p.Allowlist.empty() {
+		p.Allowlist = base.Allowlist
+	}
+	return p
+}
+
+// IsEnabled reports whether the pattern takes part in filtering
+func (p PatternRule) IsEnabled() bool {
+	return p.Enabled == nil || *p.Enabled
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// keepProtections drops what a project layer would take away from the
+// layers below it that are not project configs. A cloned repository
+// controls its project configs, so it may add protections but not lift
+// the defaults', the policy's or the user's. Dropped are:
+//
+//   - patterns it disables or removes
+//   - pattern redefinitions, other than setting enabled: true
+//   - file_blocks, command_blocks and redact_files entries it removes
+//   - merge: replace of a section holding such entries
+//   - actions that loosen an inherited file or command entry
+//   - pattern priorities above the lowest inherited one, which would let a
+//     project pattern claim text before the inherited patterns redact it
+//
+// Search blocks stay removable, since they only hold back search patterns.
+// file_blocks negations are kept but only re-include what project configs
+// block (see pathPattern), and each is reported.
+func (r *Rules) keepProtections(base *Rules, source string, project map[string]bool) []Issue {
+	var issues []Issue
+	ignore := func(format string, args ...interface{}) {
+		issues = append(issues, Issue{Source: source, Severity: SeverityWarning, Message: fmt.Sprintf(format, args...) +
+			" is ignored in project configs; make the change in the user config or a --config file"})
+	}
+	protected := func(section, entry string) bool {
+		origin, ok := base.origins[originKey(section, entry)]
+		return ok && !project[origin]
+	}
+
+	// a project pattern must not claim text before the inherited ones
+	lowest, inherited := 0, false
+	for _, pattern := range base.Patterns {
+		if protected("patterns", pattern.Name) && (!inherited || pattern.Priority < lowest) {
+			lowest, inherited = pattern.Priority, true
+		}
+	}
+
+	kept := r.Patterns[:0]
+	for _, pattern := range r.Patterns {
+		if !protected("patterns", pattern.Name) {
+			if inherited && pattern.Priority > lowest {
+				ignore("priority %d of pattern %q", pattern.Priority, pattern.Name)
+				pattern.Priority = lowest
+			}
+			kept = append(kept, pattern)
+			continue
+		}
+		// turning an inherited pattern on only adds protection
+		enable := PatternRule{Name: pattern.Name, Enabled: pattern.Enabled}
+		if pattern.IsEnabled() && pattern.Enabled != nil {
+			kept = append(kept, enable)
+		}
+		if !reflect.DeepEqual(pattern, enable) || !pattern.IsEnabled() {
+			ignore("redefining pattern %q", pattern.Name)
+		}
+	}
+	r.Patterns = kept
+
+	keep := func(what, section string, entries []string) []string {
+		var result []string
+		for _, entry := range entries {
+			if protected(section, entry) {
+				ignore("%s %q", what, entry)
+				continue
+			}
+			result = append(result, entry)
+		}
+		return result
+	}
+	r.Disable = keep("disabling pattern", "patterns", r.Disable)
+	r.Remove.Patterns = keep("removing pattern", "patterns", r.Remove.Patterns)
+	r.Remove.FileBlocks = keep("removing file_blocks entry", "file_blocks", r.Remove.FileBlocks)
+	r.Remove.CommandBlocks = keep("removing command_blocks entry", "command_blocks", r.Remove.CommandBlocks)
+	r.Remove.RedactFiles.Extensions = keep("removing redact_files extension", "redact_files.extensions", r.Remove.RedactFiles.Extensions)
+	r.Remove.RedactFiles.FilenamePatterns = keep("removing redact_files filename pattern", "redact_files.filename_patterns", r.Remove.RedactFiles.FilenamePatterns)
+
+	for section, mode := range r.Merge {
+		if mode != MergeReplace || section == "search_blocks" {
+			continue
+		}
+		for key, origin := range base.origins {
+			if (strings.HasPrefix(key, section+"\x00") || strings.HasPrefix(key, section+".")) && !project[origin] {
+				ignore("replacing section %s", section)
+				r.Merge[section] = MergeExtend
+				break
+			}
+		}
+	}
+
+	for entry, action := range r.Actions {
+		inherited := protected("actions", entry) || protected("file_blocks", entry) || protected("command_blocks", entry)
+		if inherited && action.severity() < base.ActionFor(entry).severity() {
+			ignore("loosening the action for %q to %s", entry, action)
+			delete(r.Actions, entry)
+		}
+	}
+
+	for _, entry := range r.FileBlocks {
+		if strings.HasPrefix(entry, "!") {
+			issues = append(issues, Issue{Source: source, Severity: SeverityWarning,
+				Message: fmt.Sprintf("file_blocks negation %q only re-includes paths project configs block; other layers' blocks stay", entry)})
+		}
+	}
+	return issues
+}
@@ -0,0 +1,174 @@
+package rules
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// pathPattern is one compiled file_blocks entry with gitignore semantics:
+//
+//	*.pem           no slash: matches a file or directory name at any depth
+//	/config.json    leading or inner slash: anchored to the base directory
+//	secrets/        trailing slash: matches directories only
+//	**/tmp, a/**/b  ** spans any number of directories
+//	!secret_santa.go  negation: re-includes paths an earlier entry blocked
+//
+// A blocked directory blocks everything below it, and as in git a file
+// cannot be re-included once one of its parent directories is blocked.
+// Only the organization policy's own negations re-include what it locked,
+// and a project config's negations only re-include what project configs
+// block: a cloned repository cannot lift the other layers' blocks.
+type pathPattern struct {
+	entry    string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+	locked   bool
+	project  bool // defined first in a project config
+	re       *regexp.Regexp
+}
+
+func compilePathPattern(entry string) (pathPattern, bool) {
+	p := pathPattern{entry: entry}
+	pattern := strings.ToLower(strings.TrimSpace(entry))
+
+	if strings.HasPrefix(pattern, "!") {
+		p.negate = true
+		pattern = pattern[1:]
+	}
+	if strings.HasSuffix(pattern, "/") {
+		p.dirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+	if strings.Contains(pattern, "/") {
+		p.anchored = true
+		pattern = strings.TrimPrefix(pattern, "/")
+	}
+	if pattern == "" {
+		return p, false
+	}
+
+	re, err := regexp.Compile("^" + globToRegex(pattern) + "$")
+	if err != nil {
+		return p, false
+	}
+	p.re = re
+	return p, true
+}
+
+// matches tests the pattern against one path prefix: rel is the prefix
+// relative to the base directory and name its last component
+func (p pathPattern) matches(rel, name string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	if p.anchored {
+		return p.re.MatchString(rel)
+	}
+	return p.re.MatchString(name)
+}
+
+// SetBaseDir sets the directory anchored file_blocks entries are relative to.
+// Its symlink-resolved form is kept too, so canonical paths still fall inside it.
+func (r *Rules) SetBaseDir(dir string) {
+	r.baseDir = filepath.Clean(dir)
+	r.resolvedBaseDir = r.baseDir
+	if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+		r.resolvedBaseDir = resolved
+	}
+}
+
+func (r *Rules) compileFileBlocks() {
+	r.compiledFileBlocks = make([]pathPattern, 0, len(r.FileBlocks))
+	for _, entry := range r.FileBlocks {
+		if p, ok := compilePathPattern(entry); ok {
+			p.locked = r.isLocked("file_blocks", entry)
+			p.project = r.projectSources[r.origins[originKey("file_blocks", entry)]]
+			r.compiledFileBlocks = append(r.compiledFileBlocks, p)
+		}
+	}
+}
+
+// relativeSegments splits path into lowercase components relative to the
+// base directory, or to the filesystem root for paths outside of it. It also
+// returns the path resolved against the base directory for stat calls, and
+// whether the path lies outside the base directory.
+func (r *Rules) relativeSegments(path string) ([]string, string, bool) {
+	resolved := filepath.Clean(path)
+	if r.baseDir != "" && !filepath.IsAbs(resolved) {
+		resolved = filepath.Join(r.baseDir, resolved)
+	}
+
+	rel := resolved
+	outside := false
+	if r.baseDir != "" {
+		outside = true
+		for _, base := range []string{r.baseDir, r.resolvedBaseDir} {
+			inside, err := filepath.Rel(base, resolved)
+			if err == nil && inside != ".." && !strings.HasPrefix(inside, ".."+string(filepath.Separator)) {
+				rel, outside = inside, false
+				break
+			}
+		}
+	}
+	rel = strings.TrimPrefix(rel, filepath.VolumeName(rel))
+	rel = strings.ToLower(filepath.ToSlash(rel))
+
+	var segments []string
+	for _, segment := range strings.Split(rel, "/") {
+		if segment != "" && segment != "." {
+			segments = append(segments, segment)
+		}
+	}
+	return segments, resolved, outside
+}
+
+// matchFileBlocks walks path one directory at a time, as git does, and
+// returns the verdict for the first blocked parent or for the path itself.
+// Paths outside the base directory are walked from the filesystem root, so
+// "secrets/" still blocks /srv/secrets/db.txt and ".ssh" ~/.ssh/id_rsa.
+func (r *Rules) matchFileBlocks(path, reason string) Verdict {
+	segments, resolved, _ := r.relativeSegments(path)
+
+	for i := range segments {
+		isLast := i == len(segments)-1
+		rel := strings.Join(segments[:i+1], "/")
+		isDir := !isLast || isDirectory(resolved)
+
+		// a negation clears the verdicts of its own layer and those below
+		verdict, lockedVerdict, projectVerdict := allowVerdict(), allowVerdict(), allowVerdict()
+		for _, p := range r.compiledFileBlocks {
+			if !p.matches(rel, segments[i], isDir) {
+				continue
+			}
+			switch {
+			case p.negate && p.locked:
+				verdict, lockedVerdict, projectVerdict = allowVerdict(), allowVerdict(), allowVerdict()
+			case p.negate && p.project:
+				projectVerdict = allowVerdict()
+			case p.negate:
+				verdict, projectVerdict = allowVerdict(), allowVerdict()
+			case p.locked:
+				lockedVerdict = lockedVerdict.Stricter(r.verdictFor("file_blocks", p.entry, reason))
+			case p.project:
+				projectVerdict = projectVerdict.Stricter(r.verdictFor("file_blocks", p.entry, reason))
+			default:
+				verdict = verdict.Stricter(r.verdictFor("file_blocks", p.entry, reason))
+			}
+		}
+		verdict = verdict.Stricter(projectVerdict).Stricter(lockedVerdict)
+
+		if isLast || verdict.Action != ActionAllow {
+			return verdict
+		}
+	}
+
+	return allowVerdict()
+}
+
+func isDirectory(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
@@ -0,0 +1,103 @@
+package rules
+
+import (
+	"fmt"
+	"time"
+)
+
+// Plugin declares an external program consulted on every hook decision.
+// It receives the hook payload with cc-filter's verdict and can veto or
+// annotate it; see hooks.Plugin for the protocol.
+type Plugin struct {
+	Name    string   `yaml:"name"`
+	Command []string `yaml:"command"` // the program and its arguments
+
+	// Timeout bounds one call; DefaultPluginTimeout when unset
+	Timeout time.Duration `yaml:"timeout"`
+
+	// OnError decides what a failed, timed out or misbehaving plugin
+	// means: PluginFailClosed (the default) denies, PluginFailOpen keeps
+	// cc-filter's own verdict
+	OnError PluginErrorPolicy `yaml:"on_error"`
+
+	// Events limits the plugin to these hook events; empty means all
+	Events []string `yaml:"events"`
+}
+
+// PluginErrorPolicy is what a plugin failure comes to
+type PluginErrorPolicy string
+
+const (
+	PluginFailClosed PluginErrorPolicy = "fail_closed"
+	PluginFailOpen   PluginErrorPolicy = "fail_open"
+)
+
+// ComposeMode is how the answers of several hook processors that handle
+// the same hook combine into one
+type ComposeMode string
+
+const (
+	// ComposeStrictest lets the strictest answer win (the default)
+	ComposeStrictest ComposeMode = "strictest"
+	// ComposePriority lets the highest-priority processor with an answer decide
+	ComposePriority ComposeMode = "priority"
+)
+
+func (m ComposeMode) valid() bool {
+	return m == "" || m == ComposeStrictest || m == ComposePriority
+}
+
+// DefaultPluginTimeout bounds a plugin call that sets no timeout. The agent
+// waits on every hook, so plugins are expected to answer from local state.
+const DefaultPluginTimeout = 2 * time.Second
+
+// EffectiveTimeout returns the plugin's timeout, or the default
+func (p Plugin) EffectiveTimeout() time.Duration {
+	if p.Timeout > 0 {
+		return p.Timeout
+	}
+	return DefaultPluginTimeout
+}
+
+// FailsOpen reports whether a failure of the plugin is ignored
+func (p Plugin) FailsOpen() bool {
+	return p.OnError == PluginFailOpen
+}
+
+// Handles reports whether the plugin wants to see a hook event
+func (p Plugin) Handles(event string) bool {
+	return len(p.Events) == 0 || containsString(p.Events, event)
+}
+
+// validate checks one plugin declaration
+func (p Plugin) validate() error {
+	switch {
+	case p.Name == "":
+		return fmt.Errorf("plugin has no name")
+	case len(p.Command) == 0 || p.Command[0] == "":
+		return fmt.Errorf("plugin %q has no command", p.Name)
+	case p.Timeout < 0:
+		return fmt.Errorf("plugin %q: timeout cannot be negative", p.Name)
+	case p.OnError != "" && p.OnError != PluginFailClosed && p.OnError != PluginFailOpen:
+		return fmt.Errorf("plugin %q: invalid on_error %q: must be fail_closed or fail_open", p.Name, p.OnError)
+	}
+	return nil
+}
+
+// mergePlugins replaces base's plugins by those of override with the same
+// name and appends the others
+func mergePlugins(base, override []Plugin) []Plugin {
+	result := append([]Plugin(nil), base...)
+	for _, plugin := range override {
+		replaced := false
+		for i := range result {
+			if result[i].Name == plugin.Name {
+				result[i], replaced = plugin, true
+			}
+		}
+		if !replaced {
+			result = append(result, plugin)
+		}
+	}
+	return result
+}
@@ -0,0 +1,279 @@
+package rules
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+// PolicyOrigin prefixes the origin of entries from the organization policy
+const PolicyOrigin = "policy"
+
+// policyPath is the system-wide organization policy. It is merged right after
+// the defaults, and the rules it locks cannot be weakened by user or project
+// configs. It is a variable only so tests can point it elsewhere.
+var policyPath = defaultPolicyPath()
+
+func defaultPolicyPath() string {
+	if runtime.GOOS == "windows" {
+		return filepath.Join(os.Getenv("ProgramData"), "cc-filter", "policy.yaml")
+	}
+	return "/etc/cc-filter/policy.yaml"
+}
+
+// PolicyPath returns where the organization policy is read from
+func PolicyPath() string {
+	return policyPath
+}
+
+// PolicyError is returned by Load when the organization policy cannot be
+// trusted. Unlike other config errors it is never skipped by a lenient load.
+type PolicyError struct {
+	Path string
+	Err  error
+}
+
+func (e *PolicyError) Error() string {
+	return fmt.Sprintf("organization policy %s: %v", e.Path, e.Err)
+}
+
+func (e *PolicyError) Unwrap() error {
+	return e.Err
+}
+
+// loadPolicy reads and verifies the organization policy. Only a pinned key
+// is trusted: one built into the binary or given by the caller, never a
+// key file anyone who can write the policy could replace. With a key, the
+// policy must carry a valid signature in policy.yaml.sig, and a missing
+// policy is an error. Without one, a signed policy is refused, since its
+// signature cannot be checked, and an unsigned one is used but reported as
+// unverified. It returns nil data when there is no policy.
+func loadPolicy(pinnedKey string) ([]byte, []Issue, error) {
+	data, err := os.ReadFile(policyPath)
+	if errors.Is(err, os.ErrNotExist) {
+		if pinnedKey != "" {
+			return nil, nil, &PolicyError{Path: policyPath, Err: errors.New("missing, but a policy key is pinned")}
+		}
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, &PolicyError{Path: policyPath, Err: err}
+	}
+
+	signature, err := os.ReadFile(policyPath + ".sig")
+	if pinnedKey == "" {
+		if err == nil {
+			return nil, nil, &PolicyError{Path: policyPath, Err: errors.New("signed, but no policy key is pinned to verify it with; " + pinKeyHint)}
+		}
+		return data, []Issue{{Source: policyPath, Severity: SeverityWarning,
+			Message: "unverified: no policy key is pinned, so anyone who can write this file can change the policy; " + pinKeyHint}}, nil
+	}
+
+	if err != nil {
+		return nil, nil, &PolicyError{Path: policyPath, Err: fmt.Errorf("signature: %w", err)}
+	}
+	if err := VerifyPolicy(pinnedKey, data, signature); err != nil {
+		return nil, nil, &PolicyError{Path: policyPath, Err: err}
+	}
+	return data, nil, nil
+}
+
+// pinKeyHint says how to pin the key a policy is verified with
+const pinKeyHint = "pin it with --policy-key, CC_FILTER_POLICY_KEY or -ldflags \"-X main.policyPublicKey=...\""
+
+// GeneratePolicyKey creates an ed25519 key pair for signing policies,
+// base64-encoded
+func GeneratePolicyKey() (publicKey, privateKey string, err error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	return base64.StdEncoding.EncodeToString(pub), base64.StdEncoding.EncodeToString(priv), nil
+}
+
+// SignPolicy signs a policy file's exact bytes and returns the base64 signature
+func SignPolicy(privateKey string, policy []byte) (string, error) {
+	key, err := decodeKey(privateKey, ed25519.PrivateKeySize)
+	if err != nil {
+		return "", fmt.Errorf("invalid private key: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(ed25519.PrivateKey(key), policy)), nil
+}
+
+// VerifyPolicy checks a base64 signature of policy against a base64 public key
+func VerifyPolicy(publicKey string, policy, signature []byte) error {
+	key, err := decodeKey(publicKey, ed25519.PublicKeySize)
+	if err != nil {
+		return fmt.Errorf("invalid public key: %w", err)
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return errors.New("malformed signature")
+	}
+	if !ed25519.Verify(ed25519.PublicKey(key), policy, sig) {
+		return errors.New("signature does not match")
+	}
+	return nil
+}
+
+func decodeKey(encoded string, size int) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != size {
+		return nil, fmt.Errorf("expected %d bytes, got %d", size, len(key))
+	}
+	return key, nil
+}
+
+// lockPolicy marks what the policy layer locks: patterns with locked: true,
+// and every list entry, action, plugin, allow_overrides and compose setting
+// it makes
+func (r *Rules) lockPolicy() {
+	r.locked = make(map[string]bool)
+	for _, pattern := range r.Patterns {
+		if pattern.Locked {
+			r.locked[originKey("patterns", pattern.Name)] = true
+		}
+	}
+	for section, entries := range r.listSections() {
+		for _, entry := range entries {
+			r.locked[originKey(section, entry)] = true
+		}
+	}
+	for entry := range r.Actions {
+		r.locked[originKey("actions", entry)] = true
+	}
+	for _, plugin := range r.Plugins {
+		r.locked[originKey("plugins", plugin.Name)] = true
+	}
+	if r.AllowOverrides != nil {
+		r.locked[originKey("allow_overrides", "")] = true
+	}
+	if r.Compose != "" {
+		r.locked[originKey("compose", "")] = true
+	}
+}
+
+// isLocked reports whether an entry is locked by the policy
+func (r *Rules) isLocked(section, entry string) bool {
+	return r.locked[originKey(section, entry)]
+}
+
+// enforceLocks undoes whatever a layer's merge changed about locked entries
+// in base, restoring them in result and reporting each attempt as a warning
+func enforceLocks(base, result *Rules, source string) {
+	if len(base.locked) == 0 {
+		return
+	}
+	result.locked = base.locked
+	warn := func(format string, args ...interface{}) {
+		result.warnings = append(result.warnings, Issue{
+			Source:   source,
+			Severity: SeverityWarning,
+			Message:  fmt.Sprintf(format, args...) + " is locked by the organization policy; change ignored",
+		})
+	}
+
+	for _, pattern := range base.Patterns {
+		if !base.isLocked("patterns", pattern.Name) {
+			continue
+		}
+		restored := false
+		for i := range result.Patterns {
+			if result.Patterns[i].Name != pattern.Name {
+				continue
+			}
+			restored = true
+			if !samePattern(result.Patterns[i], pattern) {
+				warn("pattern %q", pattern.Name)
+			}
+			result.Patterns[i] = pattern
+		}
+		if !restored {
+			warn("pattern %q", pattern.Name)
+			result.Patterns = append([]PatternRule{pattern}, result.Patterns...)
+		}
+		result.origins[originKey("patterns", pattern.Name)] = base.origins[originKey("patterns", pattern.Name)]
+	}
+
+	restoreList := func(section string, baseEntries []string, entries *[]string) {
+		for _, entry := range baseEntries {
+			if base.isLocked(section, entry) && !containsString(*entries, entry) {
+				warn("%s entry %q", section, entry)
+				*entries = append(*entries, entry)
+				result.origins[originKey(section, entry)] = base.origins[originKey(section, entry)]
+			}
+		}
+	}
+	restoreList("file_blocks", base.FileBlocks, &result.FileBlocks)
+	restoreList("search_blocks", base.SearchBlocks, &result.SearchBlocks)
+	restoreList("command_blocks", base.CommandBlocks, &result.CommandBlocks)
+	restoreList("redact_files.extensions", base.RedactFiles.Extensions, &result.RedactFiles.Extensions)
+	restoreList("redact_files.filename_patterns", base.RedactFiles.FilenamePatterns, &result.RedactFiles.FilenamePatterns)
+
+	// an action is locked when the policy sets it, and a locked block entry
+	// without one keeps the default deny
+	for entry, action := range result.Actions {
+		switch {
+		case base.isLocked("actions", entry):
+			if action != base.Actions[entry] {
+				warn("action for %q", entry)
+				result.Actions[entry] = base.Actions[entry]
+				result.origins[originKey("actions", entry)] = base.origins[originKey("actions", entry)]
+			}
+		case base.isLocked("file_blocks", entry) || base.isLocked("search_blocks", entry) || base.isLocked("command_blocks", entry):
+			warn("action for %q", entry)
+			delete(result.Actions, entry)
+			delete(result.origins, originKey("actions", entry))
+		}
+	}
+	for entry, action := range base.Actions {
+		if base.isLocked("actions", entry) {
+			if _, ok := result.Actions[entry]; !ok {
+				warn("action for %q", entry)
+				if result.Actions == nil {
+					result.Actions = make(map[string]Action)
+				}
+				result.Actions[entry] = action
+				result.origins[originKey("actions", entry)] = base.origins[originKey("actions", entry)]
+			}
+		}
+	}
+
+	for _, plugin := range base.Plugins {
+		if !base.isLocked("plugins", plugin.Name) {
+			continue
+		}
+		for i := range result.Plugins {
+			if result.Plugins[i].Name == plugin.Name && !reflect.DeepEqual(result.Plugins[i], plugin) {
+				warn("plugin %q", plugin.Name)
+				result.Plugins[i] = plugin
+				result.origins[originKey("plugins", plugin.Name)] = base.origins[originKey("plugins", plugin.Name)]
+			}
+		}
+	}
+
+	if base.isLocked("allow_overrides", "") && (result.AllowOverrides == nil || *result.AllowOverrides != *base.AllowOverrides) {
+		warn("allow_overrides")
+		result.AllowOverrides = base.AllowOverrides
+	}
+	if base.isLocked("compose", "") && result.Compose != base.Compose {
+		warn("compose")
+		result.Compose = base.Compose
+	}
+}
+
+func samePattern(a, b PatternRule) bool {
+	return a.Regex == b.Regex && a.Replacement == b.Replacement && a.IsEnabled() == b.IsEnabled() &&
+		a.Priority == b.Priority && a.SecretGroup == b.SecretGroup && a.Entropy == b.Entropy &&
+		fmt.Sprint(a.Keywords) == fmt.Sprint(b.Keywords) && fmt.Sprint(a.Allowlist) == fmt.Sprint(b.Allowlist)
+}
@@ -0,0 +1,156 @@
+package rules
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// usePolicy points the loader at a policy file in a temp directory
+func usePolicy(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	if content != "" {
+		os.WriteFile(path, []byte(content), 0644)
+	}
+	previous := policyPath
+	policyPath = path
+	t.Cleanup(func() { policyPath = previous })
+	return path
+}
+
+const lockedPolicy = `patterns:
+  - name: "internal_token"
+    regex: 'itk_[a-z0-9]{16}'
+    replacement: "[POLICY]"
+    locked: true
+file_blocks:
+  - "*.tfstate"
+`
+
+func TestPolicyLocksCannotBeWeakened(t *testing.T) {
+	usePolicy(t, lockedPolicy)
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	os.MkdirAll(filepath.Join(home, ".cc-filter"), 0755)
+	os.WriteFile(filepath.Join(home, ".cc-filter", "config.yaml"), []byte(`patterns:
+  - name: "internal_token"
+    replacement: "$0"
+  - name: "claim_first"
+    regex: 'token itk_[a-z0-9]{16}'
+    replacement: "$0"
+    priority: 100
+disable:
+  - "internal_token"
+remove:
+  file_blocks:
+    - "*.tfstate"
+file_blocks:
+  - "!prod.tfstate"
+actions:
+  "*.tfstate": allow
+`), 0644)
+
+	r, err := Load(testDefaultRules(), LoadOptions{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	if got := r.FilterContent("token itk_abcdef0123456789").Content; got != "token [POLICY]" {
+		t.Errorf("locked pattern should still apply first, got %q", got)
+	}
+	if r.EvaluateFile("prod.tfstate").Action != ActionDeny {
+		t.Error("locked file block should still deny")
+	}
+	if len(r.Warnings()) == 0 {
+		t.Error("attempts to weaken locked rules should be reported")
+	}
+}
+
+func TestPolicySignature(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	path := usePolicy(t, lockedPolicy)
+	publicKey, privateKey, err := GeneratePolicyKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// signed with the pinned key
+	signature, _ := SignPolicy(privateKey, []byte(lockedPolicy))
+	os.WriteFile(path+".sig", []byte(signature), 0644)
+	if _, err := Load(testDefaultRules(), LoadOptions{PolicyPublicKey: publicKey}); err != nil {
+		t.Fatalf("validly signed policy rejected: %v", err)
+	}
+
+	// tampered policy: refused even by a lenient load
+	os.WriteFile(path, []byte(lockedPolicy+"  - \"!*.tfstate\"\n"), 0644)
+	_, err = Load(testDefaultRules(), LoadOptions{PolicyPublicKey: publicKey, Lenient: true})
+	var policyErr *PolicyError
+	if !errors.As(err, &policyErr) {
+		t.Errorf("tampered policy should fail with a PolicyError, got %v", err)
+	}
+
+	// without a pinned key a signature cannot be checked, and a key
+	// installed next to the policy is not trusted
+	os.WriteFile(path, []byte(lockedPolicy), 0644)
+	os.WriteFile(filepath.Join(filepath.Dir(path), "policy.pub"), []byte(publicKey), 0644)
+	if _, err := Load(testDefaultRules(), LoadOptions{Lenient: true}); !errors.As(err, &policyErr) {
+		t.Errorf("signed policy without a pinned key should fail with a PolicyError, got %v", err)
+	}
+
+	// an unsigned policy still applies, but is reported as unverified
+	os.Remove(path + ".sig")
+	r, err := Load(testDefaultRules(), LoadOptions{})
+	if err != nil {
+		t.Fatalf("unsigned policy rejected: %v", err)
+	}
+	unverified := false
+	for _, warning := range r.Warnings() {
+		unverified = unverified || warning.Source == path && strings.HasPrefix(warning.Message, "unverified")
+	}
+	if !unverified || r.EvaluateFile("prod.tfstate").Action != ActionDeny {
+		t.Errorf("unsigned policy should apply with an unverified warning, got %v", r.Warnings())
+	}
+
+	// a build with a pinned key requires its policy
+	os.Remove(path)
+	if _, err := Load(testDefaultRules(), LoadOptions{PolicyPublicKey: publicKey}); !errors.As(err, &policyErr) {
+		t.Errorf("missing policy should fail with a pinned key, got %v", err)
+	}
+}
+
+func TestPolicyLocksCannotBeOverridden(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	os.MkdirAll(filepath.Join(home, ".cc-filter"), 0755)
+	os.WriteFile(filepath.Join(home, ".cc-filter", "config.yaml"), []byte(`allow_overrides: true
+file_blocks:
+  - "*.log"
+`), 0644)
+
+	load := func(policy string) *Rules {
+		usePolicy(t, policy)
+		r, err := Load(testDefaultRules(), LoadOptions{Dir: t.TempDir()})
+		if err != nil {
+			t.Fatalf("Load failed: %v", err)
+		}
+		return r
+	}
+
+	// the user's allow_overrides reaches their own rules, not the policy's
+	r := load(lockedPolicy)
+	if !r.OverridesAllowed() || r.EvaluateFile("app.log").Locked {
+		t.Error("the user's own rules should be overridable")
+	}
+	if verdict := r.EvaluateFile("prod.tfstate"); verdict.Action != ActionDeny || !verdict.Locked {
+		t.Errorf("a locked policy rule should not be overridable, got %+v", verdict)
+	}
+
+	// unless the policy allows it
+	r = load(lockedPolicy + "allow_overrides: true\n")
+	if verdict := r.EvaluateFile("prod.tfstate"); verdict.Action != ActionDeny || verdict.Locked {
+		t.Errorf("a policy allowing overrides should leave its rules overridable, got %+v", verdict)
+	}
+}
@@ -1,12 +1,12 @@
 package rules
 
 import (
+	"crypto/sha256"
+	"fmt"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
-
-	"gopkg.in/yaml.v3"
 )
 
 type Rules struct {
@@ -16,15 +16,83 @@ type Rules struct {
 	CommandBlocks []string      `yaml:"command_blocks"`
 	RedactFiles   RedactFiles   `yaml:"redact_files"`
 
+	// Actions maps a file_blocks, search_blocks or command_blocks entry to the
+	// decision it produces; entries not listed here deny
+	Actions        map[string]Action `yaml:"actions"`
+	AllowOverrides *bool             `yaml:"allow_overrides"`
+
+	// merge directives, applied when this config is layered on the ones below
+	Disable []string             `yaml:"disable"`
+	Remove  RemoveRules          `yaml:"remove"`
+	Merge   map[string]MergeMode `yaml:"merge"`
+
+	// Imports load patterns from gitleaks, detect-secrets or trufflehog
+	// files, so the agent filter and a CI scanner share one rule set
+	Imports []Import `yaml:"imports"`
+
+	// Plugins run an external program on every hook decision. They are
+	// ignored in project configs, which the agent's repository controls.
+	Plugins []Plugin `yaml:"plugins"`
+
+	// Compose says how the answers of hook processors combine. Like
+	// plugins, it is ignored in project configs.
+	Compose ComposeMode `yaml:"compose"`
+
 	// compiled regex patterns
 	compiledPatterns      []*regexp.Regexp
+	compiledFilters       []*secretFilter
+	keywords              *keywordIndex
 	compiledCommandBlocks []*regexp.Regexp
+	compiledFileBlocks    []pathPattern
+	fingerprint           string
+
+	// baseDir anchors file_blocks entries that contain a slash
+	baseDir         string
+	resolvedBaseDir string
+
+	// where each entry was defined, and the config files that were merged
+	origins  map[string]string
+	sources  []string
+	warnings []Issue
+
+	// entries locked by the organization policy, keyed like origins
+	locked map[string]bool
+
+	// the project configs among the origins, whose file_blocks negations
+	// only re-include what project configs block
+	projectSources map[string]bool
 }
 
 type PatternRule struct {
 	Name        string `yaml:"name"`
 	Regex       string `yaml:"regex"`
 	Replacement string `yaml:"replacement"`
+	Enabled     *bool  `yaml:"enabled"`
+
+	// Priority moves a pattern ahead of lower-priority ones in evaluation
+	// order; where matches overlap, the earlier pattern wins. Default 0.
+	Priority int `yaml:"priority"`
+
+	// Examples document what the pattern is meant to catch and are checked
+	// by "cc-filter rules test"
+	Examples Examples `yaml:"examples"`
+
+	// Keywords, SecretGroup, Entropy and Allowlist narrow a broad regex the
+	// way gitleaks rules do; see secret.go
+	Keywords    []string  `yaml:"keywords"`
+	SecretGroup int       `yaml:"secret_group"`
+	Entropy     float64   `yaml:"entropy"`
+	Allowlist   Allowlist `yaml:"allowlist"`
+
+	// Locked patterns in the organization policy cannot be overridden,
+	// disabled or removed by later layers, and are evaluated first
+	Locked bool `yaml:"locked"`
+}
+
+// Examples are sample inputs a pattern must and must not match
+type Examples struct {
+	Match   []string `yaml:"match"`
+	NoMatch []string `yaml:"no_match"`
 }
 
 type RedactFiles struct {
@@ -32,41 +100,190 @@ type RedactFiles struct {
 	FilenamePatterns []string `yaml:"filename_patterns"`
 }
 
+// LoadOptions controls where configuration layers are discovered
+type LoadOptions struct {
+	// Dir is the directory project configs are discovered from, normally the
+	// hook payload's cwd. Empty means the process working directory.
+	Dir string
+
+	// Lenient skips invalid config layers, patterns and command blocks
+	// instead of failing the load. What was skipped is reported by Warnings.
+	// An untrusted organization policy still fails the load.
+	Lenient bool
+
+	// PolicyPublicKey is the base64 ed25519 key the organization policy must
+	// be signed with. When empty, an unsigned policy is used but reported
+	// as unverified, and a signed one is refused.
+	PolicyPublicKey string
+
+	// ExtraConfigs are merged last, in order, on top of every discovered
+	// layer. Unlike the user config they must exist.
+	ExtraConfigs []string
+
+	// NoUserConfig skips ~/.cc-filter/config.yaml and NoProjectConfigs skips
+	// project config discovery. The organization policy always applies.
+	NoUserConfig     bool
+	NoProjectConfigs bool
+}
+
 func LoadRules(defaultRulesYAML []byte) (*Rules, error) {
+	return Load(defaultRulesYAML, LoadOptions{})
+}
+
+// Load builds the effective rules from the embedded defaults, the user config
+// and every project config between the project root and opts.Dir. Any invalid
+// layer fails the load with a *ConfigError unless opts.Lenient is set.
+func Load(defaultRulesYAML []byte, opts LoadOptions) (*Rules, error) {
+	var warnings []Issue
+
 	// start with embedded defaults
 	defaultRules, err := loadDefaultRules(defaultRulesYAML)
 	if err != nil {
-		return nil, err
+		if !opts.Lenient {
+			return nil, err
+		}
+		warnings = append(warnings, Issue{Source: DefaultsOrigin, Severity: SeverityWarning,
+			Message: fmt.Sprintf("using minimal defaults: %v", err)})
+		defaultRules = getMinimalDefaultRules()
 	}
+	defaultRules.recordOrigins(DefaultsOrigin)
 
-	// merge user config if exists
-	userConfigPath := getUserConfigPath()
-	if data, err := os.ReadFile(userConfigPath); err == nil {
-		var userRules Rules
-		if err := yaml.Unmarshal(data, &userRules); err == nil {
-			defaultRules = mergeRules(defaultRules, &userRules)
+	known := make(map[string]bool)
+	for _, pattern := range defaultRules.Patterns {
+		known[pattern.Name] = true
+	}
+
+	// the organization policy goes right on top of the defaults
+	policyData, policyIssues, err := loadPolicy(opts.PolicyPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	warnings = append(warnings, policyIssues...)
+	if policyData != nil {
+		policy, issues := parseLayer(policyPath, policyData, known)
+		if HasErrors(issues) {
+			return nil, &PolicyError{Path: policyPath, Err: &ConfigError{Issues: issues}}
+		}
+		warnings = append(warnings, issues...)
+		for _, pattern := range policy.Patterns {
+			known[pattern.Name] = true
 		}
+		policy.recordOrigins(PolicyOrigin + " " + policyPath)
+		policy.lockPolicy()
+		defaultRules = mergeRules(defaultRules, policy)
+		defaultRules.locked = policy.locked
+		defaultRules.sources = append(defaultRules.sources, policyPath)
 	}
 
-	// merge project config if exists
-	projectConfigPath := "config.yaml"
-	if data, err := os.ReadFile(projectConfigPath); err == nil {
-		var projectRules Rules
-		if err := yaml.Unmarshal(data, &projectRules); err == nil {
-			defaultRules = mergeRules(defaultRules, &projectRules)
+	// merge user config, then project configs from the root down
+	projectRoot, layers, project := configLayers(opts)
+	for _, path := range layers {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			issue := Issue{Source: path, Severity: SeverityError, Message: err.Error()}
+			if !opts.Lenient {
+				return nil, &ConfigError{Issues: []Issue{issue}}
+			}
+			warnings = append(warnings, skipped(issue))
+			continue
+		}
+
+		layerRules, issues := parseLayer(path, data, known)
+		if HasErrors(issues) {
+			if !opts.Lenient {
+				return nil, &ConfigError{Issues: issues}
+			}
+			for _, issue := range issues {
+				warnings = append(warnings, skipped(issue))
+			}
+			continue
 		}
+		warnings = append(warnings, issues...)
+
+		for i, pattern := range layerRules.Patterns {
+			known[pattern.Name] = true
+			if pattern.Locked {
+				warnings = append(warnings, Issue{Source: path, Severity: SeverityWarning,
+					Message: fmt.Sprintf("pattern %q: locked is only honored in the organization policy", pattern.Name)})
+				layerRules.Patterns[i].Locked = false
+			}
+		}
+		if project[path] && len(layerRules.Plugins) > 0 {
+			// a repository must not be able to make cc-filter run its programs
+			warnings = append(warnings, Issue{Source: path, Severity: SeverityWarning,
+				Message: "plugins are ignored in project configs; declare them in the user config, the organization policy or a --config file"})
+			layerRules.Plugins = nil
+		}
+		if project[path] && layerRules.Compose != "" {
+			warnings = append(warnings, Issue{Source: path, Severity: SeverityWarning,
+				Message: "compose is ignored in project configs; set it in the user config, the organization policy or a --config file"})
+			layerRules.Compose = ""
+		}
+		if project[path] {
+			warnings = append(warnings, layerRules.keepProtections(defaultRules, path, project)...)
+		}
+		layerRules.recordOrigins(path)
+		merged := mergeRules(defaultRules, layerRules)
+		enforceLocks(defaultRules, merged, path)
+		defaultRules = merged
+		defaultRules.sources = append(defaultRules.sources, path)
 	}
 
+	defaultRules.SetBaseDir(projectRoot)
+	defaultRules.projectSources = project
+	defaultRules.warnings = append(warnings, defaultRules.warnings...)
+
+	if opts.Lenient {
+		defaultRules.dropInvalid()
+	}
 	return defaultRules.compile()
 }
 
+// configLayers returns the project root and the existing config files to
+// merge on top of the defaults, in load order, marking the project configs
+func configLayers(opts LoadOptions) (string, []string, map[string]bool) {
+	dir := opts.Dir
+	if dir == "" {
+		if cwd, err := os.Getwd(); err == nil {
+			dir = cwd
+		}
+	}
+
+	var layers []string
+	if userConfigPath := getUserConfigPath(); userConfigPath != "" && !opts.NoUserConfig {
+		if _, err := os.Stat(userConfigPath); err == nil {
+			layers = append(layers, userConfigPath)
+		}
+	}
+
+	projectRoot := dir
+	project := make(map[string]bool)
+	if !opts.NoProjectConfigs {
+		var projectConfigs []string
+		projectRoot, projectConfigs = discoverProjectConfigs(dir)
+		layers = append(layers, projectConfigs...)
+		for _, path := range projectConfigs {
+			project[path] = true
+		}
+	}
+	return projectRoot, append(layers, opts.ExtraConfigs...), project
+}
+
+// skipped turns a load error into the warning recorded when a lenient load
+// skips the offending layer
+func skipped(issue Issue) Issue {
+	issue.Severity = SeverityWarning
+	issue.Message += " (layer skipped)"
+	return issue
+}
+
 func loadDefaultRules(defaultRulesYAML []byte) (*Rules, error) {
-	var rules Rules
-	if err := yaml.Unmarshal(defaultRulesYAML, &rules); err != nil {
-		return getMinimalDefaultRules(), nil
+	rules, issues := parseLayer(DefaultsOrigin, defaultRulesYAML, nil)
+	if HasErrors(issues) {
+		return nil, &ConfigError{Issues: issues}
 	}
 
-	return &rules, nil
+	return rules, nil
 }
 
 func getMinimalDefaultRules() *Rules {
@@ -103,6 +320,7 @@ func getUserConfigPath() string {
 }
 
 func mergeRules(base *Rules, override *Rules) *Rules {
+	base = withoutReplacedSections(base, override)
 	result := &Rules{
 		Patterns:      make([]PatternRule, 0),
 		FileBlocks:    make([]string, 0),
@@ -110,22 +328,42 @@ func mergeRules(base *Rules, override *Rules) *Rules {
 		CommandBlocks: make([]string, 0),
 	}
 
-	patternMap := make(map[string]PatternRule)
+	// overrides replace a pattern in place; new patterns are appended, so
+	// the order is always defaults, then user, then project
+	position := make(map[string]int)
 	for _, pattern := range base.Patterns {
-		patternMap[pattern.Name] = pattern
+		position[pattern.Name] = len(result.Patterns)
+		result.Patterns = append(result.Patterns, pattern)
 	}
 
 	for _, pattern := range override.Patterns {
-		patternMap[pattern.Name] = pattern
-	}
-
-	for _, pattern := range patternMap {
+		if i, ok := position[pattern.Name]; ok {
+			result.Patterns[i] = pattern.inherit(result.Patterns[i])
+			continue
+		}
+		position[pattern.Name] = len(result.Patterns)
 		result.Patterns = append(result.Patterns, pattern)
 	}
 	result.FileBlocks = mergeStringSlices(base.FileBlocks, override.FileBlocks)
 	result.SearchBlocks = mergeStringSlices(base.SearchBlocks, override.SearchBlocks)
 	result.CommandBlocks = mergeStringSlices(base.CommandBlocks, override.CommandBlocks)
 	result.RedactFiles = mergeRedactFiles(base.RedactFiles, override.RedactFiles)
+	result.Actions = mergeActions(base.Actions, override.Actions)
+	result.Plugins = mergePlugins(base.Plugins, override.Plugins)
+
+	result.AllowOverrides = base.AllowOverrides
+	if override.AllowOverrides != nil {
+		result.AllowOverrides = override.AllowOverrides
+	}
+	result.Compose = base.Compose
+	if override.Compose != "" {
+		result.Compose = override.Compose
+	}
+
+	result.origins = mergeOrigins(base, override)
+	result.sources = base.sources
+	result.warnings = base.warnings
+	result.applyRemovals(override)
 
 	return result
 }
@@ -137,6 +375,17 @@ func mergeRedactFiles(base, override RedactFiles) RedactFiles {
 	}
 }
 
+func mergeActions(base, override map[string]Action) map[string]Action {
+	result := make(map[string]Action, len(base)+len(override))
+	for entry, action := range base {
+		result[entry] = action
+	}
+	for entry, action := range override {
+		result[entry] = action
+	}
+	return result
+}
+
 func mergeStringSlices(base, override []string) []string {
 	seen := make(map[string]bool)
 	result := make([]string, 0)
@@ -159,14 +408,33 @@ func mergeStringSlices(base, override []string) []string {
 }
 
 func (r *Rules) compile() (*Rules, error) {
+	sortByPriority(r.Patterns)
+
+	for entry, action := range r.Actions {
+		if !action.valid() {
+			return nil, fmt.Errorf("invalid action %q for %q: must be allow, ask or deny", action, entry)
+		}
+	}
+
 	r.compiledPatterns = make([]*regexp.Regexp, len(r.Patterns))
+	r.compiledFilters = make([]*secretFilter, len(r.Patterns))
 	for i, pattern := range r.Patterns {
+		if !pattern.IsEnabled() {
+			continue
+		}
 		compiled, err := regexp.Compile(pattern.Regex)
 		if err != nil {
 			return nil, err
 		}
 		r.compiledPatterns[i] = compiled
+
+		filter, err := compileSecretFilter(pattern)
+		if err != nil {
+			return nil, err
+		}
+		r.compiledFilters[i] = filter
 	}
+	r.keywords = newKeywordIndex(r.Patterns, func(i int) bool { return r.compiledPatterns[i] != nil })
 
 	r.compiledCommandBlocks = make([]*regexp.Regexp, len(r.CommandBlocks))
 	for i, pattern := range r.CommandBlocks {
@@ -177,9 +445,31 @@ func (r *Rules) compile() (*Rules, error) {
 		r.compiledCommandBlocks[i] = compiled
 	}
 
+	r.compileFileBlocks()
+	r.fingerprint = r.computeFingerprint()
+
 	return r, nil
 }
 
+// Fingerprint identifies the content-filtering rules in effect. It changes
+// whenever a pattern is added, removed, reordered or edited, so anything
+// derived from FilterContent can be keyed on it.
+func (r *Rules) Fingerprint() string {
+	return r.fingerprint
+}
+
+func (r *Rules) computeFingerprint() string {
+	h := sha256.New()
+	for _, pattern := range r.Patterns {
+		if !pattern.IsEnabled() {
+			continue
+		}
+		fmt.Fprintf(h, "%q\x00%q\x00%q\x00%q\x00%d\x00%g\x00%q\n", pattern.Name, pattern.Regex, pattern.Replacement,
+			pattern.Keywords, pattern.SecretGroup, pattern.Entropy, pattern.Allowlist)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
 func (r *Rules) ShouldRedactFile(path string) bool {
 	// Empty config = disabled
 	if len(r.RedactFiles.Extensions) == 0 && len(r.RedactFiles.FilenamePatterns) == 0 {
@@ -206,87 +496,149 @@ func (r *Rules) ShouldRedactFile(path string) bool {
 	return false
 }
 
-func (r *Rules) ShouldBlockFile(path string) (bool, string) {
-	pathLower := strings.ToLower(path)
-	
-	for _, pattern := range r.FileBlocks {
-		patternLower := strings.ToLower(pattern)
-		
-		if strings.Contains(pattern, "*") {
-			if matched, _ := filepath.Match(patternLower, pathLower); matched {
-				return true, "Access denied to sensitive file: " + path
-			}
-		} else {
-			if strings.Contains(pathLower, patternLower) {
-				return true, "Access denied to sensitive file: " + path
-			}
-		}
-	}
-	
-	return false, ""
+// EvaluateFile matches path against file_blocks using gitignore semantics
+// (see pathPattern), ignoring case
+func (r *Rules) EvaluateFile(path string) Verdict {
+	return r.matchFileBlocks(path, "Access denied to sensitive file: "+path)
 }
 
-func (r *Rules) ShouldBlockSearch(pattern string) (bool, string) {
+func (r *Rules) EvaluateSearch(pattern string) Verdict {
 	patternLower := strings.ToLower(pattern)
-	
+	verdict := allowVerdict()
+
 	for _, blocked := range r.SearchBlocks {
 		if strings.Contains(patternLower, strings.ToLower(blocked)) {
-			return true, "Search pattern may expose sensitive data: " + pattern
+			verdict = verdict.Stricter(r.verdictFor("search_blocks", blocked, "Search pattern may expose sensitive data: "+pattern))
 		}
 	}
-	
-	return false, ""
+
+	return verdict
 }
 
-func (r *Rules) ShouldBlockCommand(cmd string) (bool, string) {
+func (r *Rules) EvaluateCommand(cmd string) Verdict {
 	cmdLower := strings.ToLower(cmd)
-	
-	for _, pattern := range r.compiledCommandBlocks {
+	verdict := allowVerdict()
+
+	for i, pattern := range r.compiledCommandBlocks {
 		if pattern.MatchString(cmdLower) {
-			return true, "Command may expose sensitive data: " + cmd
+			verdict = verdict.Stricter(r.verdictFor("command_blocks", r.CommandBlocks[i], "Command may expose sensitive data: "+cmd))
 		}
 	}
-	
-	return false, ""
+
+	return verdict
+}
+
+func (r *Rules) ShouldBlockFile(path string) (bool, string) {
+	verdict := r.EvaluateFile(path)
+	return verdict.Action != ActionAllow, verdict.Reason
+}
+
+func (r *Rules) ShouldBlockSearch(pattern string) (bool, string) {
+	verdict := r.EvaluateSearch(pattern)
+	return verdict.Action != ActionAllow, verdict.Reason
+}
+
+func (r *Rules) ShouldBlockCommand(cmd string) (bool, string) {
+	verdict := r.EvaluateCommand(cmd)
+	return verdict.Action != ActionAllow, verdict.Reason
 }
 
 type FilterResult struct {
 	Content         string
 	Filtered        bool
 	MatchedPatterns []string // names of patterns that matched
+	RedactedBytes   int      // length of the original text that was replaced
 }
 
+// FilterContent redacts every pattern match in text. All patterns are
+// matched against the original text; where matches overlap, the pattern that
+// comes first in evaluation order keeps the span. Replacements never add or
+// remove line breaks, so line N of the output always corresponds to line N of
+// the input.
 func (r *Rules) FilterContent(text string) FilterResult {
-	filtered := text
-	hasChanged := false
-	matchedPatterns := []string{}
-
-	for i, pattern := range r.compiledPatterns {
-		rule := r.Patterns[i]
-		original := filtered
-
-		switch rule.Replacement {
-		case "mask":
-			filtered = pattern.ReplaceAllStringFunc(filtered, func(match string) string {
-				return strings.Repeat("*", len(match))
-			})
-		case "env_filter":
-			filtered = pattern.ReplaceAllStringFunc(filtered, func(match string) string {
-				parts := strings.SplitN(match, "=", 2)
-				if len(parts) == 2 {
-					return parts[0] + "=***FILTERED***"
-				}
-				return match
-			})
-		default:
-			filtered = pattern.ReplaceAllString(filtered, rule.Replacement)
+	var b strings.Builder
+	matched := make(map[int]bool)
+	redacted := r.redact(&b, text, 0, len(text), r.findMatches(text, 0), matched)
+
+	filtered := b.String()
+	return FilterResult{Content: filtered, Filtered: filtered != text, MatchedPatterns: r.matchedNames(matched), RedactedBytes: redacted}
+}
+
+// redact writes text[from:to] to b with every match that ends by to
+// replaced, records the patterns whose replacement changed something and
+// returns how many bytes of text those replacements cover
+func (r *Rules) redact(b *strings.Builder, text string, from, to int, matches []match, matched map[int]bool) int {
+	redacted := 0
+	last := from
+	for _, m := range matches {
+		if m.end > to {
+			break
 		}
+		original := text[m.start:m.end]
+		replacement := keepLineCount(original, r.replacement(m, text))
 
-		if filtered != original {
-			hasChanged = true
-			matchedPatterns = append(matchedPatterns, rule.Name)
+		b.WriteString(text[last:m.start])
+		b.WriteString(replacement)
+		last = m.end
+
+		if replacement != original {
+			matched[m.rule] = true
+			for _, rule := range m.folded {
+				matched[rule] = true
+			}
+			redacted += len(original)
 		}
 	}
+	b.WriteString(text[last:to])
+	return redacted
+}
+
+// matchedNames returns the names of the recorded patterns in rule order
+func (r *Rules) matchedNames(matched map[int]bool) []string {
+	names := []string{}
+	for i := range r.Patterns {
+		if matched[i] {
+			names = append(names, r.Patterns[i].Name)
+		}
+	}
+	return names
+}
+
+// replacement renders the text that replaces one match
+func (r *Rules) replacement(m match, text string) string {
+	rule := r.Patterns[m.rule]
+	original := text[m.start:m.end]
+	if m.submatches == nil {
+		// the union of partially overlapping matches has no single pattern
+		// to render it
+		return unionReplacement
+	}
 
-	return FilterResult{Content: filtered, Filtered: hasChanged, MatchedPatterns: matchedPatterns}
-}
\ No newline at end of file
+	switch rule.Replacement {
+	case "mask":
+		return maskPattern.ReplaceAllString(original, "*")
+	case "env_filter":
+		parts := strings.SplitN(original, "=", 2)
+		if len(parts) == 2 {
+			return parts[0] + "=***FILTERED***"
+		}
+		return original
+	default:
+		return string(r.compiledPatterns[m.rule].ExpandString(nil, rule.Replacement, text, m.submatches))
+	}
+}
+
+// unionReplacement stands in for partially overlapping matches
+const unionReplacement = "***FILTERED***"
+
+// maskPattern selects the characters "mask" hides: everything but line breaks
+var maskPattern = regexp.MustCompile(`[^\r\n]`)
+
+func keepLineCount(original, replacement string) string {
+	want := strings.Count(original, "\n")
+	have := strings.Count(replacement, "\n")
+	if have > want {
+		replacement = strings.Replace(replacement, "\n", " ", have-want)
+	}
+	return replacement + strings.Repeat("\n", max(want-have, 0))
+}
@@ -0,0 +1,137 @@
+package rules
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+)
+
+// Allowlist exempts matches that look like secrets but are known not to be,
+// such as placeholders and test fixtures
+type Allowlist struct {
+	// Regexes are tested against the secret part of a match
+	Regexes []string `yaml:"regexes"`
+	// MatchRegexes are tested against the whole match
+	MatchRegexes []string `yaml:"match_regexes"`
+	// Stopwords exempt secrets that contain any of them, case-insensitively
+	Stopwords []string `yaml:"stopwords"`
+}
+
+func (a Allowlist) empty() bool {
+	return len(a.Regexes) == 0 && len(a.MatchRegexes) == 0 && len(a.Stopwords) == 0
+}
+
+// secretFilter is the compiled form of a pattern's secret group, entropy
+// threshold and allowlist. A nil filter accepts every match. Keywords are
+// compiled into the Rules' keywordIndex instead.
+type secretFilter struct {
+	secretGroup  int
+	entropy      float64
+	allow        []*regexp.Regexp
+	allowMatches []*regexp.Regexp
+	stopwords    []string
+}
+
+func compileSecretFilter(pattern PatternRule) (*secretFilter, error) {
+	if pattern.SecretGroup == 0 && pattern.Entropy == 0 && pattern.Allowlist.empty() {
+		return nil, nil
+	}
+
+	f := &secretFilter{
+		secretGroup: pattern.SecretGroup,
+		entropy:     pattern.Entropy,
+		stopwords:   lowered(pattern.Allowlist.Stopwords),
+	}
+	for _, expr := range pattern.Allowlist.Regexes {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("pattern %q: invalid allowlist regex: %w", pattern.Name, err)
+		}
+		f.allow = append(f.allow, re)
+	}
+	for _, expr := range pattern.Allowlist.MatchRegexes {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("pattern %q: invalid allowlist regex: %w", pattern.Name, err)
+		}
+		f.allowMatches = append(f.allowMatches, re)
+	}
+	return f, nil
+}
+
+// accepts decides whether one regex match is reported as a secret
+func (f *secretFilter) accepts(text string, submatches []int) bool {
+	if f == nil {
+		return true
+	}
+
+	matched := text[submatches[0]:submatches[1]]
+	secret := secretText(text, submatches, f.secretGroup)
+
+	if f.entropy > 0 && shannonEntropy(secret) < f.entropy {
+		return false
+	}
+	for _, re := range f.allow {
+		if re.MatchString(secret) {
+			return false
+		}
+	}
+	for _, re := range f.allowMatches {
+		if re.MatchString(matched) {
+			return false
+		}
+	}
+	lowerSecret := strings.ToLower(secret)
+	for _, stopword := range f.stopwords {
+		if strings.Contains(lowerSecret, stopword) {
+			return false
+		}
+	}
+	return true
+}
+
+// secretText returns the part of a match that holds the secret: the given
+// capture group, else the first non-empty group, else the whole match
+func secretText(text string, submatches []int, group int) string {
+	if group > 0 && 2*group+1 < len(submatches) && submatches[2*group] >= 0 {
+		return text[submatches[2*group]:submatches[2*group+1]]
+	}
+	if group == 0 {
+		for i := 2; i+1 < len(submatches); i += 2 {
+			if submatches[i] >= 0 && submatches[i+1] > submatches[i] {
+				return text[submatches[i]:submatches[i+1]]
+			}
+		}
+	}
+	return text[submatches[0]:submatches[1]]
+}
+
+// shannonEntropy returns the entropy of s in bits per character
+func shannonEntropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+	counts := make(map[rune]int)
+	total := 0
+	for _, c := range s {
+		counts[c]++
+		total++
+	}
+	entropy := 0.0
+	for _, count := range counts {
+		p := float64(count) / float64(total)
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+func lowered(values []string) []string {
+	var result []string
+	for _, value := range values {
+		if value != "" {
+			result = append(result, strings.ToLower(value))
+		}
+	}
+	return result
+}
@@ -0,0 +1,181 @@
+package rules
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EffectiveYAML renders the merged configuration in the config file format.
+// With withOrigin, every entry carries a comment naming the file it came from.
+func (r *Rules) EffectiveYAML(withOrigin bool) ([]byte, error) {
+	origin := func(section, entry string) string {
+		if !withOrigin {
+			return ""
+		}
+		if source := r.Origin(section, entry); source != "" {
+			return "from " + source
+		}
+		return ""
+	}
+
+	doc := mappingNode()
+
+	patterns := &yaml.Node{Kind: yaml.SequenceNode}
+	for _, pattern := range r.Patterns {
+		node := patternNode(pattern)
+		node.Content[1].LineComment = origin("patterns", pattern.Name)
+		patterns.Content = append(patterns.Content, node)
+	}
+	addNode(doc, "patterns", patterns)
+
+	addList := func(parent *yaml.Node, key, section string, entries []string) {
+		list := &yaml.Node{Kind: yaml.SequenceNode}
+		for _, entry := range entries {
+			item := scalarNode(entry)
+			item.LineComment = origin(section, entry)
+			list.Content = append(list.Content, item)
+		}
+		addNode(parent, key, list)
+	}
+	addList(doc, "file_blocks", "file_blocks", r.FileBlocks)
+	addList(doc, "search_blocks", "search_blocks", r.SearchBlocks)
+	addList(doc, "command_blocks", "command_blocks", r.CommandBlocks)
+
+	redact := mappingNode()
+	addList(redact, "extensions", "redact_files.extensions", r.RedactFiles.Extensions)
+	addList(redact, "filename_patterns", "redact_files.filename_patterns", r.RedactFiles.FilenamePatterns)
+	addNode(doc, "redact_files", redact)
+
+	if len(r.Actions) > 0 {
+		actions := mappingNode()
+		entries := make([]string, 0, len(r.Actions))
+		for entry := range r.Actions {
+			entries = append(entries, entry)
+		}
+		sort.Strings(entries)
+		for _, entry := range entries {
+			addScalar(actions, entry, string(r.Actions[entry]))
+			actions.Content[len(actions.Content)-1].LineComment = origin("actions", entry)
+		}
+		addNode(doc, "actions", actions)
+	}
+	if r.AllowOverrides != nil {
+		value := "false"
+		if *r.AllowOverrides {
+			value = "true"
+		}
+		addNode(doc, "allow_overrides", &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: value})
+	}
+	if r.Compose != "" {
+		addScalar(doc, "compose", string(r.Compose))
+	}
+	if len(r.Plugins) > 0 {
+		plugins := &yaml.Node{Kind: yaml.SequenceNode}
+		for _, plugin := range r.Plugins {
+			node := mappingNode()
+			addScalar(node, "name", plugin.Name)
+			node.Content[1].LineComment = origin("plugins", plugin.Name)
+			addStrings(node, "command", plugin.Command)
+			if plugin.Timeout != 0 {
+				addScalar(node, "timeout", plugin.Timeout.String())
+			}
+			if plugin.OnError != "" {
+				addScalar(node, "on_error", string(plugin.OnError))
+			}
+			addStrings(node, "events", plugin.Events)
+			plugins.Content = append(plugins.Content, node)
+		}
+		addNode(doc, "plugins", plugins)
+	}
+
+	return encodeYAML(doc)
+}
+
+// PatternsYAML renders patterns as a config file that defines them
+func PatternsYAML(patterns []PatternRule) ([]byte, error) {
+	list := &yaml.Node{Kind: yaml.SequenceNode}
+	for _, pattern := range patterns {
+		list.Content = append(list.Content, patternNode(pattern))
+	}
+	doc := mappingNode()
+	addNode(doc, "patterns", list)
+	return encodeYAML(doc)
+}
+
+func patternNode(pattern PatternRule) *yaml.Node {
+	node := mappingNode()
+	addScalar(node, "name", pattern.Name)
+	addScalar(node, "regex", pattern.Regex)
+	addScalar(node, "replacement", pattern.Replacement)
+	if pattern.Priority != 0 {
+		addNode(node, "priority", &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.Itoa(pattern.Priority)})
+	}
+	if !pattern.IsEnabled() {
+		addNode(node, "enabled", &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: "false"})
+	}
+	addStrings(node, "keywords", pattern.Keywords)
+	if pattern.SecretGroup != 0 {
+		addNode(node, "secret_group", &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.Itoa(pattern.SecretGroup)})
+	}
+	if pattern.Entropy != 0 {
+		addNode(node, "entropy", &yaml.Node{Kind: yaml.ScalarNode, Value: strconv.FormatFloat(pattern.Entropy, 'g', -1, 64)})
+	}
+	if !pattern.Allowlist.empty() {
+		allowlist := mappingNode()
+		addStrings(allowlist, "regexes", pattern.Allowlist.Regexes)
+		addStrings(allowlist, "match_regexes", pattern.Allowlist.MatchRegexes)
+		addStrings(allowlist, "stopwords", pattern.Allowlist.Stopwords)
+		addNode(node, "allowlist", allowlist)
+	}
+	if len(pattern.Examples.Match) > 0 || len(pattern.Examples.NoMatch) > 0 {
+		examples := mappingNode()
+		addStrings(examples, "match", pattern.Examples.Match)
+		addStrings(examples, "no_match", pattern.Examples.NoMatch)
+		addNode(node, "examples", examples)
+	}
+	return node
+}
+
+func encodeYAML(doc *yaml.Node) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(doc); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func mappingNode() *yaml.Node {
+	return &yaml.Node{Kind: yaml.MappingNode}
+}
+
+func scalarNode(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+}
+
+func addNode(mapping *yaml.Node, key string, value *yaml.Node) {
+	mapping.Content = append(mapping.Content, scalarNode(key), value)
+}
+
+func addScalar(mapping *yaml.Node, key, value string) {
+	addNode(mapping, key, scalarNode(value))
+}
+
+// addStrings adds a list of strings, leaving out empty lists
+func addStrings(mapping *yaml.Node, key string, values []string) {
+	if len(values) == 0 {
+		return
+	}
+	list := &yaml.Node{Kind: yaml.SequenceNode}
+	for _, value := range values {
+		list.Content = append(list.Content, scalarNode(value))
+	}
+	addNode(mapping, key, list)
+}
@@ -0,0 +1,111 @@
+package rules
+
+import (
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// FilterReader works on windows of up to streamContext+streamWindow+
+// streamOverlap bytes and writes out roughly the first streamWindow of each,
+// so memory stays bounded and any match of up to streamOverlap bytes that
+// crosses a window boundary is still seen whole. The streamContext bytes
+// before each window are kept so \b and similar see what precedes it. They
+// are variables only so tests can shrink them.
+var (
+	streamWindow  = 1 << 20
+	streamOverlap = 64 << 10
+	streamContext = 256
+)
+
+// StreamResult reports what FilterReader did
+type StreamResult struct {
+	Filtered        bool
+	MatchedPatterns []string // names of patterns that matched
+	RedactedBytes   int64    // length of the input that was replaced
+	InputBytes      int64
+	OutputBytes     int64
+}
+
+// FilterReader copies src to dst with every pattern match redacted, like
+// FilterContent but for input of any size. Bytes outside matches are copied
+// exactly, line endings and a missing final newline included.
+func (r *Rules) FilterReader(dst io.Writer, src io.Reader) (StreamResult, error) {
+	var result StreamResult
+	matched := make(map[int]bool)
+	buf := make([]byte, 0, streamContext+streamWindow+streamOverlap)
+	from := 0 // buf[:from] was already written and is only context
+	eof := false
+
+	for {
+		for !eof && len(buf) < cap(buf) {
+			n, err := src.Read(buf[len(buf):cap(buf)])
+			buf = buf[:len(buf)+n]
+			result.InputBytes += int64(n)
+			if err == io.EOF {
+				eof = true
+			} else if err != nil {
+				result.MatchedPatterns = r.matchedNames(matched)
+				return result, err
+			}
+		}
+		if eof && len(buf) == from {
+			break
+		}
+
+		text := string(buf)
+		matches := r.findMatches(text, from)
+		cut := len(text)
+		if !eof {
+			cut = streamCut(text, from, matches)
+		}
+
+		var b strings.Builder
+		result.RedactedBytes += int64(r.redact(&b, text, from, cut, matches, matched))
+		if b.String() != text[from:cut] {
+			result.Filtered = true
+		}
+		n, err := io.WriteString(dst, b.String())
+		result.OutputBytes += int64(n)
+		if err != nil {
+			result.MatchedPatterns = r.matchedNames(matched)
+			return result, err
+		}
+
+		from = min(streamContext, cut)
+		buf = buf[:copy(buf, buf[cut-from:])]
+	}
+
+	result.MatchedPatterns = r.matchedNames(matched)
+	return result, nil
+}
+
+// streamCut picks where to end the output of a full window: the last line
+// break that leaves streamOverlap bytes of lookahead, moved so that it does
+// not split a match
+func streamCut(text string, from int, matches []match) int {
+	limit := len(text) - streamOverlap
+	for limit > from && !utf8.RuneStart(text[limit]) {
+		limit--
+	}
+	half := from + (limit-from)/2
+
+	cut := limit
+	if i := strings.LastIndexByte(text[half:limit], '\n'); i >= 0 {
+		cut = half + i + 1
+	}
+
+	for _, m := range matches {
+		if m.start < cut && m.end > cut {
+			// leave the match to the next window, unless that would leave
+			// this one with too little to write
+			if m.start >= half {
+				cut = m.start
+			} else {
+				cut = m.end
+			}
+			break
+		}
+	}
+	return cut
+}
@@ -0,0 +1,55 @@
+package rules
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// useStreamWindows shrinks FilterReader's windows for one test
+func useStreamWindows(t *testing.T, window, overlap, context int) {
+	oldWindow, oldOverlap, oldContext := streamWindow, streamOverlap, streamContext
+	streamWindow, streamOverlap, streamContext = window, overlap, context
+	t.Cleanup(func() {
+		streamWindow, streamOverlap, streamContext = oldWindow, oldOverlap, oldContext
+	})
+}
+
+func TestFilterReaderMatchesFilterContent(t *testing.T) {
+	r, err := Load(testDefaultRules(), LoadOptions{NoUserConfig: true, NoProjectConfigs: true})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	useStreamWindows(t, 64, 96, 8)
+
+	secret := "sk-" + strings.Repeat("a1B2", 12)
+	tests := map[string]string{
+		"empty":                "",
+		"no trailing newline":  "plain text\nAPI_KEY=" + strings.Repeat("x", 24),
+		"crlf":                 "line one\r\nOPENAI=" + secret + "\r\nline three\r\n",
+		"match across windows": strings.Repeat("filler ", 9) + "key " + secret + " done\n",
+		"long line":            strings.Repeat("minified();", 2000) + secret + strings.Repeat("z", 500),
+		"many lines":           strings.Repeat("ok line\nsecret "+secret+"\n", 40),
+		"multibyte":            strings.Repeat("héllo wörld ✓ ", 30) + secret,
+	}
+	for name, input := range tests {
+		t.Run(name, func(t *testing.T) {
+			want := r.FilterContent(input)
+
+			var out bytes.Buffer
+			got, err := r.FilterReader(&out, strings.NewReader(input))
+			if err != nil {
+				t.Fatalf("FilterReader: %v", err)
+			}
+			if out.String() != want.Content {
+				t.Errorf("output differs from FilterContent\n got: %q\nwant: %q", out.String(), want.Content)
+			}
+			if got.Filtered != want.Filtered || strings.Join(got.MatchedPatterns, ",") != strings.Join(want.MatchedPatterns, ",") {
+				t.Errorf("result = %v %v, want %v %v", got.Filtered, got.MatchedPatterns, want.Filtered, want.MatchedPatterns)
+			}
+			if got.InputBytes != int64(len(input)) || got.OutputBytes != int64(out.Len()) {
+				t.Errorf("byte counts = %d/%d, want %d/%d", got.InputBytes, got.OutputBytes, len(input), out.Len())
+			}
+		})
+	}
+}
@@ -0,0 +1,361 @@
+package rules
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Severity classifies a configuration issue
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Issue is a problem found in a configuration file. Line is 0 when the
+// problem cannot be tied to a line.
+type Issue struct {
+	Source   string
+	Line     int
+	Severity Severity
+	Message  string
+}
+
+func (i Issue) String() string {
+	if i.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s: %s", i.Source, i.Line, i.Severity, i.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", i.Source, i.Severity, i.Message)
+}
+
+// ConfigError is returned by Load when a configuration layer is invalid
+type ConfigError struct {
+	Issues []Issue
+}
+
+func (e *ConfigError) Error() string {
+	var messages []string
+	for _, issue := range e.Issues {
+		if issue.Severity == SeverityError {
+			messages = append(messages, issue.String())
+		}
+	}
+	return "invalid configuration: " + strings.Join(messages, "; ")
+}
+
+// HasErrors reports whether any issue is an error rather than a warning
+func HasErrors(issues []Issue) bool {
+	for _, issue := range issues {
+		if issue.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks every layer Load would merge for opts.Dir: the embedded
+// defaults, the user config and the discovered project configs. When paths
+// are given, those files are checked on top of the defaults instead.
+func Validate(defaultRulesYAML []byte, opts LoadOptions, paths ...string) []Issue {
+	defaults, issues := parseLayer(DefaultsOrigin, defaultRulesYAML, nil)
+	known := make(map[string]bool)
+	if defaults != nil {
+		for _, pattern := range defaults.Patterns {
+			known[pattern.Name] = true
+		}
+	}
+
+	if len(paths) == 0 {
+		policyData, policyIssues, err := loadPolicy(opts.PolicyPublicKey)
+		issues = append(issues, policyIssues...)
+		if err != nil {
+			issues = append(issues, Issue{Source: policyPath, Severity: SeverityError, Message: err.Error()})
+		} else if policyData != nil {
+			policy, policyIssues := parseLayer(policyPath, policyData, known)
+			issues = append(issues, policyIssues...)
+			if policy != nil {
+				for _, pattern := range policy.Patterns {
+					known[pattern.Name] = true
+				}
+			}
+		}
+		_, paths, _ = configLayers(opts)
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			issues = append(issues, Issue{Source: path, Severity: SeverityError, Message: err.Error()})
+			continue
+		}
+		layer, layerIssues := parseLayer(path, data, known)
+		issues = append(issues, layerIssues...)
+		if layer != nil {
+			for _, pattern := range layer.Patterns {
+				known[pattern.Name] = true
+			}
+		}
+	}
+
+	return issues
+}
+
+var yamlLinePattern = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+// parseLayer decodes one configuration layer and checks it. Unknown keys
+// are only warned about. known holds the pattern names inherited from
+// earlier layers, which may be redefined without a regex. The layer is nil
+// when it could not be decoded.
+func parseLayer(source string, data []byte, known map[string]bool) (*Rules, []Issue) {
+	var issues []Issue
+	add := func(line int, severity Severity, format string, args ...interface{}) {
+		issues = append(issues, Issue{Source: source, Line: line, Severity: severity, Message: fmt.Sprintf(format, args...)})
+	}
+
+	var layer Rules
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&layer); err != nil && !errors.Is(err, io.EOF) {
+		var typeErr *yaml.TypeError
+		if !errors.As(err, &typeErr) {
+			line, message := splitYAMLError(err.Error())
+			add(line, SeverityError, "%s", message)
+			return nil, issues
+		}
+		// unknown keys are warnings, so a typo cannot fail every hook
+		invalid := false
+		for _, detail := range typeErr.Errors {
+			line, message := splitYAMLError(detail)
+			if strings.Contains(message, " not found in type ") {
+				add(line, SeverityWarning, "unknown key %s is ignored (a typo, or a setting of a newer cc-filter?)", strings.Fields(message)[1])
+				continue
+			}
+			add(line, SeverityError, "%s", message)
+			invalid = true
+		}
+		if invalid {
+			return nil, issues
+		}
+		layer = Rules{}
+		if err := yaml.Unmarshal(data, &layer); err != nil {
+			add(0, SeverityError, "%s", strings.TrimPrefix(err.Error(), "yaml: "))
+			return nil, issues
+		}
+	}
+
+	var doc yaml.Node
+	yaml.Unmarshal(data, &doc)
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	if len(doc.Content) > 0 {
+		root = doc.Content[0]
+	}
+
+	// imports come first: the layer's own patterns may refine imported ones
+	own := layer.Patterns
+	if len(layer.Imports) > 0 {
+		importsLine := mappingValue(root, "imports").Line
+		importIssues, err := resolveImports(source, &layer)
+		issues = append(issues, importIssues...)
+		if err != nil {
+			add(importsLine, SeverityError, "%v", err)
+			return nil, issues
+		}
+		inherited := make(map[string]bool, len(known)+len(layer.Patterns))
+		for name := range known {
+			inherited[name] = true
+		}
+		for _, pattern := range layer.Patterns {
+			inherited[pattern.Name] = true
+		}
+		known = inherited
+	}
+
+	// patterns
+	seenPatterns := make(map[string]int)
+	for i, node := range sequenceItems(mappingValue(root, "patterns")) {
+		if i >= len(own) {
+			break
+		}
+		pattern := own[i]
+		if pattern.Name == "" {
+			add(node.Line, SeverityError, "pattern has no name")
+			continue
+		}
+		if first, dup := seenPatterns[pattern.Name]; dup {
+			add(node.Line, SeverityWarning, "duplicate pattern %q (first defined on line %d); the later definition wins", pattern.Name, first)
+		}
+		seenPatterns[pattern.Name] = node.Line
+
+		regexLine := node.Line
+		if value := mappingValue(node, "regex"); value != nil {
+			regexLine = value.Line
+		}
+		switch {
+		case pattern.Regex == "" && !known[pattern.Name]:
+			add(node.Line, SeverityError, "pattern %q has no regex", pattern.Name)
+		case pattern.Regex != "":
+			compiled, err := regexp.Compile(pattern.Regex)
+			if err != nil {
+				add(regexLine, SeverityError, "pattern %q: invalid regex: %v", pattern.Name, err)
+			} else if pattern.SecretGroup > compiled.NumSubexp() {
+				add(node.Line, SeverityError, "pattern %q: secret_group %d but the regex has %d groups", pattern.Name, pattern.SecretGroup, compiled.NumSubexp())
+			}
+		}
+		if pattern.Entropy < 0 || pattern.SecretGroup < 0 {
+			add(node.Line, SeverityError, "pattern %q: entropy and secret_group cannot be negative", pattern.Name)
+		}
+		if _, err := compileSecretFilter(pattern); err != nil {
+			add(node.Line, SeverityError, "%v", err)
+		}
+		if pattern.Replacement == "" && !known[pattern.Name] {
+			add(node.Line, SeverityWarning, "pattern %q has no replacement; matches will be deleted", pattern.Name)
+		}
+	}
+
+	// list sections
+	for _, section := range []string{"file_blocks", "search_blocks", "command_blocks"} {
+		seen := make(map[string]int)
+		for _, node := range sequenceItems(mappingValue(root, section)) {
+			if first, dup := seen[node.Value]; dup {
+				add(node.Line, SeverityWarning, "duplicate %s entry %q (first listed on line %d)", section, node.Value, first)
+			}
+			seen[node.Value] = node.Line
+
+			switch section {
+			case "command_blocks":
+				if _, err := regexp.Compile(strings.ToLower(node.Value)); err != nil {
+					add(node.Line, SeverityError, "command_blocks entry %q: invalid regex: %v", node.Value, err)
+				}
+			case "file_blocks":
+				if _, ok := compilePathPattern(node.Value); !ok {
+					add(node.Line, SeverityWarning, "file_blocks entry %q can never match", node.Value)
+				}
+			}
+		}
+	}
+
+	// actions, plugins and merge directives
+	for key, value := range mappingPairs(mappingValue(root, "actions")) {
+		if !Action(value.Value).valid() {
+			add(value.Line, SeverityError, "invalid action %q for %q: must be allow, ask or deny", value.Value, key)
+		}
+	}
+	seenPlugins := make(map[string]int)
+	for i, node := range sequenceItems(mappingValue(root, "plugins")) {
+		if i >= len(layer.Plugins) {
+			break
+		}
+		plugin := layer.Plugins[i]
+		if err := plugin.validate(); err != nil {
+			add(node.Line, SeverityError, "%v", err)
+		}
+		if first, dup := seenPlugins[plugin.Name]; dup {
+			add(node.Line, SeverityWarning, "duplicate plugin %q (first defined on line %d); the later definition wins", plugin.Name, first)
+		}
+		seenPlugins[plugin.Name] = node.Line
+	}
+	if node := mappingValue(root, "compose"); node != nil && !layer.Compose.valid() {
+		add(node.Line, SeverityError, "invalid compose %q: must be strictest or priority", layer.Compose)
+	}
+	for key, value := range mappingPairs(mappingValue(root, "merge")) {
+		if !isMergeableSection(key) {
+			add(value.Line, SeverityError, "merge: unknown section %q (expected one of %s)", key, strings.Join(mergeableSections, ", "))
+		} else if mode := MergeMode(value.Value); mode != MergeExtend && mode != MergeReplace {
+			add(value.Line, SeverityError, "merge: invalid mode %q for %s: must be extend or replace", value.Value, key)
+		}
+	}
+
+	return &layer, issues
+}
+
+func splitYAMLError(message string) (int, string) {
+	if m := yamlLinePattern.FindStringSubmatch(message); m != nil {
+		line, _ := strconv.Atoi(m[1])
+		return line, m[2]
+	}
+	return 0, strings.TrimPrefix(message, "yaml: ")
+}
+
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	if mapping == nil || mapping.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func mappingPairs(mapping *yaml.Node) map[string]*yaml.Node {
+	pairs := make(map[string]*yaml.Node)
+	if mapping == nil || mapping.Kind != yaml.MappingNode {
+		return pairs
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		pairs[mapping.Content[i].Value] = mapping.Content[i+1]
+	}
+	return pairs
+}
+
+func sequenceItems(node *yaml.Node) []*yaml.Node {
+	if node == nil || node.Kind != yaml.SequenceNode {
+		return nil
+	}
+	return node.Content
+}
+
+// Warnings returns the problems a lenient Load skipped over
+func (r *Rules) Warnings() []Issue {
+	return r.warnings
+}
+
+// dropInvalid removes the entries compile would reject, recording a warning
+// for each, so a lenient load keeps every rule that still works
+func (r *Rules) dropInvalid() {
+	drop := func(section, entry string, err error) {
+		r.warnings = append(r.warnings, Issue{
+			Source:   r.Origin(section, entry),
+			Severity: SeverityWarning,
+			Message:  fmt.Sprintf("%s entry %q skipped: %v", section, entry, err),
+		})
+	}
+
+	patterns := r.Patterns[:0]
+	for _, pattern := range r.Patterns {
+		if pattern.IsEnabled() {
+			if err := checkPatternRegexes(pattern); err != nil {
+				drop("patterns", pattern.Name, err)
+				continue
+			}
+		}
+		patterns = append(patterns, pattern)
+	}
+	r.Patterns = patterns
+
+	commandBlocks := r.CommandBlocks[:0]
+	for _, entry := range r.CommandBlocks {
+		if _, err := regexp.Compile(strings.ToLower(entry)); err != nil {
+			drop("command_blocks", entry, err)
+			continue
+		}
+		commandBlocks = append(commandBlocks, entry)
+	}
+	r.CommandBlocks = commandBlocks
+
+	for entry, action := range r.Actions {
+		if !action.valid() {
+			drop("actions", entry, fmt.Errorf("invalid action %q", action))
+			delete(r.Actions, entry)
+		}
+	}
+}
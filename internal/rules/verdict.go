@@ -0,0 +1,73 @@
+package rules
+
+// Action is the decision a blocking rule produces when it matches
+type Action string
+
+const (
+	ActionAllow Action = "allow"
+	ActionAsk   Action = "ask"
+	ActionDeny  Action = "deny"
+)
+
+func (a Action) valid() bool {
+	return a == ActionAllow || a == ActionAsk || a == ActionDeny
+}
+
+// severity orders actions so the strictest matching rule wins
+func (a Action) severity() int {
+	switch a {
+	case ActionDeny:
+		return 2
+	case ActionAsk:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Verdict is the outcome of evaluating a file path, search or command
+// against the blocking rules
+type Verdict struct {
+	Action Action
+	Rule   string // the file_blocks/search_blocks/command_blocks entry that decided
+	Reason string
+
+	// Locked verdicts cannot be lifted by a one-time override
+	Locked bool
+}
+
+func allowVerdict() Verdict {
+	return Verdict{Action: ActionAllow}
+}
+
+// Stricter returns whichever of v and other has the more restrictive action,
+// preferring a locked verdict between equals
+func (v Verdict) Stricter(other Verdict) Verdict {
+	severity, otherSeverity := v.Action.severity(), other.Action.severity()
+	if otherSeverity > severity || otherSeverity == severity && other.Locked && !v.Locked {
+		return other
+	}
+	return v
+}
+
+// ActionFor returns the configured action for a blocking entry, deny by default
+func (r *Rules) ActionFor(entry string) Action {
+	if action, ok := r.Actions[entry]; ok {
+		return action
+	}
+	return ActionDeny
+}
+
+// OverridesAllowed reports whether denied accesses may be approved once by the user
+func (r *Rules) OverridesAllowed() bool {
+	return r.AllowOverrides != nil && *r.AllowOverrides
+}
+
+// verdictFor returns the verdict of a matching entry of section. An entry
+// the organization policy locks is not open to one-time overrides unless
+// the policy itself sets allow_overrides: true.
+func (r *Rules) verdictFor(section, entry, reason string) Verdict {
+	locked := r.isLocked(section, entry) || r.isLocked("actions", entry)
+	policyAllows := r.isLocked("allow_overrides", "") && r.OverridesAllowed()
+	return Verdict{Action: r.ActionFor(entry), Rule: entry, Reason: reason, Locked: locked && !policyAllows}
+}
@@ -2,51 +2,140 @@ package main
 
 import (
 	"bufio"
-	_ "embed"
+	"crypto/rand"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"strings"
 	"time"
 
-	"cc-filter/internal/filter"
-	"cc-filter/internal/logger"
+	"github.com/wissem/cc-filter/configs"
+	"github.com/wissem/cc-filter/internal/filter"
+	"github.com/wissem/cc-filter/internal/hooks"
+	"github.com/wissem/cc-filter/internal/logger"
+	"github.com/wissem/cc-filter/internal/metrics"
 )
 
-//go:embed configs/default-rules.yaml
-var defaultRulesYAML []byte
+// defaultRulesYAML is the built-in rule set
+var defaultRulesYAML = configs.DefaultRules
 
 // version is set at build time via -ldflags
 var version = "dev"
 
+// policyPublicKey pins the base64 ed25519 key the organization policy must be
+// signed with. Set at build time via -ldflags "-X main.policyPublicKey=...".
+var policyPublicKey = ""
+
 func main() {
-	// check for help or version flags
-	if len(os.Args) > 1 {
-		switch os.Args[1] {
-		case "-h", "--help", "help":
+	opts, args, err := parseOptions(os.Args[1:])
+	if err != nil {
+		// exit 2 so a hook with a mistyped flag blocks instead of passing
+		// everything through unfiltered
+		fmt.Fprintf(os.Stderr, "cc-filter: %v\nRun 'cc-filter --help' for usage.\n", err)
+		os.Exit(2)
+	}
+	if opts.help {
+		showHelp()
+		return
+	}
+	if opts.version {
+		showVersion()
+		return
+	}
+
+	// Codex CLI passes its notify payload as an argument rather than on stdin
+	var stdin io.Reader = os.Stdin
+	if len(args) == 1 && strings.HasPrefix(args[0], "{") {
+		stdin, args = strings.NewReader(args[0]), nil
+	}
+
+	if len(args) > 0 {
+		switch args[0] {
+		case "help":
 			showHelp()
 			return
-		case "-v", "--version", "version":
+		case "version":
 			showVersion()
 			return
+		case "override":
+			runOverride(opts, args[1:])
+			return
+		case "config":
+			runConfig(opts, args[1:])
+			return
+		case "rules":
+			runRules(opts, args[1:])
+			return
+		case "audit":
+			runAudit(opts, args[1:])
+			return
+		case "metrics":
+			runMetrics(opts, args[1:])
+			return
+		case "policy":
+			runPolicy(opts, args[1:])
+			return
+		default:
+			fmt.Fprintf(os.Stderr, "cc-filter: unknown command %q\nRun 'cc-filter --help' for usage.\n", args[0])
+			os.Exit(2)
 		}
 	}
 
-	logger.Setup()
+	// nothing the rules match may reach the logs, so the redactor is in
+	// place before the first line is written
+	key, keyErr := fingerprintKey()
+	redactor := filter.NewRedactor(defaultRulesYAML, key)
+	logger.SetRedactor(redactor.Redact)
+	logger.Setup(opts.logFile, opts.logRotation)
+	for _, warning := range opts.warnings {
+		log.Printf("Option warning: %s", warning)
+		fmt.Fprintf(os.Stderr, "cc-filter: %s\n", warning)
+	}
+	if keyErr != nil {
+		log.Printf("Fingerprint key unavailable, fingerprints are only comparable within this run: %v", keyErr)
+	}
 
 	start := time.Now()
 
-	f, err := filter.New(defaultRulesYAML)
+	filterOptions := opts.filterOptions()
+	filterOptions.Redactor = redactor
+	if opts.metrics != "" {
+		filterOptions.Metrics = metrics.New()
+	}
+	audit, err := logger.OpenAudit(opts.auditLog, opts.logRotation)
+	if err != nil {
+		log.Printf("Audit log disabled: %v", err)
+	} else if audit != nil {
+		filterOptions.Audit = audit.With("version", version)
+	}
+
+	f, err := filter.New(defaultRulesYAML, filterOptions)
 	if err != nil {
 		log.Printf("Failed to initialize filter: %v", err)
 		fmt.Fprintf(os.Stderr, "Failed to initialize filter: %v\n", err)
 		os.Exit(1)
 	}
 
-	input := readStdin()
-	inputLength := len(input)
+	input := &countingReader{r: stdin}
+	stdout := bufio.NewWriter(os.Stdout)
+	output := &countingWriter{w: stdout}
 
-	result := f.Process(input)
+	result, err := f.ProcessReader(output, input)
+	if flushErr := stdout.Flush(); err == nil {
+		err = flushErr
+	}
+	if filterOptions.Metrics != nil {
+		// before exiting: a blocked prompt exits 2 below
+		if err := metrics.UpdateTextfile(opts.metrics, filterOptions.Metrics); err != nil {
+			log.Printf("Failed to update metrics: %v", err)
+		}
+	}
+	if err != nil {
+		log.Printf("Error processing input: %v", err)
+		fmt.Fprintf(os.Stderr, "Error processing input: %v\n", err)
+		os.Exit(1)
+	}
 
 	// Check for blocking error from hooks - EXIT CODE 2 BLOCKS THE PROMPT
 	if result.Error != nil {
@@ -54,33 +143,89 @@ func main() {
 		os.Exit(2) // Exit code 2 = blocks UserPromptSubmit, erases prompt
 	}
 
-	outputLength := len(result.Output)
-
-	fmt.Print(result.Output)
-
 	if result.Filtered {
 		duration := time.Since(start)
 		log.Printf("cc-filter applied filtering at %s - Input: %d bytes, Output: %d bytes, Duration: %v",
-			start.Format(time.RFC3339), inputLength, outputLength, duration)
+			start.Format(time.RFC3339), input.n, output.n, duration)
 	}
 }
 
-func readStdin() string {
-	scanner := bufio.NewScanner(os.Stdin)
-	var input strings.Builder
-	
-	for scanner.Scan() {
-		input.WriteString(scanner.Text())
-		input.WriteString("\n")
-	}
-	
-	if err := scanner.Err(); err != nil {
-		log.Printf("Error reading input: %v", err)
-		fmt.Fprintf(os.Stderr, "Error reading input: %v\n", err)
+// fingerprintKey returns the key log fingerprints are keyed with; nil
+// means a random one
+func fingerprintKey() ([]byte, error) {
+	path := logger.DefaultKeyFile()
+	if path == "" {
+		return nil, nil
+	}
+	return logger.FingerprintKey(path)
+}
+
+// runOverride grants a one-time approval for an access cc-filter denied
+func runOverride(opts *options, args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: cc-filter override <token>")
+		os.Exit(1)
+	}
+
+	logger.Setup(opts.logFile, opts.logRotation)
+
+	if err := confirmOverride(args[0]); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to grant override: %v\n", err)
 		os.Exit(1)
 	}
-	
-	return strings.TrimSuffix(input.String(), "\n")
+	if err := hooks.GrantOverride(args[0]); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to grant override: %v\n", err)
+		os.Exit(1)
+	}
+
+	log.Printf("Override %s granted by user", args[0])
+	fmt.Printf("Override %s granted. The agent may retry the denied access once within the next hour.\n", args[0])
+}
+
+// confirmOverride asks the user to confirm a grant by typing a random code
+// on their terminal. The code is shown and read there only, never on the
+// standard streams an agent's command is given.
+func confirmOverride(token string) error {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("overrides can only be granted from an interactive terminal")
+	}
+	defer tty.Close()
+
+	code := make([]byte, 3)
+	if _, err := rand.Read(code); err != nil {
+		return err
+	}
+	fmt.Fprintf(tty, "Allow the access denied with %s once?\nType %x to confirm: ", token, code)
+	answer, _ := bufio.NewReader(tty).ReadString('\n')
+	if strings.TrimSpace(answer) != fmt.Sprintf("%x", code) {
+		return fmt.Errorf("not confirmed")
+	}
+	return nil
+}
+
+// countingReader and countingWriter count the bytes cc-filter reads and
+// writes for the log
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
 }
 
 func showHelp() {
@@ -88,11 +233,72 @@ func showHelp() {
 
 USAGE:
     cc-filter [OPTIONS]
+    cc-filter override <token>
+    cc-filter config show [--effective] [--origin] [--dir DIR]
+    cc-filter config validate [--dir DIR] [FILE...]
+    cc-filter rules test [--dir DIR] [--verbose]
+    cc-filter rules import --from FORMAT FILE
+    cc-filter audit [summary|sessions|log] [FILTERS]
+    cc-filter metrics show|serve
+    cc-filter policy keygen|sign|verify
 
 OPTIONS:
+    --config FILE          Merge FILE on top of the other configs (repeatable)
+    --no-user-config       Skip ~/.cc-filter/config.yaml
+    --rules-only           Use only the defaults, the organization policy and
+                           --config files
+    --log-file FILE        Log to FILE instead of ~/.cc-filter/filter.log
+                           ("-" logs to stderr)
+    --audit-log FILE       Record decisions as JSON lines in FILE instead of
+                           ~/.cc-filter/audit.jsonl ("-" for stderr, "off")
+    --metrics-textfile FILE
+                           Count decisions in FILE, a Prometheus textfile
+                           (e.g. in node-exporter's textfile directory)
+    --log-max-size MB      Rotate a log once it reaches MB megabytes (10)
+    --log-max-age DAYS     Delete rotated logs older than DAYS days (30)
+    --log-max-backups N    Keep at most N rotated files per log (50)
+    --cache-dir DIR        Keep redacted file copies under DIR
+    --mode MODE            enforce (default) or audit: log what would have
+                           been blocked or redacted, but change nothing
+    --on-config-error P    fail_closed (default) or fail_open
+    --policy-key KEY       Verify the organization policy with this base64
+                           public key (ignored if one is built in)
     -h, --help, help       Show this help message
     -v, --version, version Show version information
 
+    Options go before the command, e.g. cc-filter --rules-only config show.
+
+COMMANDS:
+    override <token>       Allow a denied access once (requires allow_overrides: true)
+    config show            List the configuration files in effect
+        --effective        Print the merged configuration
+        --origin           Annotate each entry with the file it came from
+        --dir DIR          Discover project configs from DIR
+    config validate        Check every config layer, or only the given files,
+                           and report errors and warnings with line numbers
+    rules test             Check every pattern against its examples
+        --dir DIR          Discover project configs from DIR
+        --verbose          List passing examples too
+    rules import           Convert gitleaks, detect-secrets or trufflehog
+                           rules to cc-filter patterns
+        --from FORMAT      gitleaks, detect-secrets or trufflehog
+    audit [summary]        Summarize the audit log: decisions, top rules, most
+                           denied paths and false-positive candidates
+        --since WHEN       Only decisions since 7d, 24h, 2025-09-01, ...
+        --session ID       Only one session's decisions
+        --rule NAME        Only decisions citing NAME
+        --decision LIST    Only these decisions, e.g. deny,override
+        --top N            Entries per list (10)
+        --format FORMAT    table (default) or json
+    audit sessions         Per-session timelines (same filters)
+    audit log              The matching decisions (same filters)
+    metrics show           Print the metrics kept in --metrics-textfile
+    metrics serve          Serve them on http://127.0.0.1:9464/metrics
+        --listen ADDR      Listen on ADDR instead
+    policy keygen          Create a key pair for signing the organization policy
+    policy sign            Sign a policy file (--key FILE POLICY)
+    policy verify          Check the installed (or given) policy's signature
+
 DESCRIPTION:
     cc-filter is a security tool that filters sensitive information from text input.
     It reads from stdin and outputs filtered text to stdout.
@@ -111,17 +317,46 @@ EXAMPLES:
     # Filter a file
     cat config.txt | cc-filter
 
-    # Use with Claude Code hooks (see README for setup)
+    # Use with Claude Code, Cursor or Gemini CLI hooks (see README for setup)
 
 CONFIGURATION:
     • Default rules: configs/default-rules.yaml
+    • Organization policy: /etc/cc-filter/policy.yaml (optionally signed;
+      its locked rules cannot be weakened by the configs below)
     • User config: ~/.cc-filter/config.yaml
-    • Project config: config.yaml
+    • Project config: .cc-filter.yaml or .cc-filter/config.yaml, in every
+      directory from the git root down to the hook's cwd
+    • plugins: external programs consulted on every hook decision, which
+      can veto or annotate it (ignored in project configs)
+    • --on-config-error fail_closed (default) denies tool calls and blocks
+      prompts while the config is invalid; fail_open skips the invalid
+      parts and filters with the rest
+
+ENVIRONMENT:
+    Every option can also be set with an environment variable. A flag wins
+    over the environment, which wins over the default.
+    CC_FILTER_CONFIG          --config (list separated by ":", ";" on Windows)
+    CC_FILTER_NO_USER_CONFIG  --no-user-config (true/false)
+    CC_FILTER_RULES_ONLY      --rules-only (true/false)
+    CC_FILTER_LOG_FILE        --log-file
+    CC_FILTER_AUDIT_LOG       --audit-log
+    CC_FILTER_METRICS_TEXTFILE --metrics-textfile
+    CC_FILTER_LOG_MAX_SIZE    --log-max-size
+    CC_FILTER_LOG_MAX_AGE     --log-max-age
+    CC_FILTER_LOG_MAX_BACKUPS --log-max-backups
+    CC_FILTER_CACHE_DIR       --cache-dir
+    CC_FILTER_MODE            --mode
+    CC_FILTER_ON_CONFIG_ERROR --on-config-error
+    CC_FILTER_POLICY_KEY      --policy-key
 
     See README.md for configuration examples.
 
-LOG FILE:
-    ~/.cc-filter/filter.log
+LOG FILES:
+    ~/.cc-filter/filter.log (see --log-file)
+    ~/.cc-filter/audit.jsonl, one JSON object per decision (see --audit-log)
+    Both are readable by you only, rotated daily or at --log-max-size and
+    gzipped. Anything the rules match is replaced in them by the rule name
+    and an HMAC fingerprint keyed with ~/.cc-filter/fingerprint.key.
 
 MORE INFO:
     https://github.com/wissem/cc-filter
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/wissem/cc-filter/internal/metrics"
+)
+
+const metricsUsage = `Usage:
+    cc-filter --metrics-textfile FILE metrics show
+    cc-filter --metrics-textfile FILE metrics serve [--listen ADDR]`
+
+// runMetrics implements the "metrics" subcommands. Decisions are counted
+// by every hook run into the --metrics-textfile file; these commands read
+// it.
+func runMetrics(opts *options, args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, metricsUsage)
+		os.Exit(1)
+	}
+	if opts.metrics == "" {
+		fmt.Fprintln(os.Stderr, "cc-filter metrics: no metrics are kept; set --metrics-textfile or CC_FILTER_METRICS_TEXTFILE as your hooks do")
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "show":
+		m, err := metrics.ReadTextfile(opts.metrics)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read metrics: %v\n", err)
+			os.Exit(1)
+		}
+		m.Write(os.Stdout, false)
+	case "serve":
+		runMetricsServe(opts, args[1:])
+	default:
+		fmt.Fprintln(os.Stderr, metricsUsage)
+		os.Exit(1)
+	}
+}
+
+// runMetricsServe exposes the textfile on /metrics for scrapers that
+// collect over HTTP rather than through node-exporter
+func runMetricsServe(opts *options, args []string) {
+	flags := flag.NewFlagSet("metrics serve", flag.ExitOnError)
+	listen := flags.String("listen", "127.0.0.1:9464", "address to serve /metrics on")
+	flags.Parse(args)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler(opts.metrics))
+	server := &http.Server{Addr: *listen, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	fmt.Fprintf(os.Stderr, "Serving %s on http://%s/metrics\n", opts.metrics, *listen)
+	if err := server.ListenAndServe(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to serve metrics: %v\n", err)
+		os.Exit(1)
+	}
+}
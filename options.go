@@ -0,0 +1,199 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wissem/cc-filter/internal/filter"
+	"github.com/wissem/cc-filter/internal/logger"
+	"github.com/wissem/cc-filter/internal/rules"
+)
+
+// options are the global settings. Each one can be set by a flag or by a
+// CC_FILTER_* environment variable; a flag wins over the environment, and
+// the environment wins over the default.
+type options struct {
+	configs       []string
+	noUserConfig  bool
+	rulesOnly     bool
+	logFile       string
+	auditLog      string
+	logRotation   logger.Rotation
+	metrics       string // the Prometheus textfile decisions are counted in
+	cacheDir      string
+	mode          filter.Mode
+	onConfigError filter.ConfigErrorPolicy
+	policyKey     string // the key the policy must be signed with, unless one is built in
+
+	help    bool
+	version bool
+
+	// warnings are invalid settings that were replaced by their safe default.
+	// Hooks must still run, so these never stop cc-filter.
+	warnings []string
+}
+
+// configList is the repeatable --config flag. The first flag replaces the
+// list taken from CC_FILTER_CONFIG rather than adding to it.
+type configList struct {
+	paths   *[]string
+	fromEnv bool
+}
+
+func (c *configList) String() string {
+	if c.paths == nil {
+		return ""
+	}
+	return strings.Join(*c.paths, string(os.PathListSeparator))
+}
+
+func (c *configList) Set(path string) error {
+	if c.fromEnv {
+		*c.paths = nil
+		c.fromEnv = false
+	}
+	*c.paths = append(*c.paths, path)
+	return nil
+}
+
+// parseOptions reads the environment, then the global flags in args, and
+// returns the remaining arguments (the subcommand, if any)
+func parseOptions(args []string) (*options, []string, error) {
+	o := &options{}
+	if value := os.Getenv("CC_FILTER_CONFIG"); value != "" {
+		for _, path := range filepath.SplitList(value) {
+			if path != "" {
+				o.configs = append(o.configs, path)
+			}
+		}
+	}
+	o.noUserConfig = o.envBool("CC_FILTER_NO_USER_CONFIG")
+	o.rulesOnly = o.envBool("CC_FILTER_RULES_ONLY")
+	o.logFile = os.Getenv("CC_FILTER_LOG_FILE")
+	o.auditLog = os.Getenv("CC_FILTER_AUDIT_LOG")
+	o.metrics = os.Getenv("CC_FILTER_METRICS_TEXTFILE")
+	o.cacheDir = os.Getenv("CC_FILTER_CACHE_DIR")
+	mode := os.Getenv("CC_FILTER_MODE")
+	onConfigError := os.Getenv("CC_FILTER_ON_CONFIG_ERROR")
+	logMaxSize := os.Getenv("CC_FILTER_LOG_MAX_SIZE")
+	logMaxAge := os.Getenv("CC_FILTER_LOG_MAX_AGE")
+	logMaxBackups := os.Getenv("CC_FILTER_LOG_MAX_BACKUPS")
+	o.policyKey = os.Getenv("CC_FILTER_POLICY_KEY")
+
+	flags := flag.NewFlagSet("cc-filter", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	flags.Var(&configList{paths: &o.configs, fromEnv: len(o.configs) > 0}, "config", "")
+	flags.BoolVar(&o.noUserConfig, "no-user-config", o.noUserConfig, "")
+	flags.BoolVar(&o.rulesOnly, "rules-only", o.rulesOnly, "")
+	flags.StringVar(&o.logFile, "log-file", o.logFile, "")
+	flags.StringVar(&o.auditLog, "audit-log", o.auditLog, "")
+	flags.StringVar(&logMaxSize, "log-max-size", logMaxSize, "")
+	flags.StringVar(&logMaxAge, "log-max-age", logMaxAge, "")
+	flags.StringVar(&logMaxBackups, "log-max-backups", logMaxBackups, "")
+	flags.StringVar(&o.metrics, "metrics-textfile", o.metrics, "")
+	flags.StringVar(&o.cacheDir, "cache-dir", o.cacheDir, "")
+	flags.StringVar(&mode, "mode", mode, "")
+	flags.StringVar(&onConfigError, "on-config-error", onConfigError, "")
+	flags.StringVar(&o.policyKey, "policy-key", o.policyKey, "")
+	flags.BoolVar(&o.version, "v", false, "")
+	flags.BoolVar(&o.version, "version", false, "")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			o.help = true
+			return o, nil, nil
+		}
+		return nil, nil, err
+	}
+
+	var err error
+	if o.mode, err = filter.ParseMode(mode); err != nil {
+		o.warnings = append(o.warnings, fmt.Sprintf("%v; using %s", err, o.mode))
+	}
+	if o.onConfigError, err = filter.ParseConfigErrorPolicy(onConfigError); err != nil {
+		o.warnings = append(o.warnings, fmt.Sprintf("%v; using %s", err, o.onConfigError))
+	}
+	o.logRotation = logger.DefaultRotation
+	o.logRotation.MaxSize = int64(o.count("log-max-size", logMaxSize, int(o.logRotation.MaxSize>>20))) << 20
+	o.logRotation.MaxAge = time.Duration(o.count("log-max-age", logMaxAge, int(o.logRotation.MaxAge/(24*time.Hour)))) * 24 * time.Hour
+	o.logRotation.MaxBackups = o.count("log-max-backups", logMaxBackups, o.logRotation.MaxBackups)
+
+	// relative paths are resolved once, so the config's origin is reported
+	// the same way whichever directory the hook's rules are loaded for
+	for i, path := range o.configs {
+		if abs, err := filepath.Abs(path); err == nil {
+			o.configs[i] = abs
+		}
+	}
+	return o, flags.Args(), nil
+}
+
+// envBool reads a boolean environment variable. Unset or invalid means false;
+// an invalid value is also reported.
+func (o *options) envBool(name string) bool {
+	value := os.Getenv(name)
+	if value == "" {
+		return false
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		o.warnings = append(o.warnings, fmt.Sprintf("invalid %s=%q: must be true or false; using false", name, value))
+		return false
+	}
+	return b
+}
+
+// count parses a non-negative whole number option. Unset or invalid means
+// def; an invalid value is also reported.
+func (o *options) count(name, value string, def int) int {
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		o.warnings = append(o.warnings, fmt.Sprintf("invalid --%s %q: must be a whole number, 0 for no limit; using %d", name, value, def))
+		return def
+	}
+	return n
+}
+
+// loadOptions returns the options configuration is loaded with, so the
+// subcommands see the same layers and policy as the hooks. With
+// --rules-only only the defaults, the organization policy and --config
+// files apply.
+func (o *options) loadOptions(dir string) rules.LoadOptions {
+	return rules.LoadOptions{
+		Dir:              dir,
+		PolicyPublicKey:  o.pinnedPolicyKey(),
+		ExtraConfigs:     o.configs,
+		NoUserConfig:     o.noUserConfig || o.rulesOnly,
+		NoProjectConfigs: o.rulesOnly,
+	}
+}
+
+// pinnedPolicyKey returns the key the organization policy is verified
+// with: the one built into the binary, else --policy-key. A key installed
+// next to the policy is never trusted, since whoever can replace the policy
+// can replace it too.
+func (o *options) pinnedPolicyKey() string {
+	if policyPublicKey != "" {
+		return policyPublicKey
+	}
+	return o.policyKey
+}
+
+// filterOptions returns the options the hook and text filter run with
+func (o *options) filterOptions() filter.Options {
+	return filter.Options{
+		OnConfigError: o.onConfigError,
+		Load:          o.loadOptions(""),
+		CacheDir:      o.cacheDir,
+		Mode:          o.mode,
+	}
+}
@@ -0,0 +1,380 @@
+// Package ccfilter filters secrets and other sensitive data out of text and
+// answers coding agent hook calls, exactly as the cc-filter command does,
+// for Go programs that would otherwise shell out to the binary.
+//
+//	f, err := ccfilter.New(ccfilter.Options{})
+//	if err != nil {
+//		return err
+//	}
+//	result, err := f.Redact(ctx, message)
+//
+// # Compatibility
+//
+// This package follows semantic versioning from v1.0.0 of the module:
+// within a major version, exported identifiers are not removed or changed
+// incompatibly, and new Options fields default to the previous behavior.
+// What counts as a secret is not part of the API: the built-in rules,
+// the exact redacted text and the wording of Reason change in minor
+// releases. Everything under internal/ may change at any time.
+package ccfilter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"strings"
+
+	"github.com/wissem/cc-filter/configs"
+	"github.com/wissem/cc-filter/internal/filter"
+	"github.com/wissem/cc-filter/internal/logger"
+	"github.com/wissem/cc-filter/internal/rules"
+)
+
+var (
+	// ErrInvalidConfig is returned by New when a config file is invalid and
+	// Options.OnConfigError is FailClosed
+	ErrInvalidConfig = errors.New("invalid cc-filter configuration")
+
+	// ErrUntrustedPolicy is returned by New when the organization policy is
+	// missing, unreadable or wrongly signed, whatever Options.OnConfigError
+	ErrUntrustedPolicy = errors.New("untrusted cc-filter organization policy")
+
+	// ErrNotHook is returned by EvaluateHook for payloads that are not a
+	// hook event cc-filter handles
+	ErrNotHook = errors.New("not a supported hook payload")
+)
+
+// Mode decides whether decisions are enforced or only logged
+type Mode string
+
+const (
+	// ModeEnforce redacts and blocks
+	ModeEnforce Mode = "enforce"
+	// ModeAudit leaves text and hook calls unchanged and logs what enforce
+	// mode would have done. Scan is the same in both modes.
+	ModeAudit Mode = "audit"
+)
+
+// ConfigErrorPolicy decides what happens when a config file is invalid
+type ConfigErrorPolicy string
+
+const (
+	// FailClosed makes New return ErrInvalidConfig
+	FailClosed ConfigErrorPolicy = "fail_closed"
+	// FailOpen skips invalid files and rules, logging what was skipped
+	FailOpen ConfigErrorPolicy = "fail_open"
+)
+
+// Options configures a Filter. The zero value behaves like the cc-filter
+// command run without flags in the current directory.
+type Options struct {
+	// Dir is the directory project configs are discovered from; empty means
+	// the working directory. Hook payloads with an absolute cwd use theirs.
+	Dir string
+
+	// Configs are merged, in order, on top of every other config file.
+	// They must exist.
+	Configs []string
+
+	// NoUserConfig skips ~/.cc-filter/config.yaml. RulesOnly also skips
+	// project configs, leaving the built-in rules, the organization policy
+	// and Configs. The organization policy always applies.
+	NoUserConfig bool
+	RulesOnly    bool
+
+	// DefaultRules replaces the built-in rules, in the config file format
+	DefaultRules []byte
+
+	// PolicyPublicKey pins the base64 ed25519 key the organization policy
+	// must be signed with
+	PolicyPublicKey string
+
+	Mode          Mode              // default ModeEnforce
+	OnConfigError ConfigErrorPolicy // default FailClosed
+
+	// Logger receives log lines; nil means log.Default(). Anything the rules
+	// match is replaced in them by the rule name and a fingerprint.
+	Logger *log.Logger
+
+	// Audit receives one JSON-ready record per hook evaluated, in the
+	// format of the command's audit log; nil records nothing
+	Audit *slog.Logger
+
+	// FingerprintKey keys the fingerprints in log lines and audit records;
+	// nil means a random key, so they can only be compared within one Filter
+	FingerprintKey []byte
+
+	// CacheDir is where redacted copies of files are kept for hooks; empty
+	// means the command's default
+	CacheDir string
+}
+
+// Filter scans and redacts text and evaluates hooks. It is safe for
+// concurrent use.
+type Filter struct {
+	filter *filter.Filter
+	rules  *rules.Rules
+	mode   Mode
+	logger *log.Logger
+}
+
+// New loads the configuration described by opts
+func New(opts Options) (*Filter, error) {
+	mode, err := filter.ParseMode(string(opts.Mode))
+	if err != nil {
+		return nil, err
+	}
+	onConfigError, err := filter.ParseConfigErrorPolicy(string(opts.OnConfigError))
+	if err != nil {
+		return nil, err
+	}
+	defaultRules := opts.DefaultRules
+	if defaultRules == nil {
+		defaultRules = configs.DefaultRules
+	}
+	out := opts.Logger
+	if out == nil {
+		out = log.Default()
+	}
+	redactor := filter.NewRedactor(defaultRules, opts.FingerprintKey)
+	redacted := log.New(logger.NewRedactingWriter(out.Writer(), redactor.Redact), out.Prefix(), out.Flags())
+
+	f, err := filter.New(defaultRules, filter.Options{
+		OnConfigError: onConfigError,
+		Load: rules.LoadOptions{
+			Dir:              opts.Dir,
+			PolicyPublicKey:  opts.PolicyPublicKey,
+			ExtraConfigs:     opts.Configs,
+			NoUserConfig:     opts.NoUserConfig || opts.RulesOnly,
+			NoProjectConfigs: opts.RulesOnly,
+		},
+		CacheDir: opts.CacheDir,
+		Mode:     mode,
+		Logger:   redacted,
+		Audit:    opts.Audit,
+		Redactor: redactor,
+	})
+	if err == nil {
+		err = f.LoadError()
+	}
+	if err != nil {
+		var policyErr *rules.PolicyError
+		if errors.As(err, &policyErr) {
+			return nil, fmt.Errorf("%w: %v", ErrUntrustedPolicy, err)
+		}
+		return nil, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+
+	return &Filter{filter: f, rules: f.Rules(), mode: Mode(mode), logger: redacted}, nil
+}
+
+// Finding is one piece of sensitive data found in a text
+type Finding struct {
+	Rule  string // name of the pattern that found it
+	Start int    // byte offset of the first byte
+	End   int    // byte offset just past the last byte
+	Line  int    // 1-based line of Start
+}
+
+// Scan returns what Redact would redact in text, in text order
+func (f *Filter) Scan(ctx context.Context, text string) ([]Finding, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var findings []Finding
+	line, counted := 1, 0
+	for _, finding := range f.rules.Findings(text) {
+		line += strings.Count(text[counted:finding.Start], "\n")
+		counted = finding.Start
+		findings = append(findings, Finding{Rule: finding.Pattern, Start: finding.Start, End: finding.End, Line: line})
+	}
+	return findings, nil
+}
+
+// Result is the outcome of Redact
+type Result struct {
+	// Text is the redacted text; in ModeAudit it is the input unchanged
+	Text     string
+	Findings []Finding
+}
+
+// Redacted reports whether anything was found
+func (r Result) Redacted() bool {
+	return len(r.Findings) > 0
+}
+
+// Redact replaces every finding in text. Line breaks inside a finding are
+// kept, so line numbers stay valid.
+func (f *Filter) Redact(ctx context.Context, text string) (Result, error) {
+	findings, err := f.Scan(ctx, text)
+	if err != nil {
+		return Result{}, err
+	}
+	if f.mode == ModeAudit {
+		if len(findings) > 0 {
+			f.logger.Printf("AUDIT: enforce mode would have redacted this input: patterns %s", strings.Join(findingRules(findings), ", "))
+		}
+		return Result{Text: text, Findings: findings}, nil
+	}
+	return Result{Text: f.rules.FilterContent(text).Content, Findings: findings}, nil
+}
+
+// StreamResult is the outcome of RedactReader
+type StreamResult struct {
+	Rules       []string // names of the patterns that found something
+	InputBytes  int64
+	OutputBytes int64
+}
+
+// RedactReader copies src to dst with every finding replaced, in bounded
+// memory whatever the input size. Bytes outside findings are copied
+// exactly. In ModeAudit src is copied unchanged.
+func (f *Filter) RedactReader(ctx context.Context, dst io.Writer, src io.Reader) (StreamResult, error) {
+	src = &contextReader{ctx: ctx, r: src}
+	if f.mode == ModeAudit {
+		stream, err := f.rules.FilterReader(io.Discard, io.TeeReader(src, dst))
+		if err == nil && stream.Filtered {
+			f.logger.Printf("AUDIT: enforce mode would have redacted this input: patterns %s", strings.Join(stream.MatchedPatterns, ", "))
+		}
+		return StreamResult{Rules: stream.MatchedPatterns, InputBytes: stream.InputBytes, OutputBytes: stream.InputBytes}, err
+	}
+	stream, err := f.rules.FilterReader(dst, src)
+	return StreamResult{Rules: stream.MatchedPatterns, InputBytes: stream.InputBytes, OutputBytes: stream.OutputBytes}, err
+}
+
+// Action is what a hook decision does to the agent's request
+type Action string
+
+const (
+	// ActionAllow lets the request through, possibly rewritten (see Response)
+	ActionAllow Action = "allow"
+	// ActionAsk asks the user to confirm a tool call
+	ActionAsk Action = "ask"
+	// ActionDeny denies a tool call, withholds a tool's output or blocks a
+	// prompt
+	ActionDeny Action = "deny"
+)
+
+// Decision is the answer to one hook call
+type Decision struct {
+	Action Action
+	Reason string // why, for ActionAsk and ActionDeny
+
+	// Response is the JSON the hook command writes to stdout; empty means
+	// no output. ExitCode is what it exits with: 2 means blocked, with
+	// Reason written to stderr.
+	Response []byte
+	ExitCode int
+}
+
+// EvaluateHook answers a Claude Code, Cursor or Gemini CLI hook payload the
+// way the cc-filter hook command would. It returns ErrNotHook for anything
+// else.
+func (f *Filter) EvaluateHook(ctx context.Context, payload []byte) (Decision, error) {
+	if err := ctx.Err(); err != nil {
+		return Decision{}, err
+	}
+
+	var hookData map[string]interface{}
+	if err := json.Unmarshal(payload, &hookData); err != nil {
+		return Decision{}, fmt.Errorf("%w: %v", ErrNotHook, err)
+	}
+	result, handled := f.filter.ProcessHook(hookData)
+	if !handled {
+		return Decision{}, ErrNotHook
+	}
+	if result.Error != nil {
+		return Decision{Action: ActionDeny, Reason: result.Error.Error(), ExitCode: 2}, nil
+	}
+
+	decision := Decision{Action: ActionAllow}
+	if result.Output == "" {
+		return decision, nil
+	}
+	decision.Response = []byte(result.Output)
+
+	var response struct {
+		Decision           string `json:"decision"`
+		Reason             string `json:"reason"`
+		Permission         string `json:"permission"`   // Cursor
+		AgentMessage       string `json:"agentMessage"` // Cursor
+		Continue           *bool  `json:"continue"`     // Cursor prompts
+		UserMessage        string `json:"userMessage"`  // Cursor prompts
+		HookSpecificOutput struct {
+			PermissionDecision       string `json:"permissionDecision"`
+			PermissionDecisionReason string `json:"permissionDecisionReason"`
+		} `json:"hookSpecificOutput"`
+	}
+	if err := json.Unmarshal(decision.Response, &response); err != nil {
+		return Decision{}, fmt.Errorf("unexpected hook response: %w", err)
+	}
+	switch {
+	case response.Decision == "block":
+		decision.Action, decision.Reason = ActionDeny, response.Reason
+	case response.Decision != "":
+		// Gemini CLI
+		decision.Action, decision.Reason = Action(response.Decision), response.Reason
+	case response.Permission != "":
+		decision.Action, decision.Reason = Action(response.Permission), response.AgentMessage
+	case response.Continue != nil && !*response.Continue:
+		decision.Action, decision.Reason = ActionDeny, response.UserMessage
+	case response.HookSpecificOutput.PermissionDecision != "":
+		decision.Action = Action(response.HookSpecificOutput.PermissionDecision)
+		decision.Reason = response.HookSpecificOutput.PermissionDecisionReason
+	}
+	return decision, nil
+}
+
+// ExampleResult is the outcome of checking one pattern example
+type ExampleResult struct {
+	Pattern   string // name of the pattern
+	Source    string // config file the pattern came from
+	Input     string
+	WantMatch bool // whether the example is listed under match
+	Passed    bool
+}
+
+// CheckExamples runs every enabled pattern in effect against the examples
+// declared with it, as "cc-filter rules test" does
+func (f *Filter) CheckExamples() []ExampleResult {
+	var results []ExampleResult
+	for _, result := range f.rules.CheckExamples() {
+		results = append(results, ExampleResult(result))
+	}
+	return results
+}
+
+// PatternsWithoutExamples lists the enabled patterns that declare no examples
+func (f *Filter) PatternsWithoutExamples() []string {
+	return f.rules.PatternsWithoutExamples()
+}
+
+func findingRules(findings []Finding) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, finding := range findings {
+		if !seen[finding.Rule] {
+			seen[finding.Rule] = true
+			names = append(names, finding.Rule)
+		}
+	}
+	return names
+}
+
+// contextReader stops reading once ctx is done
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
@@ -0,0 +1,155 @@
+package ccfilter_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wissem/cc-filter/pkg/ccfilter"
+)
+
+func newFilter(t *testing.T, opts ccfilter.Options) *ccfilter.Filter {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	opts.RulesOnly = true
+	opts.CacheDir = filepath.Join(t.TempDir(), "cache")
+	opts.Logger = log.New(io.Discard, "", 0)
+	f, err := ccfilter.New(opts)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return f
+}
+
+func TestScanAndRedact(t *testing.T) {
+	f := newFilter(t, ccfilter.Options{})
+	ctx := context.Background()
+	text := "deploy notes\nAPI_KEY=abcdefghij1234567890XYZ\nok\n"
+
+	findings, err := f.Scan(ctx, text)
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	if len(findings) != 1 || findings[0].Rule != "api_keys" || findings[0].Line != 2 {
+		t.Fatalf("Scan() = %+v, want one api_keys finding on line 2", findings)
+	}
+	if got := text[findings[0].Start:findings[0].End]; !strings.HasPrefix(got, "API_KEY=") {
+		t.Errorf("finding covers %q", got)
+	}
+
+	result, err := f.Redact(ctx, text)
+	if err != nil {
+		t.Fatalf("Redact: %v", err)
+	}
+	if !result.Redacted() || strings.Contains(result.Text, "abcdefghij") || !strings.HasSuffix(result.Text, "\nok\n") {
+		t.Errorf("Redact() = %q", result.Text)
+	}
+
+	var out bytes.Buffer
+	stream, err := f.RedactReader(ctx, &out, strings.NewReader(text))
+	if err != nil {
+		t.Fatalf("RedactReader: %v", err)
+	}
+	if out.String() != result.Text || len(stream.Rules) != 1 {
+		t.Errorf("RedactReader() = %q %v, want %q", out.String(), stream.Rules, result.Text)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := f.Redact(cancelled, text); !errors.Is(err, context.Canceled) {
+		t.Errorf("Redact with a cancelled context: err = %v", err)
+	}
+}
+
+func TestAuditModeChangesNothing(t *testing.T) {
+	f := newFilter(t, ccfilter.Options{Mode: ccfilter.ModeAudit})
+	text := "API_KEY=abcdefghij1234567890XYZ"
+
+	result, err := f.Redact(context.Background(), text)
+	if err != nil {
+		t.Fatalf("Redact: %v", err)
+	}
+	if result.Text != text || !result.Redacted() {
+		t.Errorf("Redact() = %q, %d findings; want the input unchanged with its findings", result.Text, len(result.Findings))
+	}
+
+	decision, err := f.EvaluateHook(context.Background(), []byte(`{"hook_event_name":"PreToolUse","tool_name":"Read","tool_input":{"file_path":"/app/.env"}}`))
+	if err != nil {
+		t.Fatalf("EvaluateHook: %v", err)
+	}
+	if decision.Action != ccfilter.ActionAllow {
+		t.Errorf("Action = %s, want allow in audit mode", decision.Action)
+	}
+}
+
+func TestEvaluateHook(t *testing.T) {
+	f := newFilter(t, ccfilter.Options{})
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		payload  string
+		action   ccfilter.Action
+		exitCode int
+	}{
+		{"denied read", `{"hook_event_name":"PreToolUse","tool_name":"Read","tool_input":{"file_path":"/app/.env"}}`, ccfilter.ActionDeny, 0},
+		{"allowed read", `{"hook_event_name":"PreToolUse","tool_name":"Read","tool_input":{"file_path":"/app/main.go"}}`, ccfilter.ActionAllow, 0},
+		{"blocked prompt", `{"hook_event_name":"UserPromptSubmit","prompt":"use API_KEY=abcdefghij1234567890XYZ"}`, ccfilter.ActionDeny, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision, err := f.EvaluateHook(ctx, []byte(tt.payload))
+			if err != nil {
+				t.Fatalf("EvaluateHook: %v", err)
+			}
+			if decision.Action != tt.action || decision.ExitCode != tt.exitCode {
+				t.Errorf("decision = %s/%d, want %s/%d", decision.Action, decision.ExitCode, tt.action, tt.exitCode)
+			}
+			if decision.Action != ccfilter.ActionAllow && decision.Reason == "" {
+				t.Error("missing reason")
+			}
+		})
+	}
+
+	if _, err := f.EvaluateHook(ctx, []byte(`{"event":"push"}`)); !errors.Is(err, ccfilter.ErrNotHook) {
+		t.Errorf("unknown payload: err = %v, want ErrNotHook", err)
+	}
+}
+
+func TestNewRejectsInvalidConfig(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "bad.yaml")
+	os.WriteFile(config, []byte("patterns:\n  - name: broken\n    regex: '(unclosed'\n"), 0644)
+
+	_, err := ccfilter.New(ccfilter.Options{RulesOnly: true, Configs: []string{config}, Logger: log.New(io.Discard, "", 0)})
+	if !errors.Is(err, ccfilter.ErrInvalidConfig) {
+		t.Errorf("err = %v, want ErrInvalidConfig", err)
+	}
+
+	if _, err := ccfilter.New(ccfilter.Options{RulesOnly: true, Configs: []string{config}, OnConfigError: ccfilter.FailOpen, Logger: log.New(io.Discard, "", 0)}); err != nil {
+		t.Errorf("fail_open: err = %v", err)
+	}
+}
+
+func ExampleFilter_Redact() {
+	f, err := ccfilter.New(ccfilter.Options{RulesOnly: true})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	result, err := f.Redact(context.Background(), "OPENAI_KEY: sk-abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUV")
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(result.Text)
+	fmt.Println(result.Findings[0].Rule)
+	// Output:
+	// OPENAI_KEY: ***************************************************
+	// openai_keys
+}
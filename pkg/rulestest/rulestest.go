@@ -0,0 +1,33 @@
+// Package rulestest checks pattern examples from Go tests, so a team that
+// keeps custom rules in a repository can verify them with "go test":
+//
+//	func TestRules(t *testing.T) {
+//		f, err := ccfilter.New(ccfilter.Options{Configs: []string{"cc-filter.yaml"}})
+//		if err != nil {
+//			t.Fatal(err)
+//		}
+//		rulestest.CheckExamples(t, f)
+//	}
+package rulestest
+
+import (
+	"testing"
+
+	"github.com/wissem/cc-filter/pkg/ccfilter"
+)
+
+// CheckExamples fails t for every pattern example in effect in f that does
+// not behave as declared
+func CheckExamples(t testing.TB, f *ccfilter.Filter) {
+	t.Helper()
+	for _, result := range f.CheckExamples() {
+		if result.Passed {
+			continue
+		}
+		if result.WantMatch {
+			t.Errorf("pattern %q (%s) should match %q", result.Pattern, result.Source, result.Input)
+		} else {
+			t.Errorf("pattern %q (%s) should not match %q", result.Pattern, result.Source, result.Input)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package rulestest
+
+import (
+	"os"
+	"testing"
+
+	"github.com/wissem/cc-filter/pkg/ccfilter"
+)
+
+func TestDefaultRuleExamples(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	data, err := os.ReadFile("../../configs/default-rules.yaml")
+	if err != nil {
+		t.Fatalf("failed to read default rules: %v", err)
+	}
+
+	f, err := ccfilter.New(ccfilter.Options{DefaultRules: data, Dir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("failed to load default rules: %v", err)
+	}
+
+	if untested := f.PatternsWithoutExamples(); len(untested) > 0 {
+		t.Errorf("default patterns without examples: %v", untested)
+	}
+	CheckExamples(t, f)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/wissem/cc-filter/internal/rules"
+)
+
+const policyUsage = `Usage:
+    cc-filter policy keygen [--out DIR]
+    cc-filter policy sign --key FILE POLICY
+    cc-filter policy verify [--pub FILE] [POLICY]`
+
+// runPolicy implements the "policy" subcommands, used by whoever maintains
+// the organization policy
+func runPolicy(opts *options, args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, policyUsage)
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "keygen":
+		runPolicyKeygen(args[1:])
+	case "sign":
+		runPolicySign(args[1:])
+	case "verify":
+		runPolicyVerify(opts, args[1:])
+	default:
+		fmt.Fprintln(os.Stderr, policyUsage)
+		os.Exit(1)
+	}
+}
+
+// runPolicyKeygen writes policy.key (keep it secret, 0600) and policy.pub
+func runPolicyKeygen(args []string) {
+	flags := flag.NewFlagSet("policy keygen", flag.ExitOnError)
+	out := flags.String("out", ".", "directory to write policy.key and policy.pub to")
+	flags.Parse(args)
+
+	publicKey, privateKey, err := rules.GeneratePolicyKey()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to generate key: %v\n", err)
+		os.Exit(1)
+	}
+
+	keyPath := filepath.Join(*out, "policy.key")
+	pubPath := filepath.Join(*out, "policy.pub")
+	if _, err := os.Stat(keyPath); err == nil {
+		fmt.Fprintf(os.Stderr, "Refusing to overwrite %s\n", keyPath)
+		os.Exit(1)
+	}
+	if err := os.WriteFile(keyPath, []byte(privateKey+"\n"), 0600); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write private key: %v\n", err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile(pubPath, []byte(publicKey+"\n"), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write public key: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Private key: %s (keep it out of the policy directory)\nPublic key:  %s\n\n", keyPath, pubPath)
+	fmt.Printf("Pin it in the build with:\n    go build -ldflags \"-X main.policyPublicKey=%s\"\n", publicKey)
+	fmt.Printf("or in every hook command with:\n    cc-filter --policy-key %s\n", publicKey)
+}
+
+func runPolicySign(args []string) {
+	flags := flag.NewFlagSet("policy sign", flag.ExitOnError)
+	keyPath := flags.String("key", "", "private key written by policy keygen")
+	flags.Parse(args)
+
+	if *keyPath == "" || flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, policyUsage)
+		os.Exit(1)
+	}
+	policyFile := flags.Arg(0)
+
+	privateKey, err := os.ReadFile(*keyPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read private key: %v\n", err)
+		os.Exit(1)
+	}
+	policy, err := os.ReadFile(policyFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read policy: %v\n", err)
+		os.Exit(1)
+	}
+
+	signature, err := rules.SignPolicy(string(privateKey), policy)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to sign policy: %v\n", err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile(policyFile+".sig", []byte(signature+"\n"), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write signature: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Signed %s -> %s.sig\n", policyFile, policyFile)
+}
+
+// runPolicyVerify checks a policy's signature, by default the installed
+// policy against the key this binary would use
+func runPolicyVerify(opts *options, args []string) {
+	flags := flag.NewFlagSet("policy verify", flag.ExitOnError)
+	pubPath := flags.String("pub", "", "public key file (default: the pinned key)")
+	flags.Parse(args)
+
+	policyFile := rules.PolicyPath()
+	if flags.NArg() > 0 {
+		policyFile = flags.Arg(0)
+	}
+
+	publicKey := opts.pinnedPolicyKey()
+	if *pubPath != "" {
+		data, err := os.ReadFile(*pubPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read public key: %v\n", err)
+			os.Exit(1)
+		}
+		publicKey = string(data)
+	}
+	if publicKey == "" {
+		fmt.Fprintln(os.Stderr, "No policy key is pinned; give one with --policy-key or --pub FILE")
+		os.Exit(1)
+	}
+
+	policy, err := os.ReadFile(policyFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read policy: %v\n", err)
+		os.Exit(1)
+	}
+	signature, err := os.ReadFile(policyFile + ".sig")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read signature: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := rules.VerifyPolicy(publicKey, policy, signature); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", policyFile, err)
+		os.Exit(1)
+	}
+	fmt.Printf("%s: signature OK\n", policyFile)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/wissem/cc-filter/internal/rules"
+)
+
+const rulesUsage = `Usage:
+    cc-filter rules test [--dir DIR] [--verbose]
+    cc-filter rules import --from gitleaks|detect-secrets|trufflehog FILE`
+
+// runRules implements the "rules" subcommands
+func runRules(opts *options, args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, rulesUsage)
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "test":
+		runRulesTest(opts, args[1:])
+	case "import":
+		runRulesImport(args[1:])
+	default:
+		fmt.Fprintln(os.Stderr, rulesUsage)
+		os.Exit(1)
+	}
+}
+
+func runRulesTest(opts *options, args []string) {
+	flags := flag.NewFlagSet("rules test", flag.ExitOnError)
+	dir := flags.String("dir", "", "project directory to discover configs from (default: current directory)")
+	verbose := flags.Bool("verbose", false, "list passing examples too")
+	flags.Parse(args)
+
+	r, err := rules.Load(defaultRulesYAML, opts.loadOptions(*dir))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load configuration: %v\n", err)
+		os.Exit(1)
+	}
+
+	results := r.CheckExamples()
+	failed := 0
+	for _, result := range results {
+		expectation := "should match"
+		if !result.WantMatch {
+			expectation = "should not match"
+		}
+		switch {
+		case !result.Passed:
+			failed++
+			fmt.Printf("FAIL  %s (%s) %s %q\n", result.Pattern, result.Source, expectation, result.Input)
+		case *verbose:
+			fmt.Printf("ok    %s %s %q\n", result.Pattern, expectation, result.Input)
+		}
+	}
+
+	for _, name := range r.PatternsWithoutExamples() {
+		fmt.Printf("note  %s (%s) has no examples\n", name, r.Origin("patterns", name))
+	}
+
+	fmt.Printf("\n%d examples, %d failed\n", len(results), failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// runRulesImport converts another scanner's rules to cc-filter patterns and
+// prints them as a config file. Rules that could not be converted are
+// reported on stderr.
+func runRulesImport(args []string) {
+	flags := flag.NewFlagSet("rules import", flag.ExitOnError)
+	from := flags.String("from", "", "source format: "+strings.Join(rules.ImportFormats, ", "))
+	flags.Parse(args)
+
+	if *from == "" || flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, rulesUsage)
+		os.Exit(1)
+	}
+
+	data, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read rules: %v\n", err)
+		os.Exit(1)
+	}
+
+	patterns, warnings, err := rules.ImportPatterns(*from, data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to import rules: %v\n", err)
+		os.Exit(1)
+	}
+	for _, warning := range warnings {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", warning)
+	}
+
+	out, err := rules.PatternsYAML(patterns)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to render patterns: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("# Imported from %s (%s): %d patterns\n", flags.Arg(0), *from, len(patterns))
+	os.Stdout.Write(out)
+}